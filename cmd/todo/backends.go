@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// runBackends lists the storage backends compiled into this binary and
+// the settings each one reads
+func runBackends(args []string) error {
+	if len(args) > 0 {
+		if args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+			fmt.Fprintln(os.Stderr, "Usage: todo backends")
+			fmt.Fprintln(os.Stderr, "")
+			fmt.Fprintln(os.Stderr, "List the available storage backends and their settings.")
+			return nil
+		}
+		return errors.New("backends: unexpected arguments")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, backend := range storage.Backends() {
+		name := backend.Name
+		if len(backend.Aliases) > 0 {
+			name += " (" + strings.Join(backend.Aliases, ", ") + ")"
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, backend.Description)
+
+		for _, setting := range backend.Settings {
+			var notes []string
+			if setting.Required {
+				notes = append(notes, "required")
+			}
+			if setting.Default != "" {
+				notes = append(notes, "default: "+setting.Display(setting.Default))
+			}
+			desc := setting.Description
+			if len(notes) > 0 {
+				desc += " [" + strings.Join(notes, ", ") + "]"
+			}
+			fmt.Fprintf(w, "  %s\t%s\n", setting.Name, desc)
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nirabyte/todo/internal/models"
+)
+
+func runBackup(args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: todo backup list")
+		fmt.Fprintln(os.Stderr, "       todo backup restore <id>")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "List or restore automatic snapshots of the data file.")
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("backup: missing subcommand")
+	}
+
+	switch args[0] {
+	case "-h", "--help", "help":
+		usage()
+		return nil
+	case "list":
+		if len(args) != 1 {
+			usage()
+			return errors.New("backup list: unexpected arguments")
+		}
+	case "restore":
+		if len(args) != 2 {
+			usage()
+			return errors.New("backup restore: expected a backup id")
+		}
+	default:
+		usage()
+		return fmt.Errorf("backup: unknown subcommand %q", args[0])
+	}
+
+	if err := openStorage(); err != nil {
+		return err
+	}
+	defer models.CloseStorage()
+
+	if args[0] == "list" {
+		return listBackups()
+	}
+	return restoreBackup(args[1])
+}
+
+func listBackups() error {
+	backups, err := models.ListBackups()
+	if err != nil {
+		return err
+	}
+	if len(backups) == 0 {
+		fmt.Println("No backups yet")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTAKEN")
+	for _, b := range backups {
+		fmt.Fprintf(w, "%s\t%s\n", b.ID, b.Time.Local().Format(time.DateTime))
+	}
+	return w.Flush()
+}
+
+func restoreBackup(id string) error {
+	data, err := models.RestoreBackup(id)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored backup %s (%d tasks)\n", id, len(data.Tasks))
+	return nil
+}
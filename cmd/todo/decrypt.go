@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/nirabyte/todo/internal/models"
+	"golang.org/x/term"
+)
+
+func runDecrypt(args []string) error {
+	fs := flag.NewFlagSet("decrypt", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write the decrypted data to, or - for stdout")
+	force := fs.Bool("force", false, "overwrite the output file if it exists")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: todo decrypt --out FILE")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Export the stored data as plain JSON, e.g. for recovery.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if *out == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return errors.New("decrypt: --out is required")
+	}
+
+	if err := openStorage(); err != nil {
+		return err
+	}
+	defer models.CloseStorage()
+
+	data, err := models.ExportData()
+	if err != nil {
+		return fmt.Errorf("failed to read data: %w", err)
+	}
+	data = append(data, '\n')
+
+	if *out == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if *force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(*out, flags, 0600)
+	if err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", *out)
+		}
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote decrypted data to %s; it is not protected, delete it when done\n", *out)
+	return nil
+}
+
+// offerEncryption finds data written without encryption and offers to
+// encrypt it in place. Loading it with encryption on would fail.
+func offerEncryption() error {
+	keys := models.PlaintextKeys()
+	if len(keys) == 0 {
+		return nil
+	}
+
+	list := strings.Join(keys, ", ")
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return fmt.Errorf("found unencrypted data (%s); run todo in a terminal to encrypt it, or use --no-encryption", list)
+	}
+
+	fmt.Fprintf(os.Stderr, "Found unencrypted data (%s). Encrypt it now? [Y/n] ", list)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("failed to read answer: %w", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "", "y", "yes":
+	default:
+		return errors.New("data left unencrypted; use --no-encryption to open it as is")
+	}
+
+	if err := models.EncryptPlaintext(); err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, "Data encrypted")
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/models"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+func runKey(args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: todo key rotate")
+		fmt.Fprintln(os.Stderr, "       todo key export [--format armor|mnemonic|qr] [--out FILE]")
+		fmt.Fprintln(os.Stderr, "       todo key import [--force] [FILE]")
+		fmt.Fprintln(os.Stderr, "       todo key fingerprint")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Rotate the encryption key, or copy it to another device. Compare")
+		fmt.Fprintln(os.Stderr, "fingerprints to confirm two devices use the same key.")
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("key: missing subcommand")
+	}
+
+	switch args[0] {
+	case "-h", "--help", "help":
+		usage()
+		return nil
+	case "rotate":
+		if len(args) != 1 {
+			usage()
+			return errors.New("key rotate: unexpected arguments")
+		}
+		return rotateKey()
+	case "export":
+		return exportKey(args[1:])
+	case "import":
+		return importKey(args[1:])
+	case "fingerprint":
+		if len(args) != 1 {
+			usage()
+			return errors.New("key fingerprint: unexpected arguments")
+		}
+		return printFingerprint()
+	default:
+		usage()
+		return fmt.Errorf("key: unknown subcommand %q", args[0])
+	}
+}
+
+// rotateKey moves the stored data to a new key. The new key is kept in
+// KEY.new until every value is re-encrypted and verified, so an interrupted
+// rotation can be resumed by running it again.
+func rotateKey() error {
+	keySource, err := getKeySource()
+	if err != nil {
+		return err
+	}
+	switch keySource {
+	case "file":
+	case "passphrase":
+		return errors.New("key rotate: not supported for passphrase keys; use todo migrate --from-passphrase/--to-passphrase")
+	default:
+		return fmt.Errorf("key rotate: only supported for the key file, not TODO_KEY_SOURCE=%s", keySource)
+	}
+
+	keyPath := getKeyPath()
+	oldKey, err := readEncryptionKey(keyPath)
+	if err != nil {
+		return err
+	}
+
+	newPath := keyPath + ".new"
+	newKey, err := readEncryptionKey(newPath)
+	switch {
+	case err == nil:
+		fmt.Printf("Resuming interrupted rotation with %s\n", newPath)
+	case errors.Is(err, os.ErrNotExist):
+		if newKey, err = generateEncryptionKey(); err != nil {
+			return fmt.Errorf("failed to generate encryption key: %w", err)
+		}
+		if err := writeFileAtomic(newPath, []byte(newKey), 0600); err != nil {
+			return fmt.Errorf("failed to save new encryption key: %w", err)
+		}
+	default:
+		return err
+	}
+
+	log.Printf("Rotating encryption key for %s storage", config.StorageType)
+	result, err := models.RotateKey(config.StorageType, oldKey, newKey)
+	if err != nil {
+		return fmt.Errorf("key rotation failed, %s still holds the current key: %w", keyPath, err)
+	}
+
+	if err := os.Rename(newPath, keyPath); err != nil {
+		return fmt.Errorf("data was re-encrypted, but replacing %s failed; move %s there by hand: %w", keyPath, newPath, err)
+	}
+
+	raw, _ := hex.DecodeString(newKey)
+	defer clear(raw)
+	log.Printf("Rotated encryption key, re-encrypted %d keys", len(result.Copied))
+	fmt.Printf("Re-encrypted %d keys, new key ID %x\n", len(result.Copied), storage.KeyID(raw))
+	return nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it into place, so readers never see a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nirabyte/todo/internal/storage"
+	"github.com/skip2/go-qrcode"
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+func exportKey(args []string) error {
+	fs := flag.NewFlagSet("key export", flag.ContinueOnError)
+	format := fs.String("format", "armor", "armor (text block), mnemonic (24-word recovery phrase) or qr (recovery phrase as a terminal QR code)")
+	out := fs.String("out", "", "file to write the key to (default: stdout)")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: todo key export [--format armor|mnemonic|qr] [--out FILE]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Print the encryption key for 'todo key import' on another device.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errors.New("key export: unexpected arguments")
+	}
+
+	key, err := currentKey()
+	if err != nil {
+		return err
+	}
+	raw, _ := hex.DecodeString(key)
+	defer clear(raw)
+
+	var text string
+	switch *format {
+	case "armor":
+		text = storage.ArmorKey(raw)
+	case "mnemonic", "qr":
+		mnemonic, err := storage.KeyMnemonic(raw)
+		if err != nil {
+			return err
+		}
+		text = mnemonic + "\n"
+		if *format == "qr" {
+			code, err := qrcode.New(mnemonic, qrcode.Medium)
+			if err != nil {
+				return err
+			}
+			text = code.ToSmallString(false)
+		}
+	default:
+		return fmt.Errorf("key export: unknown format %q (supported: armor, mnemonic, qr)", *format)
+	}
+
+	if *out == "" {
+		fmt.Print(text)
+	} else {
+		file, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := file.WriteString(text); err != nil {
+			file.Close()
+			return err
+		}
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Fingerprint: %s\n", storage.Fingerprint(raw))
+	fmt.Fprintln(os.Stderr, "Anyone with this key can read your data; keep it private.")
+	return nil
+}
+
+func importKey(args []string) error {
+	fs := flag.NewFlagSet("key import", flag.ContinueOnError)
+	force := fs.Bool("force", false, "replace a different existing key, keeping it as the old key")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: todo key import [--force] [FILE]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Install a key from 'todo key export': an armored block, a recovery")
+		fmt.Fprintln(fs.Output(), "phrase or 64 hex characters, read from FILE or stdin.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return errors.New("key import: expected at most one file")
+	}
+
+	var input string
+	var err error
+	if fs.NArg() == 1 {
+		var data []byte
+		data, err = os.ReadFile(fs.Arg(0))
+		input = string(data)
+	} else {
+		input, err = readKeyInput()
+	}
+	if err != nil {
+		return err
+	}
+
+	raw, err := storage.ParseKeyText(input)
+	if err != nil {
+		return err
+	}
+	defer clear(raw)
+	if err := installKey(hex.EncodeToString(raw), *force); err != nil {
+		return err
+	}
+	fmt.Printf("Imported key %s\n", storage.Fingerprint(raw))
+	return nil
+}
+
+func printFingerprint() error {
+	key, err := currentKey()
+	if err != nil {
+		return err
+	}
+	raw, _ := hex.DecodeString(key)
+	defer clear(raw)
+	fmt.Println(storage.Fingerprint(raw))
+	return nil
+}
+
+// currentKey returns the configured hex key without generating one
+func currentKey() (string, error) {
+	source, err := getKeySource()
+	if err != nil {
+		return "", err
+	}
+	switch source {
+	case "passphrase", "none":
+		return "", fmt.Errorf("no key to share with TODO_KEY_SOURCE=%s", source)
+	case "recipients":
+		return "", errors.New("the data key is shared with 'todo recipients add', not exported")
+	case "file":
+		return readEncryptionKey(getKeyPath())
+	default:
+		key, _, _, err := loadEncryptionKey(source)
+		return key, err
+	}
+}
+
+// installKey stores key where the key source reads it. A different
+// existing key is only replaced with force, and is kept next to it.
+func installKey(key string, force bool) error {
+	source, err := getKeySource()
+	if err != nil {
+		return err
+	}
+
+	switch source {
+	case "file":
+		keyPath := getKeyPath()
+		existing, err := readEncryptionKey(keyPath)
+		switch {
+		case err == nil && existing == key:
+			return nil
+		case err == nil && !force:
+			return fmt.Errorf("a different key is already in %s; use --force to replace it (it is kept in %s.old)", keyPath, keyPath)
+		case err == nil:
+			if _, err := os.Stat(keyPath + ".old"); err == nil {
+				return fmt.Errorf("%s.old already holds an earlier key; move it away before replacing %s", keyPath, keyPath)
+			}
+			if err := os.Rename(keyPath, keyPath+".old"); err != nil {
+				return fmt.Errorf("failed to keep the old key: %w", err)
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+		return writeFileAtomic(keyPath, []byte(key), 0600)
+	case "keyring":
+		existing, err := keyring.Get(keyringService, keyringAccount)
+		switch {
+		case err == nil && existing == key:
+			return nil
+		case err == nil && !force:
+			return errors.New("a different key is already in the OS keyring; use --force to replace it (it is kept as " + keyringAccount + ".old)")
+		case err == nil:
+			if _, err := keyring.Get(keyringService, keyringAccount+".old"); err == nil {
+				return errors.New("the OS keyring already holds an earlier key as " + keyringAccount + ".old; remove it before replacing the key")
+			}
+			if err := keyring.Set(keyringService, keyringAccount+".old", existing); err != nil {
+				return fmt.Errorf("failed to keep the old key: %w", err)
+			}
+		case !errors.Is(err, keyring.ErrNotFound):
+			return err
+		}
+		return keyring.Set(keyringService, keyringAccount, key)
+	default:
+		return fmt.Errorf("key import: not supported for TODO_KEY_SOURCE=%s; store the key where that source reads it", source)
+	}
+}
+
+// readKeyInput reads the key from stdin. On a terminal input ends at the
+// first empty line after some text, so a pasted block needs no Ctrl-D; an
+// armored key ends at its -----END line instead, as it holds an empty line
+// after its headers.
+func readKeyInput() (string, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		data, err := io.ReadAll(os.Stdin)
+		return string(data), err
+	}
+
+	fmt.Fprintln(os.Stderr, "Paste the exported key or type the recovery phrase, then an empty line:")
+	var lines []string
+	armored := false
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(lines) == 0 {
+			if line == "" {
+				continue
+			}
+			armored = strings.HasPrefix(line, "-----BEGIN")
+		}
+		if line == "" && !armored {
+			break
+		}
+		lines = append(lines, line)
+		if armored && strings.HasPrefix(line, "-----END") {
+			break
+		}
+	}
+	return strings.Join(lines, "\n"), scanner.Err()
+}
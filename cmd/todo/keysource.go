@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/nirabyte/todo/internal/storage"
+	"github.com/zalando/go-keyring"
+)
+
+// The encryption key is stored in the OS keyring (Secret Service on Linux,
+// Keychain on macOS, Credential Manager on Windows) under this service and
+// account
+const (
+	keyringService = "todo"
+	keyringAccount = "encryption-key"
+)
+
+// noEncryption is set by the --no-encryption flag
+var noEncryption bool
+
+// getKeySource returns where the encryption key comes from: "none" for
+// --no-encryption, TODO_KEY_SOURCE if set, else implied by TODO_PASSPHRASE,
+// TODO_KEY or TODO_KEY_COMMAND, else "file"
+func getKeySource() (string, error) {
+	if noEncryption {
+		return "none", nil
+	}
+	source := strings.ToLower(os.Getenv("TODO_KEY_SOURCE"))
+	switch source {
+	case "":
+		switch {
+		case os.Getenv("TODO_PASSPHRASE") != "":
+			return "passphrase", nil
+		case os.Getenv("TODO_KEY") != "":
+			return "env", nil
+		case os.Getenv("TODO_KEY_COMMAND") != "":
+			return "command", nil
+		}
+		return "file", nil
+	case "file", "passphrase", "keyring", "env", "command", "recipients", "none":
+		return source, nil
+	default:
+		return "", fmt.Errorf("invalid TODO_KEY_SOURCE=%s (supported: file, keyring, env, command, passphrase, recipients, none)", source)
+	}
+}
+
+// loadEncryptionKey returns the hex key from a non-passphrase source.
+// keyPath is set when the key file was used, isNew when the key was
+// generated.
+func loadEncryptionKey(source string) (key, keyPath string, isNew bool, err error) {
+	switch source {
+	case "file":
+		keyPath = getKeyPath()
+		key, isNew, err = initializeEncryptionKey(keyPath)
+		return key, keyPath, isNew, err
+	case "keyring":
+		return loadKeyringKey()
+	case "env":
+		value := os.Getenv("TODO_KEY")
+		if value == "" {
+			return "", "", false, errors.New("TODO_KEY_SOURCE=env but TODO_KEY is not set")
+		}
+		key, err = parseEncryptionKey(value, "TODO_KEY")
+		return key, "", false, err
+	case "command":
+		key, err = runKeyCommand(os.Getenv("TODO_KEY_COMMAND"))
+		return key, "", false, err
+	default:
+		return "", "", false, fmt.Errorf("key source %s has no key to load", source)
+	}
+}
+
+// loadKeyringKey reads the key from the OS keyring. An existing key file
+// is copied into an empty keyring; when no keyring is available the key
+// file is used instead.
+func loadKeyringKey() (key, keyPath string, isNew bool, err error) {
+	secret, err := keyring.Get(keyringService, keyringAccount)
+	if err == nil {
+		key, err = parseEncryptionKey(secret, "the OS keyring")
+		return key, "", false, err
+	}
+
+	keyPath = getKeyPath()
+	_, statErr := os.Stat(keyPath)
+	fileExists := statErr == nil
+
+	if !errors.Is(err, keyring.ErrNotFound) {
+		// Never generate a new key here: the real one may be in the keyring
+		if !fileExists {
+			return "", "", false, fmt.Errorf("OS keyring is unavailable and there is no key file at %s: %w", keyPath, err)
+		}
+		log.Printf("Warning: OS keyring is unavailable (%v), using the key file", err)
+		key, err = readEncryptionKey(keyPath)
+		return key, keyPath, false, err
+	}
+
+	if fileExists {
+		if key, err = readEncryptionKey(keyPath); err != nil {
+			return "", "", false, err
+		}
+		if err := keyring.Set(keyringService, keyringAccount, key); err != nil {
+			log.Printf("Warning: failed to copy the key to the OS keyring (%v), using the key file", err)
+			return key, keyPath, false, nil
+		}
+		log.Printf("Copied the encryption key from %s to the OS keyring; back it up before removing the file", keyPath)
+		return key, "", false, nil
+	}
+
+	log.Println("No key in the OS keyring, generating new key...")
+	if key, err = generateEncryptionKey(); err != nil {
+		return "", "", false, fmt.Errorf("failed to generate encryption key: %w", err)
+	}
+	if err := keyring.Set(keyringService, keyringAccount, key); err != nil {
+		return "", "", false, fmt.Errorf("failed to store the encryption key in the OS keyring: %w", err)
+	}
+	return key, "", true, nil
+}
+
+// keyCommandTimeout bounds TODO_KEY_COMMAND, long enough to type a master
+// password at its prompt
+var keyCommandTimeout = 2 * time.Minute
+
+// runKeyCommand runs TODO_KEY_COMMAND through the shell and reads the key
+// from the first line of its output, e.g. "pass show todo", or from all of
+// it for an armored key. The command shares the terminal, so it can prompt
+// for a master password.
+func runKeyCommand(command string) (string, error) {
+	if command == "" {
+		return "", errors.New("TODO_KEY_SOURCE=command but TODO_KEY_COMMAND is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), keyCommandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stderr = os.Stderr
+	// Children of the shell may keep the output open after it is killed
+	cmd.WaitDelay = time.Second
+
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("TODO_KEY_COMMAND timed out after %s", keyCommandTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("TODO_KEY_COMMAND failed: %w", err)
+	}
+	if !bytes.HasPrefix(bytes.TrimSpace(out), []byte("-----BEGIN")) {
+		out, _, _ = bytes.Cut(out, []byte("\n"))
+	}
+	return parseEncryptionKey(string(out), "TODO_KEY_COMMAND output")
+}
+
+// parseEncryptionKey accepts 64 hex characters, a base64 key or an armored
+// key from 'todo key export' and returns the key as hex; origin names where
+// it came from
+func parseEncryptionKey(value, origin string) (string, error) {
+	text := strings.TrimSpace(value)
+
+	var raw []byte
+	var err error
+	switch {
+	case strings.HasPrefix(text, "-----BEGIN"):
+		if raw, err = storage.ParseKeyText(text); err != nil {
+			return "", fmt.Errorf("invalid key in %s: %w", origin, err)
+		}
+	case isHex(text):
+		raw, _ = hex.DecodeString(text)
+	default:
+		if raw, err = base64.StdEncoding.DecodeString(text); err != nil {
+			return "", fmt.Errorf("invalid key format in %s: expected 64 hex characters, base64 or an armored key", origin)
+		}
+	}
+	defer clear(raw)
+
+	if len(raw) != 32 {
+		return "", fmt.Errorf("invalid key length in %s: expected 32 bytes (64 hex characters), got %d", origin, len(raw))
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// isHex reports whether s is an even number of hex digits
+func isHex(s string) bool {
+	_, err := hex.DecodeString(s)
+	return err == nil && s != ""
+}
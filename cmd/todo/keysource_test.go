@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nirabyte/todo/internal/storage"
+	"github.com/zalando/go-keyring"
+)
+
+const testKey = "000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f"
+
+func TestGetKeySource(t *testing.T) {
+	tests := []struct {
+		name         string
+		env          map[string]string
+		noEncryption bool
+		want         string
+		wantErr      bool
+	}{
+		{name: "default", want: "file"},
+		{name: "passphrase implied", env: map[string]string{"TODO_PASSPHRASE": "secret"}, want: "passphrase"},
+		{name: "env implied", env: map[string]string{"TODO_KEY": testKey}, want: "env"},
+		{name: "command implied", env: map[string]string{"TODO_KEY_COMMAND": "pass show todo"}, want: "command"},
+		{name: "passphrase before key", env: map[string]string{"TODO_PASSPHRASE": "secret", "TODO_KEY": testKey}, want: "passphrase"},
+		{name: "key before command", env: map[string]string{"TODO_KEY": testKey, "TODO_KEY_COMMAND": "pass show todo"}, want: "env"},
+		{name: "explicit source wins", env: map[string]string{"TODO_KEY_SOURCE": "keyring", "TODO_KEY": testKey}, want: "keyring"},
+		{name: "case insensitive", env: map[string]string{"TODO_KEY_SOURCE": "Recipients"}, want: "recipients"},
+		{name: "no encryption wins", env: map[string]string{"TODO_KEY_SOURCE": "keyring"}, noEncryption: true, want: "none"},
+		{name: "invalid", env: map[string]string{"TODO_KEY_SOURCE": "vault"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"TODO_KEY_SOURCE", "TODO_PASSPHRASE", "TODO_KEY", "TODO_KEY_COMMAND"} {
+				t.Setenv(name, tt.env[name])
+			}
+			noEncryption = tt.noEncryption
+			t.Cleanup(func() { noEncryption = false })
+
+			got, err := getKeySource()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %q", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("expected %q, got %q (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestLoadKeyringKey(t *testing.T) {
+	unavailable := errors.New("no secret service")
+	tests := []struct {
+		name        string
+		keyringErr  error  // keyring is unavailable
+		stored      string // key in the keyring
+		file        string // key in the key file
+		want        string // "" for a generated key
+		wantFile    bool   // the key file is used
+		wantNew     bool
+		wantErr     bool
+		wantKeyring string // key in the keyring afterwards
+	}{
+		{name: "from keyring", stored: testKey, file: strings.Repeat("ab", 32), want: testKey, wantKeyring: testKey},
+		{name: "file copied into empty keyring", file: testKey, want: testKey, wantKeyring: testKey},
+		{name: "generated into empty keyring", wantNew: true},
+		{name: "unavailable keyring falls back to file", keyringErr: unavailable, file: testKey, want: testKey, wantFile: true},
+		{name: "unavailable keyring without file", keyringErr: unavailable, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyPath := filepath.Join(t.TempDir(), "key")
+			t.Setenv("TODO_KEY_PATH", keyPath)
+			if tt.file != "" {
+				if err := os.WriteFile(keyPath, []byte(tt.file), 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			keyring.MockInit()
+			if tt.stored != "" {
+				if err := keyring.Set(keyringService, keyringAccount, tt.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.keyringErr != nil {
+				keyring.MockInitWithError(tt.keyringErr)
+			}
+
+			key, path, isNew, err := loadKeyringKey()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error")
+				}
+				if _, err := os.Stat(keyPath); !os.IsNotExist(err) {
+					t.Fatalf("expected no key file to be created")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load failed: %v", err)
+			}
+			if tt.want != "" && key != tt.want {
+				t.Fatalf("expected key %q, got %q", tt.want, key)
+			}
+			if isNew != tt.wantNew {
+				t.Fatalf("expected isNew %t, got %t", tt.wantNew, isNew)
+			}
+			if (path != "") != tt.wantFile {
+				t.Fatalf("unexpected key path %q", path)
+			}
+
+			if tt.keyringErr != nil {
+				return
+			}
+			stored, err := keyring.Get(keyringService, keyringAccount)
+			if err != nil || stored != key {
+				t.Fatalf("expected the key in the keyring, got %q (%v)", stored, err)
+			}
+			if tt.wantKeyring != "" && stored != tt.wantKeyring {
+				t.Fatalf("expected keyring to hold %q, got %q", tt.wantKeyring, stored)
+			}
+		})
+	}
+}
+
+func TestRunKeyCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	armored := storage.ArmorKey(mustDecodeHex(t, testKey))
+
+	tests := []struct {
+		name    string
+		command string
+		timeout time.Duration
+		want    string
+		wantErr string
+	}{
+		{name: "first line", command: "echo " + testKey + "; echo ignored", want: testKey},
+		{name: "armored", command: "printf '%s' '" + armored + "'", want: testKey},
+		{name: "not set", wantErr: "TODO_KEY_COMMAND is not set"},
+		{name: "exit status", command: "echo " + testKey + "; exit 3", wantErr: "exit status 3"},
+		{name: "invalid output", command: "echo nope", wantErr: "invalid key"},
+		{name: "timeout", command: "exec sleep 5", timeout: 100 * time.Millisecond, wantErr: "timed out"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.timeout > 0 {
+				previous := keyCommandTimeout
+				keyCommandTimeout = tt.timeout
+				t.Cleanup(func() { keyCommandTimeout = previous })
+			}
+
+			start := time.Now()
+			got, err := runKeyCommand(tt.command)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+				if tt.timeout > 0 && time.Since(start) > 3*time.Second {
+					t.Fatalf("command was not stopped at the timeout")
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("expected %q, got %q (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func TestParseEncryptionKey(t *testing.T) {
+	raw := mustDecodeHex(t, testKey)
+	armored := storage.ArmorKey(raw)
+
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr string
+	}{
+		{name: "hex", value: testKey, want: testKey},
+		{name: "upper case hex", value: strings.ToUpper(testKey), want: testKey},
+		{name: "surrounding space", value: "  " + testKey + "\n", want: testKey},
+		{name: "base64", value: base64.StdEncoding.EncodeToString(raw), want: testKey},
+		{name: "armored", value: armored, want: testKey},
+		{name: "short hex", value: testKey[:62], wantErr: "invalid key length"},
+		{name: "long hex", value: testKey + "00", wantErr: "invalid key length"},
+		{name: "short base64", value: base64.StdEncoding.EncodeToString(raw[:16]), wantErr: "invalid key length"},
+		{name: "damaged armor", value: strings.Replace(armored, "-----END", "-----XXX", 1), wantErr: "invalid key"},
+		{name: "garbage", value: "not a key!", wantErr: "invalid key format"},
+		{name: "empty", value: "", wantErr: "invalid key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseEncryptionKey(tt.value, "test")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %q (%v)", tt.wantErr, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("expected %q, got %q (%v)", tt.want, got, err)
+			}
+		})
+	}
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	raw, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nirabyte/todo/internal/models"
+)
+
+func runLog(args []string) error {
+	fs := flag.NewFlagSet("log", flag.ContinueOnError)
+	limit := fs.Int("n", 0, "show only the newest N entries (0 shows all)")
+	verify := fs.Bool("verify", false, "only verify the chain, without listing entries")
+	asJSON := fs.Bool("json", false, "print the entries as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: todo log [-n N] [--verify] [--json]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Show who changed which task and when, and verify that no entry of the")
+		fmt.Fprintln(fs.Output(), "hash-chained audit log was modified, removed or reordered.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return errors.New("log: unexpected arguments")
+	}
+
+	if err := openStorage(); err != nil {
+		return err
+	}
+	defer models.CloseStorage()
+
+	entries, err := models.ReadAuditLog()
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		if *asJSON {
+			return printAuditJSON([]models.AuditEntry{})
+		}
+		fmt.Println("No audit entries yet")
+		return nil
+	}
+
+	if !*verify {
+		shown := entries
+		if *limit > 0 && *limit < len(shown) {
+			shown = shown[len(shown)-*limit:]
+		}
+		if *asJSON {
+			if err := printAuditJSON(shown); err != nil {
+				return err
+			}
+		} else if err := printAudit(shown); err != nil {
+			return err
+		}
+	}
+
+	if err := models.VerifyAuditLog(entries); err != nil {
+		return err
+	}
+	head := entries[len(entries)-1]
+	fmt.Fprintf(os.Stderr, "Chain intact: %d entries, head %s\n", len(entries), head.Hash)
+	return nil
+}
+
+func printAudit(entries []models.AuditEntry) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SEQ\tTIME\tACTOR\tACTION\tTASK\tCHANGE")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", e.Seq, e.Time.Local().Format(time.DateTime), e.Actor, e.Action, e.Title, describeChange(e))
+	}
+	return w.Flush()
+}
+
+func printAuditJSON(entries []models.AuditEntry) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+// describeChange formats an entry's old and new values
+func describeChange(e models.AuditEntry) string {
+	switch {
+	case e.From == "" && e.To == "":
+		return ""
+	case e.Action == models.AuditDue && e.To == "":
+		return "cleared " + formatAuditTime(e.From)
+	case e.Action == models.AuditDue:
+		if e.From == "" {
+			return "due " + formatAuditTime(e.To)
+		}
+		return formatAuditTime(e.From) + " -> " + formatAuditTime(e.To)
+	case e.Action == models.AuditRestore:
+		return "backup " + e.To
+	case e.Action == models.AuditEdit:
+		return fmt.Sprintf("%q -> %q", e.From, e.To)
+	default:
+		return e.From + " -> " + e.To
+	}
+}
+
+// formatAuditTime shows an RFC 3339 time from the log in local time
+func formatAuditTime(value string) string {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return value
+	}
+	return t.Local().Format(time.DateTime)
+}
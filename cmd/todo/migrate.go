@@ -0,0 +1,273 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/models"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// backendFlags describes one side of a migration
+type backendFlags struct {
+	storageType string
+	envFile     string
+	keyPath     string
+	passphrase  bool
+	plain       bool
+}
+
+func (b *backendFlags) register(fs *flag.FlagSet, side, desc string) {
+	fs.StringVar(&b.storageType, side, "", desc+" storage type (default: STORAGE_TYPE from the env file or environment)")
+	fs.StringVar(&b.envFile, side+"-env", "", "env file with "+desc+" settings, same format as .env.example")
+	fs.StringVar(&b.keyPath, side+"-key", "", desc+" encryption key path (default: the key source of the env file or environment, see TODO_KEY_SOURCE)")
+	fs.BoolVar(&b.passphrase, side+"-passphrase", false, desc+" key is derived from a passphrase (TODO_PASSPHRASE or a prompt)")
+	fs.BoolVar(&b.plain, side+"-plain", false, desc+" data is not encrypted")
+}
+
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	var from, to backendFlags
+	from.register(fs, "from", "source")
+	to.register(fs, "to", "destination")
+	keys := fs.String("keys", "", "comma-separated keys to copy (default: every data key in the source)")
+	deleteSource := fs.Bool("delete-source", false, "delete source keys after the copy is verified")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: todo migrate --to TYPE [flags]")
+		fmt.Fprintln(fs.Output(), "")
+		fmt.Fprintln(fs.Output(), "Copy the stored todo data from one storage backend to another.")
+		fmt.Fprintln(fs.Output(), "")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+
+	if to.storageType == "" && to.envFile == "" {
+		fs.Usage()
+		return errors.New("migrate: --to or --to-env is required")
+	}
+
+	base := config.Capture()
+	defer base.Restore()
+
+	src, err := openMigrationSide(base, from, false)
+	if err != nil {
+		return fmt.Errorf("source: %w", err)
+	}
+	defer src.manager.Close()
+
+	dst, err := openMigrationSide(base, to, true)
+	if err != nil {
+		return fmt.Errorf("destination: %w", err)
+	}
+	defer dst.manager.Close()
+
+	// Different flags or env files can still point at the same bucket or
+	// database; deleting the source would then delete the copy
+	if src.location == dst.location {
+		return fmt.Errorf("migrate: source and destination are the same store (%s)", src.location)
+	}
+
+	opts := storage.MigrateOptions{DeleteSource: *deleteSource, Include: src.isDataKey}
+	if *keys != "" {
+		for _, key := range strings.Split(*keys, ",") {
+			if key = strings.TrimSpace(key); key != "" {
+				opts.Keys = append(opts.Keys, key)
+			}
+		}
+	}
+
+	// Task rows of the records schema are not stored as keys
+	if (src.records == nil) != (dst.records == nil) {
+		return errors.New("migrate: source and destination must use the same STORAGE_SCHEMA")
+	}
+	copyRecords := src.records != nil && len(opts.Keys) == 0
+
+	// A tampered log must not be re-signed for the destination below
+	if err := models.CheckAuditLog(src.manager, src.auditFile); err != nil {
+		return fmt.Errorf("migrate: the source audit log does not verify: %w", err)
+	}
+
+	var tasks []storage.TaskRecord
+	if copyRecords {
+		if tasks, err = storage.CopyRecords(src.records, dst.records); err != nil {
+			return err
+		}
+		fmt.Printf("copied   %d task records\n", len(tasks))
+	}
+
+	result, err := storage.Migrate(src.manager, dst.manager, opts)
+	if result != nil {
+		for _, key := range result.Skipped {
+			fmt.Printf("skipped  %s (not todo data; copy it with --keys)\n", key)
+		}
+		for _, key := range result.Copied {
+			fmt.Printf("copied   %s\n", key)
+		}
+		for _, key := range result.Deleted {
+			fmt.Printf("deleted  %s\n", key)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	// Entries are signed with a key derived from the source key
+	if slices.Contains(result.Copied, src.auditFile) {
+		if err := models.RechainAuditLog(src.manager.Encryptor(), dst.manager, src.auditFile); err != nil {
+			return fmt.Errorf("migrated, but failed to re-sign the audit log for the destination key: %w", err)
+		}
+	}
+
+	if copyRecords && opts.DeleteSource {
+		for _, task := range tasks {
+			if err := src.records.DeleteTask(task.ID); err != nil {
+				return fmt.Errorf("failed to delete task record %d from source: %w", task.ID, err)
+			}
+		}
+		fmt.Printf("deleted  %d task records\n", len(tasks))
+	}
+
+	log.Printf("Migrated %d keys and %d task records (deleted from source: %t)", len(result.Copied), len(tasks), opts.DeleteSource)
+	fmt.Printf("Migrated %d keys, verified round-trip decryption\n", len(result.Copied))
+	return nil
+}
+
+// migrationSide is an opened source or destination
+type migrationSide struct {
+	manager   *storage.StorageManager
+	records   *storage.RecordManager // nil for the blob schema
+	location  string                 // see storage.Backend.Location
+	isDataKey func(key string) bool  // see models.DataKeyFilter
+	auditFile string
+}
+
+// openMigrationSide applies one side's env file on top of the base config
+// and opens its storage. The key is loaded from the side's key source, as
+// at startup; a missing destination key file is generated.
+func openMigrationSide(base config.Snapshot, side backendFlags, createKey bool) (*migrationSide, error) {
+	base.Restore()
+
+	values := map[string]string{}
+	if side.envFile != "" {
+		var err error
+		if values, err = readEnvFile(side.envFile); err != nil {
+			return nil, err
+		}
+		loadConfigFrom(func(key string) string { return values[key] })
+	}
+	if side.keyPath != "" {
+		values["TODO_KEY_PATH"] = side.keyPath
+	}
+	// The key source reads the TODO_ variables from the environment
+	defer setKeyEnv(values)()
+
+	storageType := side.storageType
+	if storageType == "" {
+		storageType = config.StorageType
+	}
+	location, err := models.StorageLocation(storageType)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := loadMigrationKey(side, createKey); err != nil {
+		return nil, err
+	}
+
+	manager, records, err := models.OpenStorage(storageType)
+	if err != nil {
+		return nil, err
+	}
+	return &migrationSide{
+		manager:   manager,
+		records:   records,
+		location:  location,
+		isDataKey: models.DataKeyFilter(),
+		auditFile: config.AuditFile,
+	}, nil
+}
+
+// loadMigrationKey sets the key settings of config for one side. The
+// flags take precedence over the key source of the environment.
+func loadMigrationKey(side backendFlags, createKey bool) error {
+	config.KeySource = ""
+	config.EncryptionKey = ""
+	config.Passphrase = ""
+	config.PreviousKeys = nil
+	config.Identity = ""
+
+	var source string
+	var err error
+	switch {
+	case side.plain:
+		source = "none"
+	case side.passphrase:
+		source = "passphrase"
+	case side.keyPath != "":
+		source = "file"
+	default:
+		if source, err = getKeySource(); err != nil {
+			return err
+		}
+	}
+	config.KeySource = source
+
+	switch source {
+	case "none":
+	case "passphrase":
+		prompt := "Source passphrase: "
+		if createKey {
+			prompt = "Destination passphrase: "
+		}
+		config.Passphrase, _, err = readPassphrase(prompt)
+	case "recipients":
+		config.Identity, _, _, err = loadIdentity()
+	case "file":
+		if createKey {
+			config.EncryptionKey, _, err = initializeEncryptionKey(getKeyPath())
+		} else {
+			config.EncryptionKey, err = readEncryptionKey(getKeyPath())
+		}
+	default:
+		config.EncryptionKey, _, _, err = loadEncryptionKey(source)
+	}
+	return err
+}
+
+// setKeyEnv sets the TODO_ variables of values, which select and locate the
+// key, in the process environment, and returns a function restoring it
+func setKeyEnv(values map[string]string) (restore func()) {
+	type saved struct {
+		value string
+		ok    bool
+	}
+	previous := make(map[string]saved)
+	for name, value := range values {
+		if !strings.HasPrefix(name, "TODO_") {
+			continue
+		}
+		old, ok := os.LookupEnv(name)
+		previous[name] = saved{old, ok}
+		os.Setenv(name, value)
+	}
+	return func() {
+		for name, old := range previous {
+			if old.ok {
+				os.Setenv(name, old.value)
+			} else {
+				os.Unsetenv(name)
+			}
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"golang.org/x/term"
+)
+
+// readPassphrase returns TODO_PASSPHRASE, or prompts for the passphrase on
+// the terminal without echo. prompted reports whether the user typed it.
+func readPassphrase(prompt string) (passphrase string, prompted bool, err error) {
+	if passphrase := os.Getenv("TODO_PASSPHRASE"); passphrase != "" {
+		return passphrase, false, nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return "", false, errors.New("TODO_PASSPHRASE is not set and stdin is not a terminal")
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	input, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	if len(input) == 0 {
+		return "", false, errors.New("passphrase must not be empty")
+	}
+	return string(input), true, nil
+}
+
+// confirmPassphrase asks for a new passphrase a second time, so a typo does
+// not lock the data away
+func confirmPassphrase(passphrase string) error {
+	again, _, err := readPassphrase("Confirm new passphrase: ")
+	if err != nil {
+		return err
+	}
+	if again != passphrase {
+		return errors.New("passphrases do not match")
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/nirabyte/todo/internal/models"
+)
+
+// maxListedPaths caps the permissive files listed on stderr; the log has all
+const maxListedPaths = 5
+
+// checkPermissions warns when the key or local data files can be accessed
+// by other users, e.g. because an older version created them with 0644
+func checkPermissions(keyPath string) {
+	if runtime.GOOS == "windows" {
+		return // modes do not reflect Windows ACLs
+	}
+
+	loose := permissiveFiles(keyPath)
+	if len(loose) == 0 {
+		return
+	}
+
+	fmt.Fprintln(os.Stderr, "Warning: these files hold keys or data and are accessible by other users:")
+	for i, path := range loose {
+		if i == maxListedPaths {
+			fmt.Fprintf(os.Stderr, "  ... and %d more\n", len(loose)-maxListedPaths)
+			break
+		}
+		fmt.Fprintf(os.Stderr, "  %s\n", path)
+	}
+	fmt.Fprintln(os.Stderr, "Restrict them with 'chmod 600 FILE'.")
+}
+
+// permissiveFiles returns the key and data files other users can access,
+// with their modes. Only files the app writes are checked: the key, the
+// key being rotated to, the key 'todo key import --force' replaced (see
+// installKey), and models.LocalFiles.
+func permissiveFiles(keyPath string) []string {
+	var paths []string
+	if keyPath != "" {
+		paths = append(paths, keyPath, keyPath+".new", keyPath+".old")
+	}
+	files, err := models.LocalFiles()
+	if err != nil {
+		log.Printf("Warning: failed to list local data files: %v", err)
+	}
+	paths = append(paths, files...)
+
+	var loose []string
+	seen := make(map[string]bool)
+	for _, path := range paths {
+		if path = filepath.Clean(path); seen[path] {
+			continue
+		}
+		seen[path] = true
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() || info.Mode().Perm()&0077 == 0 {
+			continue
+		}
+		log.Printf("Warning: %s is accessible by other users (mode %04o)", path, info.Mode().Perm())
+		loose = append(loose, fmt.Sprintf("%s (mode %04o)", path, info.Mode().Perm()))
+	}
+	return loose
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nirabyte/todo/internal/config"
+)
+
+func TestPermissiveFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("modes do not reflect Windows ACLs")
+	}
+
+	tests := []struct {
+		name    string
+		storage string
+		cache   bool
+		files   map[string]os.FileMode // relative to a temp dir
+		key     string                 // key file relative to the temp dir
+		want    []string
+	}{
+		{
+			name:    "data keys only",
+			storage: "file",
+			files: map[string]os.FileMode{
+				"data/todos.json":                    0644,
+				"data/backup.todos.json.1":           0644,
+				"data/todos.json.conflict.1":         0640,
+				"data/audit.json":                    0600,
+				"data/.recipients":                   0604,
+				"data/notes.txt":                     0644,
+				"data/nested/todos.json":             0644,
+				"data/cache/webdav/todos.json":       0644,
+				"data/cache/webdav/.sync-state.json": 0644,
+			},
+			want: []string{"data/todos.json", "data/backup.todos.json.1", "data/todos.json.conflict.1", "data/.recipients"},
+		},
+		{
+			name:    "offline cache",
+			storage: "webdav",
+			cache:   true,
+			files: map[string]os.FileMode{
+				"data/cache/webdav/todos.json":            0644,
+				"data/cache/webdav/.sync-state.json":      0644,
+				"data/cache/webdav/.sync-base.todos.json": 0644,
+				"data/cache/webdav/other":                 0644,
+			},
+			want: []string{"data/cache/webdav/todos.json", "data/cache/webdav/.sync-state.json", "data/cache/webdav/.sync-base.todos.json"},
+		},
+		{
+			name:    "sqlite database",
+			storage: "sqlite",
+			files: map[string]os.FileMode{
+				"data/todo.db":     0644,
+				"data/todo.db-wal": 0644,
+				"data/other.db":    0644,
+			},
+			want: []string{"data/todo.db", "data/todo.db-wal"},
+		},
+		{
+			name:    "key files",
+			storage: "file",
+			files:   map[string]os.FileMode{"key": 0600, "key.new": 0644, "key.old": 0644, "key.bak": 0644},
+			key:     "key",
+			want:    []string{"key.new", "key.old"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			snapshot := config.Capture()
+			t.Cleanup(snapshot.Restore)
+
+			dir := t.TempDir()
+			config.DataPath = filepath.Join(dir, "data")
+			config.StorageType = tt.storage
+			config.StorageSchema = "blob"
+			config.StorageCache = tt.cache
+			config.CachePath = ""
+			config.BackendSettings = map[string]string{"WEBDAV_URL": "https://example.com/todo"}
+			for name, mode := range tt.files {
+				path := filepath.Join(dir, name)
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path, []byte("x"), mode); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.Chmod(path, mode); err != nil {
+					t.Fatal(err)
+				}
+			}
+			keyPath := ""
+			if tt.key != "" {
+				keyPath = filepath.Join(dir, tt.key)
+			}
+
+			var got []string
+			for _, entry := range permissiveFiles(keyPath) {
+				path, _, _ := strings.Cut(entry, " (mode")
+				rel, _ := filepath.Rel(dir, path)
+				got = append(got, rel)
+			}
+			want := make([]string, len(tt.want))
+			for i, name := range tt.want {
+				want[i] = filepath.FromSlash(name)
+			}
+			slices.Sort(got)
+			slices.Sort(want)
+			if !slices.Equal(got, want) {
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/models"
+)
+
+func runRecipients(args []string) error {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "Usage: todo recipients list")
+		fmt.Fprintln(os.Stderr, "       todo recipients add <age1...>")
+		fmt.Fprintln(os.Stderr, "       todo recipients remove [--keep-data-key] <age1...>")
+		fmt.Fprintln(os.Stderr, "       todo recipients whoami")
+		fmt.Fprintln(os.Stderr, "")
+		fmt.Fprintln(os.Stderr, "Share a list with TODO_KEY_SOURCE=recipients: the data key is stored")
+		fmt.Fprintln(os.Stderr, "with the data, wrapped for each member's age public key. New members")
+		fmt.Fprintln(os.Stderr, "send the output of 'whoami' to an existing member, who adds them.")
+	}
+	if len(args) == 0 {
+		usage()
+		return errors.New("recipients: missing subcommand")
+	}
+
+	switch args[0] {
+	case "-h", "--help", "help":
+		usage()
+		return nil
+	case "whoami":
+		if len(args) != 1 {
+			usage()
+			return errors.New("recipients whoami: unexpected arguments")
+		}
+		identity, _, _, err := loadIdentity()
+		if err != nil {
+			return err
+		}
+		parsed, err := age.ParseX25519Identity(identity)
+		if err != nil {
+			return err
+		}
+		fmt.Println(parsed.Recipient())
+		return nil
+	case "list", "add", "remove":
+	default:
+		usage()
+		return fmt.Errorf("recipients: unknown subcommand %q", args[0])
+	}
+
+	identity, _, _, err := loadIdentity()
+	if err != nil {
+		return err
+	}
+	config.Identity = identity
+
+	switch args[0] {
+	case "list":
+		if len(args) != 1 {
+			usage()
+			return errors.New("recipients list: unexpected arguments")
+		}
+		recipients, err := models.Recipients(config.StorageType)
+		if err != nil {
+			return err
+		}
+		for _, r := range recipients {
+			fmt.Println(r)
+		}
+		return nil
+	case "add":
+		if len(args) != 2 {
+			usage()
+			return errors.New("recipients add: expected one public key")
+		}
+		if err := models.AddRecipient(config.StorageType, args[1]); err != nil {
+			return err
+		}
+		fmt.Printf("Added %s\n", args[1])
+		return nil
+	default:
+		return removeRecipient(args[1:])
+	}
+}
+
+func removeRecipient(args []string) error {
+	fs := flag.NewFlagSet("recipients remove", flag.ContinueOnError)
+	keep := fs.Bool("keep-data-key", false, "only re-wrap the data key; the removed member can still read data if they kept it")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return errors.New("recipients remove: expected one public key")
+	}
+
+	recipient := fs.Arg(0)
+	result, err := models.RemoveRecipient(config.StorageType, recipient, *keep)
+	if err != nil {
+		return err
+	}
+	if *keep {
+		fmt.Printf("Removed %s\n", recipient)
+		return nil
+	}
+	log.Printf("Removed recipient %s, re-encrypted %d keys with a new data key", recipient, len(result.Copied))
+	fmt.Printf("Removed %s, re-encrypted %d keys with a new data key\n", recipient, len(result.Copied))
+	return nil
+}
+
+// loadIdentity reads the age identity from TODO_IDENTITY_PATH or
+// ~/.todo/identity, generating one on first use
+func loadIdentity() (identity, path string, isNew bool, err error) {
+	path = os.Getenv("TODO_IDENTITY_PATH")
+	if path == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", "", false, err
+		}
+		path = filepath.Join(homeDir, ".todo", "identity")
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		identity = strings.TrimSpace(string(data))
+		if _, err := age.ParseX25519Identity(identity); err != nil {
+			return "", "", false, fmt.Errorf("invalid age identity in %s: %w", path, err)
+		}
+		return identity, path, false, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", "", false, fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	log.Println("No age identity found, generating new identity...")
+	generated, err := age.GenerateX25519Identity()
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to generate identity: %w", err)
+	}
+	if err := writeFileAtomic(path, []byte(generated.String()+"\n"), 0600); err != nil {
+		return "", "", false, fmt.Errorf("failed to save identity: %w", err)
+	}
+	return generated.String(), path, true, nil
+}
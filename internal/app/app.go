@@ -1,6 +1,7 @@
 package app
 
 import (
+	"errors"
 	"math/rand"
 	"time"
 
@@ -12,10 +13,11 @@ import (
 )
 
 type App struct {
-	Model *models.Model
+	Model   *models.Model
+	program *tea.Program
 }
 
-func New() *App {
+func New() (*App, error) {
 	ti := textinput.New()
 	ti.CharLimit = 256
 	ti.Width = 50
@@ -23,7 +25,11 @@ func New() *App {
 
 	rand.Seed(time.Now().UnixNano())
 
-	data := models.LoadData()
+	data, err := models.LoadData()
+	if err != nil {
+		return nil, err
+	}
+
 	model := &models.Model{
 		Tasks:      data.Tasks,
 		State:      models.StateBrowse,
@@ -38,12 +44,26 @@ func New() *App {
 	styles.Update(themes.All[model.ThemeIndex])
 	model.ApplySort()
 
-	return &App{Model: model}
+	return &App{Model: model}, nil
 }
 
 func (a *App) Run() error {
 
-	p := tea.NewProgram(a.Model, tea.WithAltScreen())
-	_, err := p.Run()
+	a.program = tea.NewProgram(a.Model, tea.WithAltScreen())
+	_, err := a.program.Run()
 	return err
 }
+
+// Quit asks the running program to exit, e.g. on SIGTERM or SIGHUP
+func (a *App) Quit() {
+	if a.program != nil {
+		a.program.Quit()
+	}
+}
+
+// Shutdown flushes unsaved changes and closes the storage backend
+func (a *App) Shutdown() error {
+	flushErr := a.Model.Flush()
+	closeErr := models.CloseStorage()
+	return errors.Join(flushErr, closeErr)
+}
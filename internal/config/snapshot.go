@@ -0,0 +1,102 @@
+package config
+
+import (
+	"maps"
+	"slices"
+	"time"
+)
+
+// Snapshot is a copy of the storage settings. Commands that open more than
+// one backend (e.g. migrate) reconfigure the package variables for each side
+// and restore the snapshot in between.
+type Snapshot struct {
+	DataPath           string
+	DataFile           string
+	StorageType        string
+	StorageSchema      string
+	RecordsTable       string
+	RecordsPlaintext   bool
+	SettingsFile       string
+	StorageTimeout     time.Duration
+	StorageCompression string
+	StorageCache       bool
+	CachePath          string
+	SyncInterval       time.Duration
+	BackupPrefix       string
+	BackupInterval     time.Duration
+	BackupRecent       int
+	BackupHourly       int
+	BackupDaily        int
+	AuditLog           bool
+	AuditFile          string
+	AuditActor         string
+	KeySource          string
+	EncryptionKey      string
+	Passphrase         string
+	PreviousKeys       []string
+	Identity           string
+
+	BackendSettings map[string]string
+}
+
+// Capture returns the current settings
+func Capture() Snapshot {
+	return Snapshot{
+		DataPath:           DataPath,
+		DataFile:           DataFile,
+		StorageType:        StorageType,
+		StorageSchema:      StorageSchema,
+		RecordsTable:       RecordsTable,
+		RecordsPlaintext:   RecordsPlaintext,
+		SettingsFile:       SettingsFile,
+		StorageTimeout:     StorageTimeout,
+		StorageCompression: StorageCompression,
+		StorageCache:       StorageCache,
+		CachePath:          CachePath,
+		SyncInterval:       SyncInterval,
+		BackupPrefix:       BackupPrefix,
+		BackupInterval:     BackupInterval,
+		BackupRecent:       BackupRecent,
+		BackupHourly:       BackupHourly,
+		BackupDaily:        BackupDaily,
+		AuditLog:           AuditLog,
+		AuditFile:          AuditFile,
+		AuditActor:         AuditActor,
+		KeySource:          KeySource,
+		EncryptionKey:      EncryptionKey,
+		Passphrase:         Passphrase,
+		PreviousKeys:       slices.Clone(PreviousKeys),
+		Identity:           Identity,
+		BackendSettings:    maps.Clone(BackendSettings),
+	}
+}
+
+// Restore resets the settings to the snapshot
+func (s Snapshot) Restore() {
+	DataPath = s.DataPath
+	DataFile = s.DataFile
+	StorageType = s.StorageType
+	StorageSchema = s.StorageSchema
+	RecordsTable = s.RecordsTable
+	RecordsPlaintext = s.RecordsPlaintext
+	SettingsFile = s.SettingsFile
+	StorageTimeout = s.StorageTimeout
+	StorageCompression = s.StorageCompression
+	StorageCache = s.StorageCache
+	CachePath = s.CachePath
+	SyncInterval = s.SyncInterval
+	BackupPrefix = s.BackupPrefix
+	BackupInterval = s.BackupInterval
+	BackupRecent = s.BackupRecent
+	BackupHourly = s.BackupHourly
+	BackupDaily = s.BackupDaily
+	AuditLog = s.AuditLog
+	AuditFile = s.AuditFile
+	AuditActor = s.AuditActor
+	KeySource = s.KeySource
+	EncryptionKey = s.EncryptionKey
+	Passphrase = s.Passphrase
+	PreviousKeys = slices.Clone(s.PreviousKeys)
+	Identity = s.Identity
+	BackendSettings = maps.Clone(s.BackendSettings)
+}
@@ -0,0 +1,429 @@
+package models
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"sync"
+	"time"
+
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// ErrAuditTampered is returned by VerifyAuditLog when an entry was changed,
+// removed or reordered after it was written
+var ErrAuditTampered = errors.New("audit log has been tampered with")
+
+// ErrAuditUnverifiable is returned by VerifyAuditLog when an entry is
+// authenticated with a key that is not configured, e.g. one rotated out
+var ErrAuditUnverifiable = errors.New("audit log cannot be verified with the configured keys")
+
+// auditLogVersion is the format version of the stored audit log. Version 2
+// authenticates entries with a key derived from the data key.
+const auditLogVersion = 2
+
+// auditKeyLabel derives the audit log key from the data key
+const auditKeyLabel = "todo audit log"
+
+// auditKeyer derives the audit log key from the encryptor of the storage
+// opened by InitStorage; nil without encryption
+var auditKeyer storage.KeyDeriver
+
+// Audit actions recorded by Model.Update
+const (
+	AuditCreate  = "create"
+	AuditEdit    = "edit"
+	AuditToggle  = "toggle"
+	AuditDelete  = "delete"
+	AuditDue     = "due"
+	AuditRestore = "restore"
+)
+
+// AuditEntry is one change in the audit log. Each entry commits to the
+// previous one through Prev, so editing, removing or reordering entries
+// breaks the chain from that point on.
+//
+// With encryption, Hash is an HMAC keyed from the data key, so rewriting
+// the chain needs the key. Without it Hash is a plain SHA-256, which anyone
+// who can write the log can recompute.
+type AuditEntry struct {
+	Seq    int64     `json:"seq"`
+	Time   time.Time `json:"time"`
+	Actor  string    `json:"actor"`
+	Action string    `json:"action"`
+	TaskID int64     `json:"taskId,omitempty"`
+	Title  string    `json:"title,omitempty"`
+	From   string    `json:"from,omitempty"`
+	To     string    `json:"to,omitempty"`
+	Prev   string    `json:"prev"`
+	Key    string    `json:"key,omitempty"` // fingerprint of the HMAC key; empty for SHA-256
+	Hash   string    `json:"hash"`
+}
+
+// auditLog is the stored document. It is rewritten on every append, which
+// keeps it a single encrypted value like the data file.
+type auditLog struct {
+	Version int          `json:"version"`
+	Entries []AuditEntry `json:"entries"`
+}
+
+// hash returns the entry's hash: HMAC-SHA256 with key of its JSON encoding
+// without Hash, or SHA-256 when key is nil
+func (e AuditEntry) hash(key []byte) string {
+	e.Hash = ""
+	data, _ := json.Marshal(e)
+	if key == nil {
+		sum := sha256.Sum256(data)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// keyDeriver returns e as a KeyDeriver, or nil when it is not one
+func keyDeriver(e storage.Encryptor) storage.KeyDeriver {
+	keyer, _ := e.(storage.KeyDeriver)
+	return keyer
+}
+
+// auditKeys returns the audit log keys derived from every data key of
+// keyer, the current one first, or nil without encryption
+func auditKeys(keyer storage.KeyDeriver) [][]byte {
+	if keyer == nil {
+		return nil
+	}
+	return keyer.DeriveKeys(auditKeyLabel)
+}
+
+// auditKey returns the key new entries are authenticated with, or nil
+func auditKey(keyer storage.KeyDeriver) []byte {
+	if keys := auditKeys(keyer); len(keys) > 0 {
+		return keys[0]
+	}
+	return nil
+}
+
+// chainAudit links entries onto the end of chain, numbering them and
+// hashing them with key (see AuditEntry.hash)
+func chainAudit(key []byte, chain []AuditEntry, entries ...AuditEntry) []AuditEntry {
+	var seq int64
+	prev := ""
+	if len(chain) > 0 {
+		seq = chain[len(chain)-1].Seq
+		prev = chain[len(chain)-1].Hash
+	}
+	for _, e := range entries {
+		seq++
+		e.Seq = seq
+		e.Prev = prev
+		e.Key = ""
+		if key != nil {
+			e.Key = storage.Fingerprint(key)
+		}
+		e.Hash = e.hash(key)
+		prev = e.Hash
+		chain = append(chain, e)
+	}
+	return chain
+}
+
+// VerifyAuditLog checks that every entry is numbered in order, links to the
+// previous entry and matches its hash, using the keys of the storage opened
+// by InitStorage. It cannot tell whether the newest entries were dropped;
+// compare the head hash with an earlier one for that.
+func VerifyAuditLog(entries []AuditEntry) error {
+	return verifyAuditChain(entries, auditKeys(auditKeyer))
+}
+
+func verifyAuditChain(entries []AuditEntry, keys [][]byte) error {
+	prev := ""
+	keyed := false
+	for i, e := range entries {
+		var key []byte
+		if e.Key != "" {
+			if key = findAuditKey(keys, e.Key); key == nil {
+				return fmt.Errorf("%w: entry %d is authenticated with key %s", ErrAuditUnverifiable, e.Seq, e.Key)
+			}
+			keyed = true
+		} else if keyed {
+			// Entries before encryption was enabled are unkeyed, never after
+			return fmt.Errorf("%w: entry %d is not authenticated", ErrAuditTampered, e.Seq)
+		}
+
+		switch {
+		case e.Seq != int64(i+1):
+			return fmt.Errorf("%w: entry %d has sequence number %d", ErrAuditTampered, i+1, e.Seq)
+		case e.Prev != prev:
+			return fmt.Errorf("%w: entry %d does not follow entry %d", ErrAuditTampered, e.Seq, e.Seq-1)
+		case !hmac.Equal([]byte(e.Hash), []byte(e.hash(key))):
+			return fmt.Errorf("%w: entry %d was modified", ErrAuditTampered, e.Seq)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// findAuditKey returns the key in keys with fingerprint, or nil
+func findAuditKey(keys [][]byte, fingerprint string) []byte {
+	for _, key := range keys {
+		if storage.Fingerprint(key) == fingerprint {
+			return key
+		}
+	}
+	return nil
+}
+
+// ReadAuditLog returns the stored audit log, oldest entry first
+func ReadAuditLog() ([]AuditEntry, error) {
+	if storageManager == nil {
+		return nil, errors.New("storage is not initialized")
+	}
+	return readAuditLog(storageManager, config.AuditFile)
+}
+
+func readAuditLog(sm *storage.StorageManager, file string) ([]AuditEntry, error) {
+	exists, err := sm.Exists(file)
+	if err != nil || !exists {
+		return nil, err
+	}
+	raw, err := sm.Load(file)
+	if err != nil {
+		return nil, err
+	}
+	return decodeAuditLog(raw)
+}
+
+// CheckAuditLog verifies the audit log stored under file in sm with the
+// keys of sm; a missing log passes. Rotation and migration check it before
+// copying anything, so a tampered log is never re-signed by RechainAuditLog.
+func CheckAuditLog(sm *storage.StorageManager, file string) error {
+	entries, err := readAuditLog(sm, file)
+	if err != nil {
+		return err
+	}
+	if err := verifyAuditChain(entries, auditKeys(keyDeriver(sm.Encryptor()))); err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// RechainAuditLog re-signs the audit log stored under file in dst with the
+// key of dst, after verifying it with the keys of from or dst. Once data is
+// re-encrypted for a new key, entries signed with the old one could not be
+// verified any more.
+func RechainAuditLog(from storage.Encryptor, dst *storage.StorageManager, file string) error {
+	exists, err := dst.Exists(file)
+	if err != nil || !exists {
+		return err
+	}
+	return dst.Update(file, func(current []byte) ([]byte, error) {
+		entries, err := decodeAuditLog(current)
+		if err != nil {
+			return nil, err
+		}
+		// Derived after the read, which settles a passphrase key's salt
+		keyer := keyDeriver(dst.Encryptor())
+		keys := append(auditKeys(keyDeriver(from)), auditKeys(keyer)...)
+		if err := verifyAuditChain(entries, keys); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		return encodeAuditLog(chainAudit(auditKey(keyer), nil, entries...))
+	})
+}
+
+func decodeAuditLog(raw []byte) ([]AuditEntry, error) {
+	var stored auditLog
+	if err := json.Unmarshal(raw, &stored); err != nil {
+		return nil, fmt.Errorf("invalid audit log: %w", err)
+	}
+	if stored.Version > auditLogVersion {
+		return nil, fmt.Errorf("%w: audit log version %d, this build supports up to %d", ErrNewerSchema, stored.Version, auditLogVersion)
+	}
+	return stored.Entries, nil
+}
+
+func encodeAuditLog(entries []AuditEntry) ([]byte, error) {
+	return json.MarshalIndent(auditLog{Version: auditLogVersion, Entries: entries}, "", "  ")
+}
+
+// appendAudit chains entries onto the log stored under file. The log is
+// read back first and, on backends with conditional writes, written only
+// if no other device appended in between, so their entries are kept.
+func appendAudit(sm *storage.StorageManager, keyer storage.KeyDeriver, file string, entries ...AuditEntry) error {
+	if sm == nil || len(entries) == 0 {
+		return nil
+	}
+	return sm.Update(file, func(current []byte) ([]byte, error) {
+		var stored []AuditEntry
+		if current != nil {
+			var err error
+			if stored, err = decodeAuditLog(current); err != nil {
+				return nil, err
+			}
+		}
+		// Derived after the read, which settles a passphrase key's salt
+		return encodeAuditLog(chainAudit(auditKey(keyer), stored, entries...))
+	})
+}
+
+// mergeAuditData merges two copies of the audit log that were appended to
+// independently: entries only the local copy has are chained onto the
+// remote copy with key, so entries other devices already have keep their
+// hashes
+func mergeAuditData(key, local, remote []byte) ([]byte, error) {
+	localEntries, err := decodeAuditLog(local)
+	if err != nil {
+		return nil, err
+	}
+	remoteEntries, err := decodeAuditLog(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	common := 0
+	for common < len(localEntries) && common < len(remoteEntries) &&
+		localEntries[common].Hash == remoteEntries[common].Hash {
+		common++
+	}
+	return encodeAuditLog(chainAudit(key, remoteEntries, localEntries[common:]...))
+}
+
+// auditActor names who makes the changes: AUDIT_ACTOR, or user@host
+func auditActor() string {
+	if config.AuditActor != "" {
+		return config.AuditActor
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+	return name
+}
+
+// auditWriter appends entries to the stored log in the background, so a
+// change does not wait for the log to be read and rewritten. Entries queued
+// while a write runs go out together in the next one; entries that fail are
+// kept and retried with the next change or on flush.
+type auditWriter struct {
+	mu      sync.Mutex
+	pending []AuditEntry
+	running bool
+	done    chan struct{} // closed when the running writer stops
+	err     error         // of the last write
+}
+
+var auditQueue auditWriter
+
+func (w *auditWriter) add(entry AuditEntry) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, entry)
+	w.start()
+}
+
+// start runs a writer for the pending entries unless one is running. The
+// storage is captured here, so a writer never sees it change. The caller
+// holds mu.
+func (w *auditWriter) start() {
+	if w.running || len(w.pending) == 0 {
+		return
+	}
+	w.running = true
+	w.done = make(chan struct{})
+	go w.run(storageManager, auditKeyer, config.AuditFile, w.done)
+}
+
+func (w *auditWriter) run(sm *storage.StorageManager, keyer storage.KeyDeriver, file string, done chan struct{}) {
+	defer close(done)
+	for {
+		w.mu.Lock()
+		batch := w.pending
+		w.pending = nil
+		if len(batch) == 0 {
+			w.running = false
+			w.mu.Unlock()
+			return
+		}
+		w.mu.Unlock()
+
+		err := appendAudit(sm, keyer, file, batch...)
+
+		w.mu.Lock()
+		w.err = err
+		if err != nil {
+			w.pending = append(batch, w.pending...)
+			w.running = false
+			w.mu.Unlock()
+			log.Printf("Failed to write audit log: %v", err)
+			return
+		}
+		w.mu.Unlock()
+	}
+}
+
+// flush waits for the running writer, then writes the entries still
+// pending, e.g. after a failed write, and returns the last write's error
+func (w *auditWriter) flush() error {
+	w.mu.Lock()
+	if w.running {
+		done := w.done
+		w.mu.Unlock()
+		<-done
+		w.mu.Lock()
+	}
+	if len(w.pending) == 0 {
+		w.mu.Unlock()
+		return nil
+	}
+	w.start()
+	done := w.done
+	w.mu.Unlock()
+	<-done
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+// audit queues a record of a change to task for the audit log
+func (m *Model) audit(action string, task Task, from, to string) {
+	if !config.AuditLog {
+		return
+	}
+	auditQueue.add(AuditEntry{
+		Time:   time.Now().UTC(),
+		Actor:  auditActor(),
+		Action: action,
+		TaskID: task.ID,
+		Title:  task.Title,
+		From:   from,
+		To:     to,
+	})
+}
+
+// formatDue formats a due time for the audit log; zero means no timer
+func formatDue(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// formatDone describes a task's done state for the audit log
+func formatDone(done bool) string {
+	if done {
+		return "done"
+	}
+	return "open"
+}
@@ -0,0 +1,267 @@
+package models
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+func testAuditChain(actions ...string) []AuditEntry {
+	var entries []AuditEntry
+	for i, action := range actions {
+		entries = append(entries, AuditEntry{
+			Time:   time.Date(2025, 3, 1, 12, i, 0, 0, time.UTC),
+			Actor:  "alice@laptop",
+			Action: action,
+			TaskID: int64(i + 1),
+			Title:  "task",
+		})
+	}
+	return chainAudit(nil, nil, entries...)
+}
+
+func TestVerifyAuditLog(t *testing.T) {
+	if err := VerifyAuditLog(testAuditChain(AuditCreate, AuditEdit, AuditToggle)); err != nil {
+		t.Fatalf("expected an intact chain, got %v", err)
+	}
+
+	tests := map[string]func([]AuditEntry) []AuditEntry{
+		"modified": func(e []AuditEntry) []AuditEntry { e[1].Actor = "mallory"; return e },
+		"removed":  func(e []AuditEntry) []AuditEntry { return append(e[:1], e[2:]...) },
+		"reordered": func(e []AuditEntry) []AuditEntry {
+			e[1], e[2] = e[2], e[1]
+			return e
+		},
+		"rehashed": func(e []AuditEntry) []AuditEntry {
+			// Recomputing the hash of an edited entry still breaks the next link
+			e[1].Title = "other"
+			e[1].Hash = e[1].hash(nil)
+			return e
+		},
+	}
+	for name, tamper := range tests {
+		entries := tamper(testAuditChain(AuditCreate, AuditEdit, AuditToggle))
+		if err := VerifyAuditLog(entries); !errors.Is(err, ErrAuditTampered) {
+			t.Errorf("%s: expected ErrAuditTampered, got %v", name, err)
+		}
+	}
+}
+
+func TestVerifyAuditLog_Keyed(t *testing.T) {
+	encryptor, _ := storage.NewAESEncryptor(make([]byte, 32))
+	keys := auditKeys(encryptor)
+	chain := func() []AuditEntry {
+		legacy := testAuditChain(AuditCreate)
+		return chainAudit(keys[0], legacy, AuditEntry{Action: AuditEdit}, AuditEntry{Action: AuditToggle})
+	}
+
+	if err := verifyAuditChain(chain(), keys); err != nil {
+		t.Fatalf("expected an intact chain after the unkeyed entry, got %v", err)
+	}
+	if err := verifyAuditChain(chain(), nil); !errors.Is(err, ErrAuditUnverifiable) {
+		t.Errorf("expected ErrAuditUnverifiable without the key, got %v", err)
+	}
+
+	tests := map[string]func([]AuditEntry) []AuditEntry{
+		"rehashed without the key": func(e []AuditEntry) []AuditEntry {
+			e[1].Title = "other"
+			e[1].Hash = e[1].hash(nil)
+			return e
+		},
+		"rechained without the key": func(e []AuditEntry) []AuditEntry {
+			return chainAudit(nil, e[:2], AuditEntry{Action: AuditDelete})
+		},
+	}
+	for name, tamper := range tests {
+		if err := verifyAuditChain(tamper(chain()), keys); !errors.Is(err, ErrAuditTampered) {
+			t.Errorf("%s: expected ErrAuditTampered, got %v", name, err)
+		}
+	}
+}
+
+func TestMergeAuditData(t *testing.T) {
+	shared := testAuditChain(AuditCreate)
+	local := chainAudit(nil, append([]AuditEntry(nil), shared...), AuditEntry{Action: AuditEdit, Actor: "alice@laptop"})
+	remote := chainAudit(nil, append([]AuditEntry(nil), shared...), AuditEntry{Action: AuditToggle, Actor: "bob@desktop"})
+
+	localData, _ := encodeAuditLog(local)
+	remoteData, _ := encodeAuditLog(remote)
+	merged, err := mergeAuditData(nil, localData, remoteData)
+	if err != nil {
+		t.Fatalf("mergeAuditData failed: %v", err)
+	}
+	entries, _ := decodeAuditLog(merged)
+
+	if err := VerifyAuditLog(entries); err != nil {
+		t.Fatalf("merged chain is broken: %v", err)
+	}
+	if len(entries) != 3 || entries[1].Hash != remote[1].Hash || entries[2].Action != AuditEdit {
+		t.Errorf("expected the remote chain followed by the local entry, got %+v", entries)
+	}
+}
+
+func TestModelUpdate_RecordsAudit(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.AuditLog = true
+	config.AuditFile = "audit.json"
+	config.AuditActor = "alice@laptop"
+
+	backend, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	t.Cleanup(func() { storageManager, store = nil, nil })
+	storageManager = storage.NewStorageManager(backend, nil)
+	store = newBlobStore(storageManager, "todos.json")
+
+	m := &Model{Tasks: []Task{{ID: 1, Title: "write report"}}, TextInput: textinput.New()}
+	m.Update(tea.KeyMsg{Type: tea.KeySpace, Runes: []rune{' '}})
+
+	m.Update(tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune{'e'}})
+	m.TextInput.SetValue("write quarterly report")
+	m.Update(tea.KeyMsg{Type: tea.KeyEnter})
+
+	if err := m.Flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	entries, err := ReadAuditLog()
+	if err != nil {
+		t.Fatalf("ReadAuditLog failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", entries)
+	}
+	if e := entries[0]; e.Action != AuditToggle || e.TaskID != 1 || e.From != "open" || e.To != "done" || e.Actor != "alice@laptop" {
+		t.Errorf("unexpected toggle entry: %+v", e)
+	}
+	if e := entries[1]; e.Action != AuditEdit || e.From != "write report" || e.To != "write quarterly report" {
+		t.Errorf("unexpected edit entry: %+v", e)
+	}
+	if err := VerifyAuditLog(entries); err != nil {
+		t.Errorf("expected an intact chain, got %v", err)
+	}
+}
+
+func TestAuditWriter_KeepsFailedEntries(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.AuditLog = true
+	config.AuditFile = "audit.json"
+
+	dir := t.TempDir()
+	missing, _ := storage.NewFileStorage(filepath.Join(dir, "missing"))
+	os.Remove(filepath.Join(dir, "missing"))
+	t.Cleanup(func() { storageManager = nil })
+	storageManager = storage.NewStorageManager(missing, nil)
+
+	m := &Model{}
+	m.audit(AuditCreate, Task{ID: 1, Title: "first"}, "", "")
+	if err := auditQueue.flush(); err == nil {
+		t.Fatal("expected the write to the removed directory to fail")
+	}
+
+	backend, _ := storage.NewFileStorage(filepath.Join(dir, "data"))
+	storageManager = storage.NewStorageManager(backend, nil)
+	m.audit(AuditDelete, Task{ID: 1, Title: "first"}, "", "")
+	if err := auditQueue.flush(); err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+
+	entries, _ := ReadAuditLog()
+	if len(entries) != 2 || entries[0].Action != AuditCreate || entries[1].Action != AuditDelete {
+		t.Errorf("expected the failed entry to be written first, got %+v", entries)
+	}
+}
+
+func TestRotateKey_RechainsAuditLog(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.DataPath = t.TempDir()
+	config.StorageSchema = "blob"
+	config.AuditFile = "audit.json"
+
+	oldKey := strings.Repeat("11", 32)
+	newKey := strings.Repeat("22", 32)
+	backend, _ := storage.NewFileStorage(config.DataPath)
+	oldEnc, _ := newEncryptor(oldKey, "")
+	newEnc, _ := newEncryptor(newKey, "")
+
+	old := storage.NewStorageManager(backend, oldEnc)
+	if err := appendAudit(old, keyDeriver(oldEnc), config.AuditFile, AuditEntry{Action: AuditCreate}, AuditEntry{Action: AuditEdit}); err != nil {
+		t.Fatalf("appendAudit failed: %v", err)
+	}
+
+	if _, err := RotateKey("file", oldKey, newKey); err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+
+	// The old key is gone, so the log must verify with the new one alone
+	rotated := storage.NewStorageManager(backend, newEnc)
+	if err := CheckAuditLog(rotated, config.AuditFile); err != nil {
+		t.Errorf("expected the rotated log to verify with the new key, got %v", err)
+	}
+	entries, _ := readAuditLog(rotated, config.AuditFile)
+	if len(entries) != 2 || entries[1].Action != AuditEdit {
+		t.Errorf("expected the entries to be kept, got %+v", entries)
+	}
+}
+
+func TestRotateKey_RefusesTamperedAuditLog(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.DataPath = t.TempDir()
+	config.StorageSchema = "blob"
+	config.AuditFile = "audit.json"
+
+	oldKey := strings.Repeat("11", 32)
+	backend, _ := storage.NewFileStorage(config.DataPath)
+	oldEnc, _ := newEncryptor(oldKey, "")
+	old := storage.NewStorageManager(backend, oldEnc)
+
+	entries := chainAudit(auditKey(keyDeriver(oldEnc)), nil, AuditEntry{Action: AuditCreate}, AuditEntry{Action: AuditEdit})
+	entries[0].Actor = "mallory"
+	data, _ := encodeAuditLog(entries)
+	old.Save(config.AuditFile, data)
+	old.Save(config.DataFile, []byte("tasks"))
+
+	if _, err := RotateKey("file", oldKey, strings.Repeat("22", 32)); !errors.Is(err, ErrAuditTampered) {
+		t.Fatalf("expected ErrAuditTampered, got %v", err)
+	}
+	if got, err := old.Load(config.DataFile); err != nil || string(got) != "tasks" {
+		t.Errorf("expected the data to stay on the old key, got %q, %v", got, err)
+	}
+}
+
+func TestRechainAuditLog(t *testing.T) {
+	srcEnc, _ := storage.NewAESEncryptor(bytes.Repeat([]byte{1}, 32))
+	dstEnc, _ := storage.NewAESEncryptor(bytes.Repeat([]byte{2}, 32))
+	srcBackend, _ := storage.NewFileStorage(t.TempDir())
+	dstBackend, _ := storage.NewFileStorage(t.TempDir())
+	src := storage.NewStorageManager(srcBackend, srcEnc)
+	dst := storage.NewStorageManager(dstBackend, dstEnc)
+
+	appendAudit(src, srcEnc, "audit.json", AuditEntry{Action: AuditCreate})
+	if _, err := storage.Migrate(src, dst, storage.MigrateOptions{}); err != nil {
+		t.Fatalf("Migrate failed: %v", err)
+	}
+	if err := CheckAuditLog(dst, "audit.json"); !errors.Is(err, ErrAuditUnverifiable) {
+		t.Fatalf("expected the copied log to need re-signing, got %v", err)
+	}
+
+	if err := RechainAuditLog(srcEnc, dst, "audit.json"); err != nil {
+		t.Fatalf("RechainAuditLog failed: %v", err)
+	}
+	if err := CheckAuditLog(dst, "audit.json"); err != nil {
+		t.Errorf("expected the log to verify with the destination key, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"errors"
+
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// ErrBackupsUnavailable is returned when backups are disabled or the
+// storage schema keeps tasks outside the data file
+var ErrBackupsUnavailable = errors.New("backups are not available (disabled or using the records schema)")
+
+// ListBackups returns the snapshots of the data file, newest first
+func ListBackups() ([]storage.Backup, error) {
+	if !backupsAvailable() {
+		return nil, ErrBackupsUnavailable
+	}
+	return storageManager.Backups(config.DataFile)
+}
+
+// RestoreBackup replaces the data file with a snapshot and returns the
+// restored data. Snapshots from a newer schema are refused.
+func RestoreBackup(id string) (AppData, error) {
+	if !backupsAvailable() {
+		return AppData{}, ErrBackupsUnavailable
+	}
+
+	raw, err := storageManager.LoadBackup(config.DataFile, id)
+	if err != nil {
+		return AppData{}, err
+	}
+	if _, _, err := migrateAppData(raw); err != nil {
+		return AppData{}, err
+	}
+
+	if err := storageManager.RestoreBackup(config.DataFile, id); err != nil && !errors.Is(err, storage.ErrBackupFailed) {
+		return AppData{}, err
+	}
+	return store.Load()
+}
+
+func backupsAvailable() bool {
+	if _, ok := store.(*blobStore); !ok {
+		return false
+	}
+	return config.BackupInterval > 0
+}
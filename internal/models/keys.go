@@ -0,0 +1,141 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// KeyFingerprint returns the fingerprint of the configured hex key, or ""
+// when the key is derived from a passphrase or encryption is disabled
+func KeyFingerprint() string {
+	if config.EncryptionKey == "" {
+		return ""
+	}
+	key, err := decodeKey(config.EncryptionKey)
+	if err != nil {
+		return ""
+	}
+	defer clear(key)
+	return storage.Fingerprint(key)
+}
+
+// RotateKey re-encrypts all stored data of storageType from oldKey to
+// newKey (both hex) and verifies it can be read with newKey alone. Data
+// already encrypted with newKey, e.g. by an interrupted rotation, is fine.
+//
+// With the offline cache enabled, pending changes are pushed first and the
+// cache is dropped afterwards, so it is rebuilt with the new key.
+func RotateKey(storageType, oldKey, newKey string) (*storage.MigrateResult, error) {
+	rotating, err := newEncryptor(newKey, "", oldKey)
+	if err != nil {
+		return nil, err
+	}
+	rotated, err := newEncryptor(newKey, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return reencrypt(storageType, rotating, rotated)
+}
+
+// reencrypt rewrites the data keys of storageType with rotated, reading
+// them with rotating, and verifies they can be read with rotated alone
+func reencrypt(storageType string, rotating, rotated storage.Encryptor) (*storage.MigrateResult, error) {
+	cached := false
+	if backend, ok := storage.LookupBackend(storageType); ok && !backend.Local && config.StorageCache {
+		if err := flushCache(storageType); err != nil {
+			return nil, err
+		}
+		cached = true
+	}
+
+	backend, err := newBackend(storageType)
+	if err != nil {
+		return nil, err
+	}
+	defer backend.Close()
+
+	src := storage.NewStorageManager(backend, rotating)
+	dst := storage.NewStorageManager(backend, rotated)
+	src.SetTimeout(config.StorageTimeout)
+	dst.SetTimeout(config.StorageTimeout)
+
+	if err := CheckAuditLog(src, config.AuditFile); err != nil {
+		return nil, fmt.Errorf("not rotating, the audit log does not verify: %w", err)
+	}
+
+	// Only app data: other files in a shared directory, e.g. a SQLite
+	// database, are not encrypted with the key
+	result, err := storage.Migrate(src, dst, storage.MigrateOptions{Include: DataKeyFilter()})
+	if err != nil {
+		return result, err
+	}
+
+	if config.StorageSchema == "records" {
+		if err := rotateRecords(backend, rotating, rotated); err != nil {
+			return result, err
+		}
+	}
+
+	if err := RechainAuditLog(rotating, dst, config.AuditFile); err != nil {
+		return result, fmt.Errorf("re-encrypted, but failed to re-sign the audit log with the new key: %w", err)
+	}
+
+	if cached {
+		if err := os.RemoveAll(cacheDir(storageType)); err != nil {
+			return result, fmt.Errorf("rotated, but failed to clear the offline cache: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// flushCache pushes changes queued in the offline cache to the remote
+func flushCache(storageType string) error {
+	local, err := storage.NewFileStorage(cacheDir(storageType))
+	if err != nil {
+		return err
+	}
+	cached, err := storage.NewCachedStorage(local, func() (storage.Storage, error) {
+		return newBackend(storageType)
+	})
+	if err != nil {
+		local.Close()
+		return err
+	}
+
+	syncErr := cached.Sync()
+	pending := cached.Status().Pending
+	if err := errors.Join(syncErr, cached.Close()); err != nil {
+		return fmt.Errorf("failed to sync the offline cache: %w", err)
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d changes in the offline cache are not synced yet", pending)
+	}
+	return nil
+}
+
+// rotateRecords re-encrypts the task titles of the records schema
+func rotateRecords(backend storage.Storage, rotating, rotated storage.Encryptor) error {
+	provider, ok := backend.(storage.RecordProvider)
+	if !ok {
+		return nil
+	}
+	records, err := provider.Records(config.RecordsTable)
+	if err != nil {
+		return err
+	}
+
+	src := storage.NewRecordManager(records, rotating)
+	dst := storage.NewRecordManager(records, rotated)
+	src.SetTimeout(config.StorageTimeout)
+	dst.SetTimeout(config.StorageTimeout)
+	src.SetTitleEncryption(!config.RecordsPlaintext)
+	dst.SetTitleEncryption(!config.RecordsPlaintext)
+
+	_, err = storage.CopyRecords(src, dst)
+	return err
+}
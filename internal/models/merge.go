@@ -0,0 +1,287 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// tombstoneTTL is how long deletions are remembered. A copy that has been
+// offline for longer may bring deleted tasks back.
+const tombstoneTTL = 90 * 24 * time.Hour
+
+// MergeAppData combines two copies of the data edited independently since
+// base, their last common version (nil when unknown).
+//
+// With a base, each task is merged field by field: a field changed on one
+// side only keeps that change, and a field changed on both sides takes the
+// value from the copy with the newer UpdatedAt. Without a base, the newer
+// copy of each task wins. A task deleted on one side stays deleted unless
+// the other side edited it after the deletion. Settings merge the same way.
+func MergeAppData(base *AppData, local, remote AppData) AppData {
+	merged := AppData{SchemaVersion: CurrentSchemaVersion}
+
+	var baseTasks map[int64]Task
+	if base != nil {
+		baseTasks = tasksByID(base.Tasks)
+	}
+	localTasks := tasksByID(local.Tasks)
+	remoteTasks := tasksByID(remote.Tasks)
+	localDeleted := tombstonesByID(local.Deleted)
+	remoteDeleted := tombstonesByID(remote.Deleted)
+
+	deleted := make(map[int64]time.Time)
+	for id, at := range localDeleted {
+		deleted[id] = at
+	}
+	for id, at := range remoteDeleted {
+		if at.After(deleted[id]) {
+			deleted[id] = at
+		}
+	}
+
+	// Local order first, then tasks only the remote has
+	var order []int64
+	for _, t := range local.Tasks {
+		order = append(order, t.ID)
+	}
+	for _, t := range remote.Tasks {
+		if _, ok := localTasks[t.ID]; !ok {
+			order = append(order, t.ID)
+		}
+	}
+
+	for _, id := range order {
+		l, inLocal := localTasks[id]
+		r, inRemote := remoteTasks[id]
+
+		var task Task
+		switch {
+		case inLocal && inRemote:
+			var b *Task
+			if t, ok := baseTasks[id]; ok {
+				b = &t
+			}
+			task = mergeTask(b, l, r)
+		case inLocal:
+			task = l
+			if deletedAt, ok := remoteDeleted[id]; ok && !task.UpdatedAt.After(deletedAt) {
+				continue
+			}
+		default:
+			task = r
+			if deletedAt, ok := localDeleted[id]; ok && !task.UpdatedAt.After(deletedAt) {
+				continue
+			}
+		}
+
+		// Edited after a deletion: the task survives
+		delete(deleted, id)
+		merged.Tasks = append(merged.Tasks, task)
+	}
+
+	for id, at := range deleted {
+		merged.Deleted = append(merged.Deleted, Tombstone{ID: id, DeletedAt: at})
+	}
+	sortTombstones(merged.Deleted)
+
+	mergeSettings(&merged, base, local, remote)
+	return merged
+}
+
+// MergeData is MergeAppData on serialized documents, for sync layers that
+// only see the stored bytes. base may be nil.
+func MergeData(base, local, remote []byte) ([]byte, error) {
+	localData, err := decodeAppData(local)
+	if err != nil {
+		return nil, err
+	}
+	remoteData, err := decodeAppData(remote)
+	if err != nil {
+		return nil, err
+	}
+
+	var baseData *AppData
+	if base != nil {
+		// An unreadable base only loses field-level precision
+		if decoded, err := decodeAppData(base); err == nil {
+			baseData = &decoded
+		}
+	}
+
+	merged := MergeAppData(baseData, localData, remoteData)
+	return json.MarshalIndent(merged, "", "  ")
+}
+
+// newConflictResolver merges sync conflicts on the data file and the audit
+// log. Other keys are left to the storage's default handling.
+func newConflictResolver(encryptor storage.Encryptor, dataKey, auditFile string) storage.ConflictFunc {
+	return func(key string, base, local, remote []byte) ([]byte, error) {
+		var merge func(base, local, remote []byte) ([]byte, error)
+		switch key {
+		case dataKey:
+			merge = MergeData
+		case auditFile:
+			merge = func(_, local, remote []byte) ([]byte, error) {
+				return mergeAuditData(auditKey(keyDeriver(encryptor)), local, remote)
+			}
+		default:
+			return nil, storage.ErrConflictUnresolved
+		}
+
+		decrypt := func(data []byte) ([]byte, error) {
+			if encryptor == nil || data == nil {
+				return data, nil
+			}
+			return storage.DecryptValue(encryptor, key, data)
+		}
+
+		base, err := decrypt(base)
+		if err != nil {
+			base = nil
+		}
+		if local, err = decrypt(local); err != nil {
+			return nil, err
+		}
+		if remote, err = decrypt(remote); err != nil {
+			return nil, err
+		}
+
+		merged, err := merge(base, local, remote)
+		if err != nil {
+			return nil, err
+		}
+		if encryptor == nil {
+			return merged, nil
+		}
+		return storage.EncryptValue(encryptor, key, merged)
+	}
+}
+
+// mergeTask merges two copies of a task; base is nil when unknown
+func mergeTask(base *Task, local, remote Task) Task {
+	newer, older := local, remote
+	if remote.UpdatedAt.After(local.UpdatedAt) {
+		newer, older = remote, local
+	}
+	if base == nil {
+		return newer
+	}
+
+	merged := newer
+	if older.Title != base.Title && newer.Title == base.Title {
+		merged.Title = older.Title
+	}
+	if older.Done != base.Done && newer.Done == base.Done {
+		merged.Done = older.Done
+	}
+	// The due time and its notification flag change together
+	if !older.DueAt.Equal(base.DueAt) && newer.DueAt.Equal(base.DueAt) {
+		merged.DueAt = older.DueAt
+		merged.Notified = older.Notified
+	} else if older.Notified != base.Notified && newer.Notified == base.Notified && older.DueAt.Equal(newer.DueAt) {
+		merged.Notified = older.Notified
+	}
+	return merged
+}
+
+func mergeSettings(merged *AppData, base *AppData, local, remote AppData) {
+	newer, older := local, remote
+	if remote.SettingsUpdatedAt.After(local.SettingsUpdatedAt) {
+		newer, older = remote, local
+	}
+
+	merged.ThemeIndex = newer.ThemeIndex
+	merged.SortMode = newer.SortMode
+	merged.SettingsUpdatedAt = newer.SettingsUpdatedAt
+	if base == nil {
+		return
+	}
+	if older.ThemeIndex != base.ThemeIndex && newer.ThemeIndex == base.ThemeIndex {
+		merged.ThemeIndex = older.ThemeIndex
+	}
+	if older.SortMode != base.SortMode && newer.SortMode == base.SortMode {
+		merged.SortMode = older.SortMode
+	}
+}
+
+// trackChanges stamps UpdatedAt on tasks and settings that differ from
+// prev, the last loaded or saved copy, and records tombstones for tasks
+// removed since. prev is nil when nothing was loaded.
+func trackChanges(prev *AppData, data AppData, now time.Time) AppData {
+	if prev == nil {
+		prev = &AppData{}
+		data.SettingsUpdatedAt = now
+	} else if data.ThemeIndex != prev.ThemeIndex || data.SortMode != prev.SortMode {
+		data.SettingsUpdatedAt = now
+	} else {
+		data.SettingsUpdatedAt = prev.SettingsUpdatedAt
+	}
+
+	prevTasks := tasksByID(prev.Tasks)
+	deleted := tombstonesByID(prev.Deleted)
+
+	tasks := make([]Task, len(data.Tasks))
+	current := make(map[int64]bool, len(data.Tasks))
+	for i, task := range data.Tasks {
+		if p, ok := prevTasks[task.ID]; ok && sameRecord(p, task) {
+			task.UpdatedAt = p.UpdatedAt
+		} else {
+			task.UpdatedAt = now
+		}
+		tasks[i] = task
+		current[task.ID] = true
+		delete(deleted, task.ID)
+	}
+	data.Tasks = tasks
+
+	for id := range prevTasks {
+		if !current[id] {
+			deleted[id] = now
+		}
+	}
+
+	data.Deleted = nil
+	for id, at := range deleted {
+		if now.Sub(at) < tombstoneTTL {
+			data.Deleted = append(data.Deleted, Tombstone{ID: id, DeletedAt: at})
+		}
+	}
+	sortTombstones(data.Deleted)
+	return data
+}
+
+func decodeAppData(raw []byte) (AppData, error) {
+	var data AppData
+	migrated, _, err := migrateAppData(raw)
+	if err != nil {
+		return data, err
+	}
+	if err := json.Unmarshal(migrated, &data); err != nil {
+		return data, fmt.Errorf("invalid data document: %w", err)
+	}
+	return data, nil
+}
+
+func tasksByID(tasks []Task) map[int64]Task {
+	byID := make(map[int64]Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID] = t
+	}
+	return byID
+}
+
+func tombstonesByID(tombstones []Tombstone) map[int64]time.Time {
+	byID := make(map[int64]time.Time, len(tombstones))
+	for _, t := range tombstones {
+		byID[t.ID] = t.DeletedAt
+	}
+	return byID
+}
+
+func sortTombstones(tombstones []Tombstone) {
+	sort.Slice(tombstones, func(i, j int) bool { return tombstones[i].ID < tombstones[j].ID })
+}
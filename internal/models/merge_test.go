@@ -0,0 +1,234 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+var (
+	t0 = time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	t1 = t0.Add(time.Hour)
+	t2 = t0.Add(2 * time.Hour)
+)
+
+func findTask(data AppData, id int64) (Task, bool) {
+	for _, t := range data.Tasks {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Task{}, false
+}
+
+func TestTrackChanges(t *testing.T) {
+	prev := &AppData{
+		ThemeIndex:        1,
+		SettingsUpdatedAt: t0,
+		Tasks: []Task{
+			{ID: 1, Title: "same", UpdatedAt: t0},
+			{ID: 2, Title: "old title", UpdatedAt: t0},
+			{ID: 3, Title: "removed", UpdatedAt: t0},
+		},
+	}
+	data := AppData{
+		ThemeIndex: 1,
+		Tasks: []Task{
+			{ID: 1, Title: "same"},
+			{ID: 2, Title: "new title"},
+			{ID: 4, Title: "added"},
+		},
+	}
+
+	got := trackChanges(prev, data, t1)
+
+	want := map[int64]time.Time{1: t0, 2: t1, 4: t1}
+	for id, at := range want {
+		task, ok := findTask(got, id)
+		if !ok || !task.UpdatedAt.Equal(at) {
+			t.Errorf("task %d: expected UpdatedAt %v, got %+v", id, at, task)
+		}
+	}
+	if len(got.Deleted) != 1 || got.Deleted[0].ID != 3 || !got.Deleted[0].DeletedAt.Equal(t1) {
+		t.Errorf("expected tombstone for task 3, got %+v", got.Deleted)
+	}
+	if !got.SettingsUpdatedAt.Equal(t0) {
+		t.Errorf("unchanged settings should keep their stamp, got %v", got.SettingsUpdatedAt)
+	}
+
+	data.SortMode = SortDoneFirst
+	if got := trackChanges(prev, data, t1); !got.SettingsUpdatedAt.Equal(t1) {
+		t.Errorf("changed settings should be stamped, got %v", got.SettingsUpdatedAt)
+	}
+}
+
+func TestTrackChanges_ExpiresTombstones(t *testing.T) {
+	prev := &AppData{Deleted: []Tombstone{{ID: 9, DeletedAt: t0}}}
+	got := trackChanges(prev, AppData{}, t0.Add(tombstoneTTL+time.Hour))
+	if len(got.Deleted) != 0 {
+		t.Errorf("expected expired tombstone to be dropped, got %+v", got.Deleted)
+	}
+}
+
+func TestMergeAppData_DifferentTasks(t *testing.T) {
+	base := &AppData{Tasks: []Task{
+		{ID: 1, Title: "a", UpdatedAt: t0},
+		{ID: 2, Title: "b", UpdatedAt: t0},
+	}}
+	local := AppData{Tasks: []Task{
+		{ID: 1, Title: "a edited", UpdatedAt: t1},
+		{ID: 2, Title: "b", UpdatedAt: t0},
+		{ID: 3, Title: "new local", UpdatedAt: t1},
+	}}
+	remote := AppData{Tasks: []Task{
+		{ID: 1, Title: "a", UpdatedAt: t0},
+		{ID: 2, Title: "b", Done: true, UpdatedAt: t2},
+		{ID: 4, Title: "new remote", UpdatedAt: t2},
+	}}
+
+	merged := MergeAppData(base, local, remote)
+
+	if len(merged.Tasks) != 4 {
+		t.Fatalf("expected 4 tasks, got %+v", merged.Tasks)
+	}
+	wantOrder := []int64{1, 2, 3, 4}
+	for i, id := range wantOrder {
+		if merged.Tasks[i].ID != id {
+			t.Errorf("position %d: expected task %d, got %d", i, id, merged.Tasks[i].ID)
+		}
+	}
+	if task, _ := findTask(merged, 1); task.Title != "a edited" {
+		t.Errorf("lost local edit: %+v", task)
+	}
+	if task, _ := findTask(merged, 2); !task.Done {
+		t.Errorf("lost remote edit: %+v", task)
+	}
+}
+
+func TestMergeAppData_FieldByField(t *testing.T) {
+	base := &AppData{Tasks: []Task{{ID: 1, Title: "title", UpdatedAt: t0}}}
+	local := AppData{Tasks: []Task{{ID: 1, Title: "local title", UpdatedAt: t1}}}
+	remote := AppData{Tasks: []Task{{ID: 1, Title: "title", Done: true, UpdatedAt: t2}}}
+
+	merged := MergeAppData(base, local, remote)
+	task, _ := findTask(merged, 1)
+	if task.Title != "local title" || !task.Done {
+		t.Errorf("expected both field changes, got %+v", task)
+	}
+
+	// Without a base the newer copy wins
+	merged = MergeAppData(nil, local, remote)
+	task, _ = findTask(merged, 1)
+	if task.Title != "title" || !task.Done {
+		t.Errorf("expected newer remote copy, got %+v", task)
+	}
+}
+
+func TestMergeAppData_SameFieldNewerWins(t *testing.T) {
+	base := &AppData{Tasks: []Task{{ID: 1, Title: "title", UpdatedAt: t0}}}
+	local := AppData{Tasks: []Task{{ID: 1, Title: "local", UpdatedAt: t2}}}
+	remote := AppData{Tasks: []Task{{ID: 1, Title: "remote", UpdatedAt: t1}}}
+
+	merged := MergeAppData(base, local, remote)
+	if task, _ := findTask(merged, 1); task.Title != "local" {
+		t.Errorf("expected newer local title, got %+v", task)
+	}
+}
+
+func TestMergeAppData_Deletions(t *testing.T) {
+	base := &AppData{Tasks: []Task{
+		{ID: 1, Title: "deleted", UpdatedAt: t0},
+		{ID: 2, Title: "deleted then edited", UpdatedAt: t0},
+	}}
+	local := AppData{
+		Deleted: []Tombstone{{ID: 1, DeletedAt: t1}, {ID: 2, DeletedAt: t1}},
+	}
+	remote := AppData{Tasks: []Task{
+		{ID: 1, Title: "deleted", UpdatedAt: t0},
+		{ID: 2, Title: "edited later", UpdatedAt: t2},
+	}}
+
+	merged := MergeAppData(base, local, remote)
+
+	if _, ok := findTask(merged, 1); ok {
+		t.Error("task deleted locally should stay deleted")
+	}
+	if task, ok := findTask(merged, 2); !ok || task.Title != "edited later" {
+		t.Errorf("task edited after the deletion should survive, got %+v", merged.Tasks)
+	}
+	if len(merged.Deleted) != 1 || merged.Deleted[0].ID != 1 {
+		t.Errorf("expected only tombstone 1 to remain, got %+v", merged.Deleted)
+	}
+}
+
+func TestMergeAppData_Settings(t *testing.T) {
+	base := &AppData{ThemeIndex: 0, SortMode: SortOff}
+	local := AppData{ThemeIndex: 3, SortMode: SortOff, SettingsUpdatedAt: t1}
+	remote := AppData{ThemeIndex: 0, SortMode: SortDoneFirst, SettingsUpdatedAt: t2}
+
+	merged := MergeAppData(base, local, remote)
+	if merged.ThemeIndex != 3 || merged.SortMode != SortDoneFirst {
+		t.Errorf("expected theme from local and sort from remote, got %+v", merged)
+	}
+}
+
+func TestMergeData(t *testing.T) {
+	local := []byte(`{"schemaVersion":1,"tasks":[{"id":1,"title":"local","updatedAt":"2025-03-01T10:00:00Z"}]}`)
+	remote := []byte(`{"schemaVersion":1,"tasks":[{"id":2,"title":"remote","updatedAt":"2025-03-01T10:00:00Z"}]}`)
+
+	raw, err := MergeData(nil, local, remote)
+	if err != nil {
+		t.Fatalf("MergeData failed: %v", err)
+	}
+	var merged AppData
+	if err := json.Unmarshal(raw, &merged); err != nil {
+		t.Fatalf("invalid merged document: %v", err)
+	}
+	if len(merged.Tasks) != 2 || merged.SchemaVersion != CurrentSchemaVersion {
+		t.Errorf("unexpected merge result: %+v", merged)
+	}
+
+	if _, err := MergeData(nil, []byte(`{"schemaVersion":99}`), remote); !errors.Is(err, ErrNewerSchema) {
+		t.Errorf("expected ErrNewerSchema, got %v", err)
+	}
+}
+
+func TestConflictResolver(t *testing.T) {
+	encryptor, err := storage.NewAESEncryptor(make([]byte, 32))
+	if err != nil {
+		t.Fatalf("NewAESEncryptor failed: %v", err)
+	}
+	encrypt := func(data AppData) []byte {
+		raw, _ := json.Marshal(data)
+		out, err := storage.EncryptValue(encryptor, "todos.json", raw)
+		if err != nil {
+			t.Fatalf("Encrypt failed: %v", err)
+		}
+		return out
+	}
+
+	resolve := newConflictResolver(encryptor, "todos.json", "audit.json")
+	local := encrypt(AppData{SchemaVersion: 1, Tasks: []Task{{ID: 1, Title: "local", UpdatedAt: t1}}})
+	remote := encrypt(AppData{SchemaVersion: 1, Tasks: []Task{{ID: 2, Title: "remote", UpdatedAt: t1}}})
+
+	out, err := resolve("todos.json", nil, local, remote)
+	if err != nil {
+		t.Fatalf("resolve failed: %v", err)
+	}
+	raw, err := storage.DecryptValue(encryptor, "todos.json", out)
+	if err != nil {
+		t.Fatalf("merged copy is not encrypted: %v", err)
+	}
+	var merged AppData
+	json.Unmarshal(raw, &merged)
+	if len(merged.Tasks) != 2 {
+		t.Errorf("expected both tasks, got %+v", merged.Tasks)
+	}
+
+	if _, err := resolve("backup.todos.json.1", nil, local, remote); !errors.Is(err, storage.ErrConflictUnresolved) {
+		t.Errorf("expected other keys to be left unresolved, got %v", err)
+	}
+}
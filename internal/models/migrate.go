@@ -0,0 +1,100 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CurrentSchemaVersion is the AppData schema version written by this build
+const CurrentSchemaVersion = 1
+
+// ErrNewerSchema is returned when stored data was written by a newer build
+var ErrNewerSchema = errors.New("data was written by a newer version of todo")
+
+// ErrInvalidDocument is returned when stored data is not a JSON document,
+// e.g. encrypted data from before envelopes read with encryption disabled
+var ErrInvalidDocument = errors.New("stored data is not a JSON document (encrypted?)")
+
+// ErrMigrationFailed is returned when stored data of an older schema could
+// not be upgraded or backed up first. It is left as it was.
+var ErrMigrationFailed = errors.New("stored data could not be migrated")
+
+// migration upgrades a raw AppData document by exactly one schema version
+type migration func(doc map[string]json.RawMessage) error
+
+// migrations[v] upgrades a document from version v to v+1
+var migrations = []migration{
+	migrateV0ToV1,
+}
+
+// migrateAppData applies every pending migration to a raw AppData document.
+// It returns the upgraded document and the version it was stored with.
+func migrateAppData(raw []byte) ([]byte, int, error) {
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, 0, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	version := 0
+	if v, ok := doc["schemaVersion"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, 0, fmt.Errorf("%w: invalid schemaVersion: %v", ErrInvalidDocument, err)
+		}
+	}
+
+	if version > CurrentSchemaVersion {
+		return nil, version, fmt.Errorf("%w: data is schema version %d, this build supports up to %d", ErrNewerSchema, version, CurrentSchemaVersion)
+	}
+	if version == CurrentSchemaVersion {
+		return raw, version, nil
+	}
+
+	for v := version; v < CurrentSchemaVersion; v++ {
+		if err := migrations[v](doc); err != nil {
+			return nil, version, fmt.Errorf("%w: from schema version %d: %v", ErrMigrationFailed, v, err)
+		}
+		doc["schemaVersion"], _ = json.Marshal(v + 1)
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, version, fmt.Errorf("%w: %v", ErrMigrationFailed, err)
+	}
+	return migrated, version, nil
+}
+
+// migrateV0ToV1 introduces schemaVersion and assigns IDs to tasks saved
+// before IDs existed.
+func migrateV0ToV1(doc map[string]json.RawMessage) error {
+	raw, ok := doc["tasks"]
+	if !ok {
+		return nil
+	}
+
+	var tasks []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &tasks); err != nil {
+		return err
+	}
+
+	now := time.Now().UnixNano()
+	for i, task := range tasks {
+		var id int64
+		if v, ok := task["id"]; ok {
+			if err := json.Unmarshal(v, &id); err != nil {
+				return err
+			}
+		}
+		if id == 0 {
+			task["id"], _ = json.Marshal(now + int64(i))
+		}
+	}
+
+	updated, err := json.Marshal(tasks)
+	if err != nil {
+		return err
+	}
+	doc["tasks"] = updated
+	return nil
+}
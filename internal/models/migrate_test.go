@@ -0,0 +1,103 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+func TestMigrations_CoverEveryVersion(t *testing.T) {
+	if len(migrations) != CurrentSchemaVersion {
+		t.Fatalf("expected %d migrations, got %d", CurrentSchemaVersion, len(migrations))
+	}
+}
+
+func TestMigrateAppData_FromV0(t *testing.T) {
+	raw := []byte(`{"themeIndex":2,"sortMode":1,"tasks":[{"id":0,"title":"legacy"},{"id":5,"title":"kept"}]}`)
+
+	migrated, version, err := migrateAppData(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != 0 {
+		t.Fatalf("expected stored version 0, got %d", version)
+	}
+
+	var data AppData
+	if err := json.Unmarshal(migrated, &data); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if data.SchemaVersion != CurrentSchemaVersion {
+		t.Fatalf("expected schema version %d, got %d", CurrentSchemaVersion, data.SchemaVersion)
+	}
+	if data.ThemeIndex != 2 || data.SortMode != SortTodoFirst {
+		t.Fatalf("settings lost during migration: %+v", data)
+	}
+	if data.Tasks[0].ID == 0 {
+		t.Fatalf("expected zero ID to be assigned")
+	}
+	if data.Tasks[1].ID != 5 {
+		t.Fatalf("expected existing ID to be kept, got %d", data.Tasks[1].ID)
+	}
+}
+
+func TestMigrateAppData_Current(t *testing.T) {
+	raw := []byte(`{"schemaVersion":1,"tasks":[]}`)
+
+	migrated, version, err := migrateAppData(raw)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if version != CurrentSchemaVersion {
+		t.Fatalf("unexpected version: %d", version)
+	}
+	if string(migrated) != string(raw) {
+		t.Fatalf("current data should not be rewritten")
+	}
+}
+
+func TestMigrateAppData_NewerSchema(t *testing.T) {
+	raw := []byte(`{"schemaVersion":99}`)
+
+	_, _, err := migrateAppData(raw)
+	if !errors.Is(err, ErrNewerSchema) {
+		t.Fatalf("expected ErrNewerSchema, got %v", err)
+	}
+}
+
+func TestMigrateAppData_Invalid(t *testing.T) {
+	if _, _, err := migrateAppData([]byte("not json")); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected ErrInvalidDocument for invalid JSON, got %v", err)
+	}
+	if _, _, err := migrateAppData([]byte(`{"schemaVersion":"one"}`)); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected ErrInvalidDocument for an invalid schemaVersion, got %v", err)
+	}
+	if _, _, err := migrateAppData([]byte(`{"tasks":"oops"}`)); !errors.Is(err, ErrMigrationFailed) {
+		t.Fatalf("expected ErrMigrationFailed for a failing step, got %v", err)
+	}
+}
+
+func TestLoadData_FailedMigrationKeepsData(t *testing.T) {
+	backend, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	// Version 0 data the V0->V1 step cannot read
+	raw := []byte(`{"tasks":{"id":1,"title":"not a list"}}`)
+	if err := backend.Save("todos.json", raw); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	t.Cleanup(func() { store = nil })
+	store = newBlobStore(storage.NewStorageManager(backend, nil), "todos.json")
+
+	if _, err := LoadData(); !errors.Is(err, ErrMigrationFailed) {
+		t.Fatalf("expected ErrMigrationFailed instead of the default data, got %v", err)
+	}
+	if stored, _ := backend.Load("todos.json"); !bytes.Equal(stored, raw) {
+		t.Errorf("stored data was changed: %s", stored)
+	}
+}
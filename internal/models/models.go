@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/charmbracelet/bubbles/textinput"
+	"github.com/nirabyte/todo/internal/storage"
 )
 
 type AppState int
@@ -13,6 +14,7 @@ const (
 	StateEditing
 	StateCreating
 	StateSettingTime
+	StateRestoring
 )
 
 type SortMode int
@@ -65,6 +67,10 @@ type Task struct {
 	DueAt    time.Time `json:"dueAt"`
 	Notified bool      `json:"notified"`
 
+	// UpdatedAt is set when a persisted field changes, for merging copies
+	// edited on different devices
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+
 	// Animation States
 	IsAnimatingCheck bool      `json:"-"`
 	IsDeleting       bool      `json:"-"`
@@ -73,13 +79,28 @@ type Task struct {
 }
 
 type AppData struct {
-	ThemeIndex int      `json:"themeIndex"`
-	SortMode   SortMode `json:"sortMode"`
-	Tasks      []Task   `json:"tasks"`
+	SchemaVersion int      `json:"schemaVersion"`
+	ThemeIndex    int      `json:"themeIndex"`
+	SortMode      SortMode `json:"sortMode"`
+	Tasks         []Task   `json:"tasks"`
+
+	// Change tracking for MergeAppData
+	SettingsUpdatedAt time.Time   `json:"settingsUpdatedAt,omitempty"`
+	Deleted           []Tombstone `json:"deleted,omitempty"`
+}
+
+// Tombstone records a deleted task so a merge does not bring it back
+type Tombstone struct {
+	ID        int64     `json:"id"`
+	DeletedAt time.Time `json:"deletedAt"`
 }
 
 type TickMsg struct{}
 
+// SyncTickMsg refreshes the sync status in the help line and reloads tasks
+// changed elsewhere
+type SyncTickMsg struct{}
+
 type Model struct {
 	Tasks      []Task
 	State      AppState
@@ -91,5 +112,18 @@ type Model struct {
 	Width     int
 	Height    int
 	TextInput textinput.Model
+
+	// Unsaved is set when the last save failed, so Flush can retry it on exit
+	Unsaved bool
+
+	// SyncRevision is the last data revision (see dataRevision) loaded into Tasks
+	SyncRevision uint64
+
+	// Backup picker
+	Backups      []storage.Backup
+	BackupCursor int
+
+	// Notice replaces the help line until the next key press
+	Notice string
 }
 
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"filippo.io/age"
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// storageEncryptor returns the encryptor for the configured key source.
+// With recipients, the wrapped data key is read from the remote backend
+// even when the offline cache is enabled, so a stale or missing cached copy
+// never creates a second data key.
+func storageEncryptor(storageType string, backend storage.Storage) (storage.Encryptor, error) {
+	if config.KeySource != "recipients" {
+		return newEncryptor(config.EncryptionKey, config.Passphrase, config.PreviousKeys...)
+	}
+
+	if syncer != nil {
+		remote, err := newBackend(storageType)
+		if err != nil {
+			return nil, err
+		}
+		defer remote.Close()
+		backend = remote
+	}
+	enc, err := openRecipientEncryptor(backend)
+	if err != nil {
+		return nil, err
+	}
+	return enc, nil
+}
+
+func openRecipientEncryptor(backend storage.Storage) (*storage.RecipientEncryptor, error) {
+	identity, err := age.ParseX25519Identity(config.Identity)
+	if err != nil {
+		return nil, fmt.Errorf("invalid age identity: %w", err)
+	}
+
+	ctx, cancel := storageContext()
+	defer cancel()
+	return storage.OpenRecipientEncryptor(ctx, backend, identity)
+}
+
+// Recipients returns the age public keys that can read storageType's data
+func Recipients(storageType string) ([]string, error) {
+	backend, err := newBackend(storageType)
+	if err != nil {
+		return nil, err
+	}
+	defer backend.Close()
+
+	enc, err := openRecipientEncryptor(backend)
+	if err != nil {
+		return nil, err
+	}
+	return enc.Recipients(), nil
+}
+
+// AddRecipient wraps the data key for one more age public key
+func AddRecipient(storageType, recipient string) error {
+	backend, err := newBackend(storageType)
+	if err != nil {
+		return err
+	}
+	defer backend.Close()
+
+	enc, err := openRecipientEncryptor(backend)
+	if err != nil {
+		return err
+	}
+	recipients := enc.Recipients()
+	if slices.Contains(recipients, recipient) {
+		return fmt.Errorf("%s is already a recipient", recipient)
+	}
+
+	added, err := enc.WithRecipients(append(recipients, recipient))
+	if err != nil {
+		return err
+	}
+	ctx, cancel := storageContext()
+	defer cancel()
+	return added.Store(ctx, backend)
+}
+
+// RemoveRecipient stops wrapping the data key for recipient. Unless
+// keepDataKey is set, a new data key is generated and all data is
+// re-encrypted with it, since the removed member may have kept the old one.
+// The old key stays wrapped next to the new one until the re-encryption is
+// verified, so an interrupted removal can be run again.
+func RemoveRecipient(storageType, recipient string, keepDataKey bool) (*storage.MigrateResult, error) {
+	backend, err := newBackend(storageType)
+	if err != nil {
+		return nil, err
+	}
+	defer backend.Close()
+
+	enc, err := openRecipientEncryptor(backend)
+	if err != nil {
+		return nil, err
+	}
+	recipients := enc.Recipients()
+	i := slices.Index(recipients, recipient)
+	if i < 0 {
+		return nil, fmt.Errorf("%s is not a recipient", recipient)
+	}
+	if len(recipients) == 1 {
+		return nil, fmt.Errorf("cannot remove the last recipient")
+	}
+
+	removed, err := enc.WithRecipients(slices.Delete(recipients, i, i+1))
+	if err != nil {
+		return nil, err
+	}
+	if !keepDataKey {
+		if removed, err = removed.Rotate(); err != nil {
+			return nil, err
+		}
+	}
+	if err := storeRecipients(removed, backend); err != nil {
+		return nil, err
+	}
+	if keepDataKey {
+		return &storage.MigrateResult{}, nil
+	}
+
+	settled, err := removed.Settle()
+	if err != nil {
+		return nil, err
+	}
+	result, err := reencrypt(storageType, removed, settled)
+	if err != nil {
+		return result, err
+	}
+	return result, storeRecipients(settled, backend)
+}
+
+func storeRecipients(enc *storage.RecipientEncryptor, backend storage.Storage) error {
+	ctx, cancel := storageContext()
+	defer cancel()
+	if err := enc.Store(ctx, backend); err != nil {
+		return fmt.Errorf("failed to store recipients: %w", err)
+	}
+	return nil
+}
+
+// storageContext bounds a one-off storage operation by STORAGE_TIMEOUT
+func storageContext() (context.Context, context.CancelFunc) {
+	if config.StorageTimeout > 0 {
+		return context.WithTimeout(context.Background(), config.StorageTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
@@ -1,74 +1,464 @@
 package models
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/nirabyte/todo/internal/config"
 	"github.com/nirabyte/todo/internal/storage"
 )
 
-var storageManager *storage.StorageManager
+var (
+	storageManager *storage.StorageManager
+	recordManager  *storage.RecordManager
+	store          dataStore
+	syncer         *storage.CachedStorage
+
+	// Live refresh for backends that publish changes (see storage.Watcher)
+	stopWatch     context.CancelFunc
+	watchRevision atomic.Uint64
+)
 
 // InitStorage initializes the storage backend
 func InitStorage(storageType string) error {
-	var store storage.Storage
-	var err error
+	backend, err := newCachedBackend(storageType)
+	if err != nil {
+		return err
+	}
 
-	// Normalize storage type
-	if storageType == "" {
-		storageType = "file"
+	encryptor, err := storageEncryptor(storageType, backend)
+	if err != nil {
+		backend.Close()
+		return err
+	}
+
+	compression, err := storage.ParseCompression(config.StorageCompression)
+	if err != nil {
+		backend.Close()
+		return err
 	}
 
-	switch storageType {
-	case "file":
-		store, err = storage.NewFileStorage(config.DataPath)
+	storageManager = storage.NewStorageManager(backend, encryptor)
+	storageManager.SetTimeout(config.StorageTimeout)
+	if err := storageManager.SetCompression(compression); err != nil {
+		backend.Close()
+		return fmt.Errorf("STORAGE_COMPRESSION: %w", err)
+	}
+	auditKeyer = keyDeriver(encryptor)
+	if syncer != nil {
+		syncer.SetConflictFunc(newConflictResolver(encryptor, config.DataFile, config.AuditFile))
+		syncer.Start(config.SyncInterval)
+	}
+	watchChanges(backend)
+	if config.BackupInterval > 0 {
+		storageManager.EnableBackups(storage.BackupPolicy{
+			Prefix:   config.BackupPrefix,
+			Keys:     []string{config.DataFile},
+			Interval: config.BackupInterval,
+			Recent:   config.BackupRecent,
+			Hourly:   config.BackupHourly,
+			Daily:    config.BackupDaily,
+		})
+	}
+
+	switch config.StorageSchema {
+	case "", "blob":
+		store = newBlobStore(storageManager, config.DataFile)
+	case "records":
+		recordManager, err = openRecords(storageType, backend, encryptor)
 		if err != nil {
-			return fmt.Errorf("failed to initialize file storage: %w", err)
+			backend.Close()
+			return err
 		}
-	case "s3":
-		if config.S3Bucket == "" {
-			return fmt.Errorf("S3_BUCKET environment variable is required for S3 storage")
+		store = newRecordStore(recordManager, storageManager, config.SettingsFile, config.DataFile)
+	default:
+		backend.Close()
+		return fmt.Errorf("unsupported storage schema: %s (supported: blob, records)", config.StorageSchema)
+	}
+	return nil
+}
+
+// OpenStorage builds a standalone storage manager from the current config,
+// independent of the one used by the TUI, with the key settings of config
+// (KeySource, EncryptionKey, Passphrase, Identity) as InitStorage uses
+// them. records is the task record store for the records schema, nil for
+// the blob schema; it shares the manager's backend.
+func OpenStorage(storageType string) (manager *storage.StorageManager, records *storage.RecordManager, err error) {
+	backend, err := newBackend(storageType)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptor, err := storageEncryptor(storageType, backend)
+	if err != nil {
+		backend.Close()
+		return nil, nil, err
+	}
+
+	compression, err := storage.ParseCompression(config.StorageCompression)
+	if err != nil {
+		backend.Close()
+		return nil, nil, err
+	}
+
+	if config.StorageSchema == "records" {
+		if records, err = openRecords(storageType, backend, encryptor); err != nil {
+			backend.Close()
+			return nil, nil, err
 		}
-		store, err = storage.NewS3Storage(config.S3Bucket, config.S3Region)
-		if err != nil {
-			return fmt.Errorf("failed to initialize S3 storage: %w", err)
+	}
+
+	manager = storage.NewStorageManager(backend, encryptor)
+	manager.SetTimeout(config.StorageTimeout)
+	if err := manager.SetCompression(compression); err != nil {
+		backend.Close()
+		return nil, nil, fmt.Errorf("STORAGE_COMPRESSION: %w", err)
+	}
+	return manager, records, nil
+}
+
+// openRecords opens the task records of the records schema in backend
+func openRecords(storageType string, backend storage.Storage, encryptor storage.Encryptor) (*storage.RecordManager, error) {
+	provider, ok := backend.(storage.RecordProvider)
+	if !ok {
+		return nil, fmt.Errorf("storage type %s does not support the records schema (supported: %s)", storageType, storage.BackendNames(isRecordsBackend))
+	}
+	records, err := provider.Records(config.RecordsTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize record storage: %w", err)
+	}
+	manager := storage.NewRecordManager(records, encryptor)
+	manager.SetTimeout(config.StorageTimeout)
+	manager.SetTitleEncryption(!config.RecordsPlaintext)
+	return manager, nil
+}
+
+// PlaintextKeys returns the data keys that still hold unencrypted JSON,
+// e.g. written by a version without encryption
+func PlaintextKeys() []string {
+	if storageManager == nil {
+		return nil
+	}
+	var keys []string
+	for _, key := range dataKeys() {
+		if _, err := storageManager.Load(key); errors.Is(err, storage.ErrNotEncrypted) {
+			keys = append(keys, key)
 		}
-	case "mongodb", "mongo":
-		store, err = storage.NewMongoStorage(config.MongoURI, config.MongoDB, config.MongoCollection)
-		if err != nil {
-			return fmt.Errorf("failed to initialize MongoDB storage: %w", err)
+	}
+	return keys
+}
+
+// EncryptPlaintext encrypts the unencrypted data keys in place
+func EncryptPlaintext() error {
+	for _, key := range PlaintextKeys() {
+		if _, err := storageManager.EncryptPlaintext(key); err != nil {
+			return fmt.Errorf("failed to encrypt %s: %w", key, err)
+		}
+		log.Printf("Encrypted %s in place", key)
+	}
+	return nil
+}
+
+// ExportData returns the stored data as indented JSON, decrypted
+func ExportData() ([]byte, error) {
+	if store == nil {
+		return nil, errors.New("storage is not initialized")
+	}
+	data, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(data, "", "  ")
+}
+
+// dataKeys are the keys holding the app data for the storage schema
+func dataKeys() []string {
+	if config.StorageSchema == "records" {
+		return []string{config.SettingsFile, config.DataFile, config.AuditFile}
+	}
+	return []string{config.DataFile, config.AuditFile}
+}
+
+// DataKeyFilter reports whether a stored key belongs to the app with the
+// current config: a data key, or a backup, migration backup or conflict
+// copy of one. Other keys, e.g. the log in a shared data directory, are not.
+func DataKeyFilter() func(key string) bool {
+	keys := dataKeys()
+	backupPrefix := config.BackupPrefix
+	return func(key string) bool {
+		key = strings.TrimPrefix(key, backupPrefix)
+		for _, k := range keys {
+			if key == k || strings.HasPrefix(key, k+".") {
+				return true
+			}
 		}
-	case "postgres", "postgresql", "pg":
-		store, err = storage.NewDBStorage("postgres", config.PostgresDSN, config.PostgresTable)
+		return false
+	}
+}
+
+// LocalFiles returns the local files the app keeps data in with the
+// current config: data keys, their backups and conflict copies in DATA_PATH
+// and in the offline cache, and the backend's own files, e.g. a SQLite
+// database. Other files in those directories are left out.
+func LocalFiles() ([]string, error) {
+	isDataKey := DataKeyFilter()
+	isAppKey := func(name string) bool {
+		return name == storage.RecipientsKey || isDataKey(name)
+	}
+
+	paths := keyFiles(config.DataPath, isAppKey)
+	storageType := config.StorageType
+	if storageType == "" {
+		storageType = "file"
+	}
+	if backend, ok := storage.LookupBackend(storageType); ok {
+		if !backend.Local && config.StorageCache {
+			paths = append(paths, keyFiles(cacheDir(storageType), func(name string) bool {
+				return isAppKey(name) || storage.IsCacheStateKey(name)
+			})...)
+		}
+		files, err := backend.LocalFiles(backendConfig())
 		if err != nil {
-			return fmt.Errorf("failed to initialize PostgreSQL storage: %w", err)
+			return nil, err
 		}
-	default:
-		return fmt.Errorf("unsupported storage type: %s (supported: file, s3, mongodb, postgres)", storageType)
+		paths = append(paths, files...)
 	}
+	return paths, nil
+}
+
+// keyFiles returns the files directly in dir whose name include accepts
+func keyFiles(dir string, include func(name string) bool) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var paths []string
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && include(entry.Name()) {
+			paths = append(paths, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return paths
+}
 
-	// Initialize encryption if key is provided
-	var encryptor storage.Encryptor
-	if config.EncryptionKey != "" {
-		key, err := hex.DecodeString(config.EncryptionKey)
+// StorageLocation identifies the store the current config points at (see
+// storage.Backend.Location)
+func StorageLocation(storageType string) (string, error) {
+	if storageType == "" {
+		storageType = "file"
+	}
+	backend, ok := storage.LookupBackend(storageType)
+	if !ok {
+		return "", fmt.Errorf("unsupported storage type: %s (supported: %s)", storageType, storage.BackendNames(nil))
+	}
+	return backend.Location(backendConfig())
+}
+
+// CloseStorage releases the storage backend's connections. Call Flush first.
+func CloseStorage() error {
+	if stopWatch != nil {
+		stopWatch()
+	}
+	if recordManager != nil {
+		recordManager.Cancel()
+	}
+	if storageManager == nil {
+		return nil
+	}
+	return storageManager.Close()
+}
+
+// CancelStorage aborts in-flight storage operations, e.g. when the app quits
+func CancelStorage() {
+	if storageManager != nil {
+		storageManager.Cancel()
+	}
+	if syncer != nil {
+		syncer.Cancel()
+	}
+	if recordManager != nil {
+		recordManager.Cancel()
+	}
+	if stopWatch != nil {
+		stopWatch()
+	}
+}
+
+// SyncStatus reports the background sync state when the offline cache is enabled
+func SyncStatus() (storage.SyncStatus, bool) {
+	if syncer == nil {
+		return storage.SyncStatus{}, false
+	}
+	return syncer.Status(), true
+}
+
+// dataRevision counts changes to the stored data made outside this
+// process, by the background sync or by other clients. ok is false when
+// neither is active.
+func dataRevision() (revision uint64, ok bool) {
+	if syncer != nil {
+		revision += syncer.Status().Revision
+		ok = true
+	}
+	if stopWatch != nil {
+		revision += watchRevision.Load()
+		ok = true
+	}
+	return revision, ok
+}
+
+// watchChanges subscribes to change notifications when the backend
+// supports them, so edits from other clients show up without a restart
+func watchChanges(backend storage.Storage) {
+	if stopWatch != nil {
+		stopWatch()
+		stopWatch = nil
+	}
+	watcher, ok := backend.(storage.Watcher)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	changes, err := watcher.Watch(ctx)
+	if err != nil {
+		cancel()
+		log.Printf("Live refresh disabled: %v", err)
+		return
+	}
+	stopWatch = cancel
+	go func() {
+		for change := range changes {
+			if change.Key == config.DataFile {
+				watchRevision.Add(1)
+			}
+		}
+	}()
+}
+
+// newCachedBackend wraps remote backends in an offline-first cache when
+// STORAGE_CACHE is enabled. The remote is dialed in the background, so
+// startup does not need the network.
+func newCachedBackend(storageType string) (storage.Storage, error) {
+	if backend, ok := storage.LookupBackend(storageType); !ok || backend.Local || !config.StorageCache {
+		return newBackend(storageType)
+	}
+	if config.StorageSchema == "records" {
+		return nil, fmt.Errorf("STORAGE_CACHE requires the blob storage schema")
+	}
+
+	local, err := storage.NewFileStorage(cacheDir(storageType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage cache: %w", err)
+	}
+
+	cached, err := storage.NewCachedStorage(local, func() (storage.Storage, error) {
+		return newBackend(storageType)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage cache: %w", err)
+	}
+	cached.SetTimeout(config.StorageTimeout)
+	syncer = cached
+	return cached, nil
+}
+
+// cacheDir is where the offline cache keeps its copy of storageType's data
+func cacheDir(storageType string) string {
+	if config.CachePath != "" {
+		return config.CachePath
+	}
+	return filepath.Join(config.DataPath, "cache", storageType)
+}
+
+// newBackend creates the storage backend for storageType from the current config
+func newBackend(storageType string) (storage.Storage, error) {
+	// Normalize storage type
+	if storageType == "" {
+		storageType = "file"
+	}
+
+	backend, ok := storage.LookupBackend(storageType)
+	if !ok {
+		return nil, fmt.Errorf("unsupported storage type: %s (supported: %s)", storageType, storage.BackendNames(nil))
+	}
+	return backend.Open(backendConfig())
+}
+
+func backendConfig() storage.BackendConfig {
+	return storage.BackendConfig{
+		DataPath:     config.DataPath,
+		BackupPrefix: config.BackupPrefix,
+		Timeout:      config.StorageTimeout,
+		Settings:     config.BackendSettings,
+	}
+}
+
+func isRecordsBackend(b storage.Backend) bool {
+	return b.Records
+}
+
+// newEncryptor creates an AES encryptor from a passphrase or a hex key, or
+// nil when both are empty. Data encrypted with one of the previous hex
+// keys can still be decrypted.
+func newEncryptor(encryptionKey, passphrase string, previousKeys ...string) (storage.Encryptor, error) {
+	if passphrase != "" {
+		encryptor, err := storage.NewPassphraseEncryptor(passphrase, storage.DefaultKDFParams)
 		if err != nil {
-			return fmt.Errorf("invalid encryption key (must be 64 hex characters): %w", err)
+			return nil, fmt.Errorf("failed to initialize encryptor: %w", err)
 		}
-		if len(key) != 32 {
-			return fmt.Errorf("encryption key must be 32 bytes (64 hex characters), got %d bytes", len(key))
+		return encryptor, nil
+	}
+	if encryptionKey == "" {
+		return nil, nil
+	}
+
+	key, err := decodeKey(encryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	defer clear(key)
+	var previous [][]byte
+	defer func() {
+		// The encryptor keeps its own copies
+		for _, k := range previous {
+			clear(k)
 		}
-		encryptor, err = storage.NewAESEncryptor(key)
+	}()
+	for _, k := range previousKeys {
+		old, err := decodeKey(k)
 		if err != nil {
-			return fmt.Errorf("failed to initialize encryptor: %w", err)
+			return nil, fmt.Errorf("previous %w", err)
 		}
+		previous = append(previous, old)
 	}
+	encryptor, err := storage.NewAESEncryptor(key, previous...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize encryptor: %w", err)
+	}
+	return encryptor, nil
+}
 
-	storageManager = storage.NewStorageManager(store, encryptor)
-	return nil
+// decodeKey parses a 64 hex character AES-256 key
+func decodeKey(encryptionKey string) ([]byte, error) {
+	key, err := hex.DecodeString(encryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is invalid (must be 64 hex characters): %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key must be 32 bytes (64 hex characters), got %d bytes", len(key))
+	}
+	return key, nil
 }
 
 // GenerateEncryptionKey creates a new 32-byte key for AES-256
@@ -81,7 +471,18 @@ func GenerateEncryptionKey() (string, error) {
 	return hex.EncodeToString(key), nil
 }
 
-func LoadData() AppData {
+// DataExists reports whether the data file has been saved before
+func DataExists() (bool, error) {
+	if storageManager == nil {
+		return false, nil
+	}
+	return storageManager.Exists(config.DataFile)
+}
+
+// LoadData loads the stored AppData, falling back to the hint tasks when
+// nothing usable is stored. It only fails when the stored data must not be
+// overwritten, e.g. because it was written by a newer schema version.
+func LoadData() (AppData, error) {
 	hints := []Task{
 		{ID: 1, Title: "Welcome to your TODO Manager", Done: false},
 		{ID: 2, Title: "Press 'n' to add a new task", Done: false},
@@ -94,36 +495,73 @@ func LoadData() AppData {
 	}
 
 	defaultData := AppData{
-		ThemeIndex: 0,
-		SortMode:   SortOff,
-		Tasks:      hints,
+		SchemaVersion: CurrentSchemaVersion,
+		ThemeIndex:    0,
+		SortMode:      SortOff,
+		Tasks:         hints,
 	}
 
-	if storageManager == nil {
-		return defaultData
+	if store == nil {
+		return defaultData, nil
 	}
 
-	data, err := storageManager.Load(config.DataFile)
+	appData, err := store.Load()
 	if err != nil {
-		return defaultData
+		if isUnreadable(err) {
+			return AppData{}, err
+		}
+		return defaultData, nil
 	}
 
-	var appData AppData
-	if err := json.Unmarshal(data, &appData); err == nil {
-		for i := range appData.Tasks {
-			if appData.Tasks[i].ID == 0 {
-				appData.Tasks[i].ID = time.Now().UnixNano() + int64(i)
-			}
+	// Migrations assign IDs when upgrading, but current-version data can
+	// still hold tasks without one, e.g. when edited by hand
+	for i := range appData.Tasks {
+		if appData.Tasks[i].ID == 0 {
+			appData.Tasks[i].ID = time.Now().UnixNano() + int64(i)
 		}
-		return appData
 	}
-	return defaultData
+	return appData, nil
+}
+
+// isUnreadable reports whether stored data exists but cannot be read with
+// this build or key. Falling back to the defaults would overwrite it.
+func isUnreadable(err error) bool {
+	return errors.Is(err, ErrNewerSchema) ||
+		errors.Is(err, ErrInvalidDocument) ||
+		errors.Is(err, ErrMigrationFailed) ||
+		errors.Is(err, storage.ErrWrongPassphrase) ||
+		errors.Is(err, storage.ErrCorrupted) ||
+		errors.Is(err, storage.ErrUnknownKey) ||
+		errors.Is(err, storage.ErrUnsupportedFormat) ||
+		errors.Is(err, storage.ErrNotEncrypted) ||
+		errors.Is(err, storage.ErrEncrypted)
 }
 
 func (m *Model) Save() {
-	if storageManager == nil {
-		// storageManager is nil we return here to avoid a panic
-		return
+	err := m.save()
+	m.Unsaved = err != nil && !errors.Is(err, storage.ErrBackupFailed)
+}
+
+// Flush retries the last save if it failed and waits for the audit log, so
+// a change made while the backend was unreachable is not lost on exit
+func (m *Model) Flush() error {
+	if err := auditQueue.flush(); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+	}
+	if !m.Unsaved {
+		return nil
+	}
+	if err := m.save(); err != nil && !errors.Is(err, storage.ErrBackupFailed) {
+		return err
+	}
+	m.Unsaved = false
+	return nil
+}
+
+func (m *Model) save() error {
+	if store == nil {
+		// store is nil we return here to avoid a panic
+		return nil
 	}
 
 	var validTasks []Task
@@ -139,9 +577,5 @@ func (m *Model) Save() {
 		Tasks:      validTasks,
 	}
 
-	bytes, err := json.MarshalIndent(data, "", "  ")
-	if err != nil {
-		return
-	}
-	_ = storageManager.Save(config.DataFile, bytes)
+	return store.Save(data)
 }
@@ -0,0 +1,351 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/nirabyte/todo/internal/config"
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+func TestLoadData_WrongPassphrase(t *testing.T) {
+	backend, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	params := storage.KDFParams{Time: 1, Memory: 64, Threads: 1}
+	right, _ := storage.NewPassphraseEncryptor("right", params)
+	wrong, _ := storage.NewPassphraseEncryptor("wrong", params)
+
+	if err := storage.NewStorageManager(backend, right).Save("todos.json", []byte(`{"schemaVersion":1,"tasks":[]}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	t.Cleanup(func() { store = nil })
+	store = newBlobStore(storage.NewStorageManager(backend, wrong), "todos.json")
+
+	// Falling back to the hints would overwrite the data on the next save
+	if _, err := LoadData(); !errors.Is(err, storage.ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestRotateKey(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.DataPath = t.TempDir()
+	config.StorageSchema = "blob"
+
+	oldKey := strings.Repeat("11", 32)
+	newKey := strings.Repeat("22", 32)
+
+	backend, err := storage.NewFileStorage(config.DataPath)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	oldEnc, _ := newEncryptor(oldKey, "")
+	newEnc, _ := newEncryptor(newKey, "")
+	if err := storage.NewStorageManager(backend, oldEnc).Save("todos.json", []byte("tasks")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	result, err := RotateKey("file", oldKey, newKey)
+	if err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+	if len(result.Copied) != 1 {
+		t.Errorf("expected 1 re-encrypted key, got %v", result.Copied)
+	}
+
+	data, err := storage.NewStorageManager(backend, newEnc).Load("todos.json")
+	if err != nil || string(data) != "tasks" {
+		t.Fatalf("Load with new key = %q, %v", data, err)
+	}
+	if _, err := storage.NewStorageManager(backend, oldEnc).Load("todos.json"); err == nil {
+		t.Error("expected the old key to no longer decrypt the data")
+	}
+
+	// Running it again after an interruption is harmless
+	if _, err := RotateKey("file", oldKey, newKey); err != nil {
+		t.Fatalf("second RotateKey failed: %v", err)
+	}
+}
+
+func TestRotateKey_SkipsOtherFiles(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.DataPath = t.TempDir()
+	config.StorageSchema = "blob"
+
+	oldKey := strings.Repeat("11", 32)
+	newKey := strings.Repeat("22", 32)
+
+	backend, err := storage.NewFileStorage(config.DataPath)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	oldEnc, _ := newEncryptor(oldKey, "")
+	if err := storage.NewStorageManager(backend, oldEnc).Save(config.DataFile, []byte("tasks")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	// E.g. a SQLite database sharing the data directory
+	other := filepath.Join(config.DataPath, "todo.db")
+	if err := os.WriteFile(other, []byte("SQLite format 3\x00"), 0600); err != nil {
+		t.Fatalf("failed to write the unrelated file: %v", err)
+	}
+
+	result, err := RotateKey("file", oldKey, newKey)
+	if err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+	if len(result.Copied) != 1 || result.Copied[0] != config.DataFile {
+		t.Errorf("expected only %s to be re-encrypted, got %v", config.DataFile, result.Copied)
+	}
+	if data, _ := os.ReadFile(other); string(data) != "SQLite format 3\x00" {
+		t.Errorf("unrelated file was changed: %q", data)
+	}
+}
+
+func TestRemoveRecipient_RotatesDataKey(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.DataPath = t.TempDir()
+	config.StorageSchema = "blob"
+
+	alice, _ := age.GenerateX25519Identity()
+	bob, _ := age.GenerateX25519Identity()
+	config.Identity = alice.String()
+
+	if err := AddRecipient("file", bob.Recipient().String()); err != nil {
+		t.Fatalf("AddRecipient failed: %v", err)
+	}
+
+	backend, _ := storage.NewFileStorage(config.DataPath)
+	before, _ := storage.OpenRecipientEncryptor(context.Background(), backend, bob)
+	if err := storage.NewStorageManager(backend, before).Save("todos.json", []byte("tasks")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	result, err := RemoveRecipient("file", bob.Recipient().String(), false)
+	if err != nil {
+		t.Fatalf("RemoveRecipient failed: %v", err)
+	}
+	if len(result.Copied) != 1 {
+		t.Errorf("expected 1 re-encrypted key, got %v", result.Copied)
+	}
+
+	// The data key bob may have kept no longer decrypts anything
+	if _, err := storage.NewStorageManager(backend, before).Load("todos.json"); !errors.Is(err, storage.ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey with the old data key, got %v", err)
+	}
+	after, err := storage.OpenRecipientEncryptor(context.Background(), backend, alice)
+	if err != nil {
+		t.Fatalf("OpenRecipientEncryptor failed: %v", err)
+	}
+	if data, err := storage.NewStorageManager(backend, after).Load("todos.json"); err != nil || string(data) != "tasks" {
+		t.Fatalf("Load = %q, %v", data, err)
+	}
+}
+
+func TestBlobStore_Load_KeepsFirstBackup(t *testing.T) {
+	backend, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	manager := storage.NewStorageManager(backend, nil)
+	original := []byte(`{"tasks":[{"title":"legacy"}]}`)
+	if err := manager.Save("todos.json", original); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	bs := newBlobStore(manager, "todos.json")
+	if _, err := bs.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	// A second v0 document must not replace the pre-migration backup
+	if err := manager.Save("todos.json", []byte(`{"tasks":[]}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := bs.Load(); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	backup, err := manager.Load("todos.json.v0.bak")
+	if err != nil {
+		t.Fatalf("failed to load backup: %v", err)
+	}
+	if string(backup) != string(original) {
+		t.Errorf("expected the first backup to be kept, got %s", backup)
+	}
+}
+
+func TestLoadData_AssignsMissingIDs(t *testing.T) {
+	backend, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	manager := storage.NewStorageManager(backend, nil)
+	if err := manager.Save("todos.json", []byte(`{"schemaVersion":1,"tasks":[{"title":"a"},{"title":"b"}]}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	t.Cleanup(func() { store = nil })
+	store = newBlobStore(manager, "todos.json")
+
+	data, err := LoadData()
+	if err != nil {
+		t.Fatalf("LoadData failed: %v", err)
+	}
+	if len(data.Tasks) != 2 || data.Tasks[0].ID == 0 || data.Tasks[0].ID == data.Tasks[1].ID {
+		t.Errorf("expected distinct non-zero IDs, got %+v", data.Tasks)
+	}
+}
+
+func TestDataKeyFilter(t *testing.T) {
+	snapshot := config.Capture()
+	t.Cleanup(snapshot.Restore)
+	config.StorageSchema = "blob"
+	config.DataFile = "todos.json"
+	config.AuditFile = "audit.json"
+	config.BackupPrefix = "backup."
+
+	isDataKey := DataKeyFilter()
+	for _, key := range []string{"todos.json", "audit.json", "todos.json.v0.bak", "backup.todos.json.20250301T120000Z", "todos.json.conflict.1"} {
+		if !isDataKey(key) {
+			t.Errorf("expected %s to be a data key", key)
+		}
+	}
+	for _, key := range []string{"todo.db", "todo.log", "key", "settings.json"} {
+		if isDataKey(key) {
+			t.Errorf("expected %s not to be a data key", key)
+		}
+	}
+}
+
+func TestBlobStore_Save_MergesUnloadedChanges(t *testing.T) {
+	backend, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	manager := storage.NewStorageManager(backend, nil)
+	if err := manager.Save("todos.json", []byte(`{"schemaVersion":1,"tasks":[{"id":1,"title":"local"}]}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// Pretend a watcher is active so dataRevision reports changes
+	t.Cleanup(func() { stopWatch = nil })
+	stopWatch = func() {}
+
+	bs := newBlobStore(manager, "todos.json")
+	data, err := bs.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// A sync merges a task from another device, but the model is busy and
+	// does not reload before its next save
+	if err := manager.Save("todos.json", []byte(`{"schemaVersion":1,"tasks":[{"id":1,"title":"local"},{"id":2,"title":"remote"}]}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	watchRevision.Add(1)
+
+	data.Tasks[0].Title = "local edited"
+	if err := bs.Save(data); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	stored, err := newBlobStore(manager, "todos.json").Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(stored.Tasks) != 2 || stored.Tasks[0].Title != "local edited" || stored.Tasks[1].Title != "remote" {
+		t.Errorf("expected the edit merged with the remote task, got %+v", stored.Tasks)
+	}
+	if len(stored.Deleted) != 0 {
+		t.Errorf("expected no tombstones, got %+v", stored.Deleted)
+	}
+}
+
+// modifiedOnceStorage simulates another client writing remote between our
+// load and save: the first Save stores remote and fails with ErrModified
+type modifiedOnceStorage struct {
+	*storage.FileStorage
+	remote []byte
+}
+
+func (s *modifiedOnceStorage) SaveContext(ctx context.Context, key string, data []byte) error {
+	if s.remote != nil {
+		remote := s.remote
+		s.remote = nil
+		if err := s.FileStorage.SaveContext(ctx, key, remote); err != nil {
+			return err
+		}
+		return fmt.Errorf("webdav: %s: %w", key, storage.ErrModified)
+	}
+	return s.FileStorage.SaveContext(ctx, key, data)
+}
+
+func TestBlobStore_Save_MergesOnErrModified(t *testing.T) {
+	files, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	backend := &modifiedOnceStorage{FileStorage: files}
+	manager := storage.NewStorageManager(backend, nil)
+	if err := manager.Save("todos.json", []byte(`{"schemaVersion":1,"tasks":[{"id":1,"title":"local"}]}`)); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	bs := newBlobStore(manager, "todos.json")
+	data, err := bs.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	backend.remote = []byte(`{"schemaVersion":1,"tasks":[{"id":1,"title":"local"},{"id":2,"title":"remote"}]}`)
+	data.Tasks[0].Title = "local edited"
+	if err := bs.Save(data); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	stored, err := newBlobStore(manager, "todos.json").Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(stored.Tasks) != 2 || stored.Tasks[0].Title != "local edited" || stored.Tasks[1].Title != "remote" {
+		t.Errorf("expected the edit merged with the other client's task, got %+v", stored.Tasks)
+	}
+}
+
+func TestLoadData_LegacyCiphertextWithoutEncryption(t *testing.T) {
+	backend, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	// Data written before envelopes: nonce | sealed, without a header
+	block, _ := aes.NewCipher(bytes.Repeat([]byte{1}, 32))
+	gcm, _ := cipher.NewGCM(block)
+	nonce := make([]byte, gcm.NonceSize())
+	legacy := gcm.Seal(nonce, nonce, []byte(`{"tasks":[{"id":1,"title":"secret"}]}`), nil)
+	if err := backend.Save("todos.json", legacy); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	t.Cleanup(func() { store = nil })
+	store = newBlobStore(storage.NewStorageManager(backend, nil), "todos.json")
+
+	// nonce | sealed is not recognized as encrypted; falling back to the
+	// hints would overwrite it on the next save
+	if _, err := LoadData(); !errors.Is(err, ErrInvalidDocument) {
+		t.Fatalf("expected ErrInvalidDocument, got %v", err)
+	}
+}
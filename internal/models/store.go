@@ -0,0 +1,239 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/nirabyte/todo/internal/storage"
+)
+
+// dataStore persists AppData, either as a single blob or one record per task
+type dataStore interface {
+	Load() (AppData, error)
+	Save(data AppData) error
+}
+
+// blobStore keeps the whole AppData document under a single key
+type blobStore struct {
+	manager  *storage.StorageManager
+	key      string
+	saved    *AppData // last loaded or saved copy, for change tracking
+	revision uint64   // dataRevision when saved was loaded or written
+}
+
+func newBlobStore(manager *storage.StorageManager, key string) *blobStore {
+	return &blobStore{manager: manager, key: key}
+}
+
+// Load reads the document and upgrades it to CurrentSchemaVersion. The
+// pre-migration blob is kept under a versioned backup key, written once so
+// loading again before the first save does not rewrite it.
+func (bs *blobStore) Load() (AppData, error) {
+	var appData AppData
+	revision, _ := dataRevision()
+	raw, err := bs.manager.Load(bs.key)
+	if err != nil {
+		return appData, err
+	}
+
+	data, version, err := migrateAppData(raw)
+	if err != nil {
+		return appData, err
+	}
+
+	if version < CurrentSchemaVersion {
+		backupKey := fmt.Sprintf("%s.v%d.bak", bs.key, version)
+		exists, err := bs.manager.Exists(backupKey)
+		if err != nil {
+			return appData, fmt.Errorf("%w: failed to back up data first: %v", ErrMigrationFailed, err)
+		}
+		if !exists {
+			if err := bs.manager.Save(backupKey, raw); err != nil {
+				return appData, fmt.Errorf("%w: failed to back up data first: %v", ErrMigrationFailed, err)
+			}
+		}
+	}
+
+	if err := json.Unmarshal(data, &appData); err != nil {
+		return appData, fmt.Errorf("%w: %v", ErrInvalidDocument, err)
+	}
+
+	saved := appData
+	saved.Tasks = append([]Task(nil), appData.Tasks...)
+	bs.saved = &saved
+	bs.revision = revision
+	return appData, nil
+}
+
+// Save stamps changes since the last load or save (see trackChanges)
+// before writing the document. When the stored copy changed since, e.g.
+// merged by a sync while the model could not reload or written by another
+// client (storage.ErrModified), the changes are merged into it instead of
+// overwriting it.
+func (bs *blobStore) Save(data AppData) error {
+	revision, tracked := dataRevision()
+	data = trackChanges(bs.saved, data, time.Now())
+	if tracked && revision != bs.revision && bs.saved != nil {
+		current, ok, err := bs.loadCurrent()
+		if err != nil {
+			return fmt.Errorf("failed to merge with the stored data: %w", err)
+		}
+		if ok {
+			data = MergeAppData(bs.saved, data, current)
+		}
+	}
+	data.SchemaVersion = CurrentSchemaVersion
+	err := bs.write(data)
+	if errors.Is(err, storage.ErrModified) {
+		// Loading again picks up the other client's version tag
+		current, ok, loadErr := bs.loadCurrent()
+		if loadErr != nil {
+			return fmt.Errorf("failed to merge with the stored data: %w", loadErr)
+		}
+		if ok {
+			data = MergeAppData(bs.saved, data, current)
+		}
+		err = bs.write(data)
+	}
+	if err == nil || errors.Is(err, storage.ErrBackupFailed) {
+		bs.saved = &data
+		bs.revision = revision
+	}
+	return err
+}
+
+func (bs *blobStore) write(data AppData) error {
+	bytes, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return bs.manager.Save(bs.key, bytes)
+}
+
+// loadCurrent reads the stored document; ok is false when there is none
+func (bs *blobStore) loadCurrent() (AppData, bool, error) {
+	exists, err := bs.manager.Exists(bs.key)
+	if err != nil || !exists {
+		return AppData{}, false, err
+	}
+	raw, err := bs.manager.Load(bs.key)
+	if err != nil {
+		return AppData{}, false, err
+	}
+	data, err := decodeAppData(raw)
+	return data, err == nil, err
+}
+
+// recordStore keeps each task in its own record and only the settings
+// (theme, sort mode) in a small blob. Saves only write tasks that changed
+// since the last load or save.
+type recordStore struct {
+	records  *storage.RecordManager
+	settings *blobStore
+	legacy   *blobStore
+	saved    map[int64]Task
+}
+
+func newRecordStore(records *storage.RecordManager, manager *storage.StorageManager, settingsKey, legacyKey string) *recordStore {
+	return &recordStore{
+		records:  records,
+		settings: newBlobStore(manager, settingsKey),
+		legacy:   newBlobStore(manager, legacyKey),
+		saved:    make(map[int64]Task),
+	}
+}
+
+func (rs *recordStore) Load() (AppData, error) {
+	appData, settingsErr := rs.settings.Load()
+	if errors.Is(settingsErr, ErrNewerSchema) {
+		return appData, settingsErr
+	}
+
+	records, err := rs.records.ListTasks()
+	if err != nil {
+		return appData, err
+	}
+
+	// First run against an empty record store: import the existing blob so
+	// switching STORAGE_SCHEMA does not start from scratch. The imported
+	// tasks are written as records on the next save.
+	if settingsErr != nil && len(records) == 0 {
+		return rs.legacy.Load()
+	}
+	if settingsErr != nil {
+		appData = AppData{}
+	}
+
+	rs.saved = make(map[int64]Task, len(records))
+	appData.Tasks = make([]Task, 0, len(records))
+	for _, r := range records {
+		task := taskFromRecord(r)
+		appData.Tasks = append(appData.Tasks, task)
+		rs.saved[task.ID] = task
+	}
+	return appData, nil
+}
+
+func (rs *recordStore) Save(data AppData) error {
+	var errs []error
+	current := make(map[int64]Task, len(data.Tasks))
+	for _, task := range data.Tasks {
+		current[task.ID] = task
+		if prev, ok := rs.saved[task.ID]; ok && sameRecord(prev, task) {
+			continue
+		}
+		if err := rs.records.PutTask(recordFromTask(task)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		rs.saved[task.ID] = task
+	}
+
+	for id := range rs.saved {
+		if _, ok := current[id]; ok {
+			continue
+		}
+		if err := rs.records.DeleteTask(id); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(rs.saved, id)
+	}
+
+	settings := AppData{ThemeIndex: data.ThemeIndex, SortMode: data.SortMode}
+	if err := rs.settings.Save(settings); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+func taskFromRecord(r storage.TaskRecord) Task {
+	return Task{
+		ID:       r.ID,
+		Title:    r.Title,
+		Done:     r.Done,
+		DueAt:    r.DueAt,
+		Notified: r.Notified,
+	}
+}
+
+func recordFromTask(t Task) storage.TaskRecord {
+	return storage.TaskRecord{
+		ID:       t.ID,
+		Title:    t.Title,
+		Done:     t.Done,
+		DueAt:    t.DueAt,
+		Notified: t.Notified,
+	}
+}
+
+// sameRecord reports whether two tasks have identical persisted fields
+func sameRecord(a, b Task) bool {
+	return a.Title == b.Title &&
+		a.Done == b.Done &&
+		a.DueAt.Equal(b.DueAt) &&
+		a.Notified == b.Notified
+}
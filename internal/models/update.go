@@ -13,6 +13,9 @@ import (
 )
 
 func (m *Model) Init() tea.Cmd {
+	if _, ok := dataRevision(); ok {
+		return tea.Batch(textinput.Blink, syncTickCmd())
+	}
 	return textinput.Blink
 }
 
@@ -22,6 +25,12 @@ func tickCmd() tea.Cmd {
 	})
 }
 
+func syncTickCmd() tea.Cmd {
+	return tea.Tick(time.Second, func(t time.Time) tea.Msg {
+		return SyncTickMsg{}
+	})
+}
+
 func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	var cmds []tea.Cmd
@@ -35,6 +44,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				val := m.TextInput.Value()
 
 				if m.State == StateSettingTime {
+					prevDue := m.Tasks[m.Cursor].DueAt
 					if val != "" {
 						dur, err := time.ParseDuration(val)
 						if err == nil {
@@ -46,6 +56,9 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					} else {
 						m.Tasks[m.Cursor].DueAt = time.Time{}
 					}
+					if !m.Tasks[m.Cursor].DueAt.Equal(prevDue) {
+						m.audit(AuditDue, m.Tasks[m.Cursor], formatDue(prevDue), formatDue(m.Tasks[m.Cursor].DueAt))
+					}
 					m.Save()
 					m.State = StateBrowse
 					m.TextInput.Blur()
@@ -60,10 +73,12 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 
 				if m.State == StateCreating {
-					m.Tasks = append(m.Tasks, Task{
+					task := Task{
 						ID:    time.Now().UnixNano(),
 						Title: val,
-					})
+					}
+					m.Tasks = append(m.Tasks, task)
+					m.audit(AuditCreate, task, "", "")
 					if m.SortMode != SortOff {
 						m.ApplySort()
 					}
@@ -75,7 +90,10 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					}
 					return m, nil
 				} else {
-					m.Tasks[m.Cursor].Title = val
+					if prev := m.Tasks[m.Cursor].Title; prev != val {
+						m.Tasks[m.Cursor].Title = val
+						m.audit(AuditEdit, m.Tasks[m.Cursor], prev, val)
+					}
 					m.Save()
 					m.State = StateBrowse
 					m.TextInput.Blur()
@@ -91,6 +109,11 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m, cmd
 		}
 
+		if m.State == StateRestoring {
+			return m.updateRestoring(msg)
+		}
+		m.Notice = ""
+
 		switch msg.String() {
 		case "q", "ctrl+c":
 			m.Save()
@@ -141,6 +164,18 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, textinput.Blink
 			}
 
+		case "b":
+			backups, err := ListBackups()
+			if err != nil {
+				m.Notice = err.Error()
+			} else if len(backups) == 0 {
+				m.Notice = "No backups yet"
+			} else {
+				m.Backups = backups
+				m.BackupCursor = 0
+				m.State = StateRestoring
+			}
+
 		case "d":
 			if len(m.Tasks) > 0 {
 				m.Tasks[m.Cursor].IsDeleting = true
@@ -169,6 +204,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				} else {
 					t.IsAnimatingCheck = false
 				}
+				m.audit(AuditToggle, *t, formatDone(!t.Done), formatDone(t.Done))
 				m.ApplySort()
 				m.Save()
 			}
@@ -179,6 +215,18 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.Height = msg.Height
 		m.TextInput.Width = msg.Width - 10
 
+	case SyncTickMsg:
+		if revision, ok := dataRevision(); ok && revision != m.SyncRevision && m.canReload() {
+			m.SyncRevision = revision
+			data, err := store.Load()
+			if err != nil {
+				m.Notice = "Reload failed: " + err.Error()
+			} else {
+				m.applyData(data)
+			}
+		}
+		cmds = append(cmds, syncTickCmd())
+
 	case TickMsg:
 		needsTick := false
 		for i := len(m.Tasks) - 1; i >= 0; i-- {
@@ -187,6 +235,7 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Animations
 			if t.IsDeleting {
 				if time.Since(t.AnimStart) > config.DeleteAnimDuration {
+					m.audit(AuditDelete, *t, "", "")
 					m.Tasks = append(m.Tasks[:i], m.Tasks[i+1:]...)
 					if m.Cursor >= len(m.Tasks) && m.Cursor > 0 {
 						m.Cursor--
@@ -221,3 +270,68 @@ func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	return m, tea.Batch(cmds...)
 }
 
+func (m *Model) updateRestoring(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.Save()
+		return m, tea.Quit
+
+	case "up", "k":
+		if m.BackupCursor > 0 {
+			m.BackupCursor--
+		}
+	case "down", "j":
+		if m.BackupCursor < len(m.Backups)-1 {
+			m.BackupCursor++
+		}
+
+	case "enter":
+		id := m.Backups[m.BackupCursor].ID
+		data, err := RestoreBackup(id)
+		if err != nil {
+			m.Notice = "Restore failed: " + err.Error()
+		} else {
+			m.applyData(data)
+			m.Cursor = 0
+			m.Notice = "Restored backup " + id
+			m.audit(AuditRestore, Task{}, "", id)
+		}
+		m.State = StateBrowse
+		m.Backups = nil
+
+	case "esc", "q":
+		m.State = StateBrowse
+		m.Backups = nil
+	}
+	return m, nil
+}
+
+// applyData replaces the tasks and settings with stored data, e.g. after a
+// restore or a sync that merged changes from another device
+func (m *Model) applyData(data AppData) {
+	m.Tasks = data.Tasks
+	m.SortMode = data.SortMode
+	m.ThemeIndex = data.ThemeIndex
+	if m.ThemeIndex >= len(themes.All) {
+		m.ThemeIndex = 0
+	}
+	styles.Update(themes.All[m.ThemeIndex])
+	m.ApplySort()
+	if m.Cursor >= len(m.Tasks) {
+		m.Cursor = max(len(m.Tasks)-1, 0)
+	}
+}
+
+// canReload reports whether the tasks can be replaced without disturbing
+// an edit or a running animation
+func (m *Model) canReload() bool {
+	if m.State != StateBrowse || store == nil {
+		return false
+	}
+	for _, t := range m.Tasks {
+		if t.IsDeleting || t.IsAnimatingCheck {
+			return false
+		}
+	}
+	return true
+}
@@ -14,7 +14,11 @@ func (m *Model) View() string {
 	currentTheme := themes.All[m.ThemeIndex]
 	var content string
 
-	content = m.viewList(currentTheme)
+	if m.State == StateRestoring {
+		content = m.viewBackups(currentTheme)
+	} else {
+		content = m.viewList(currentTheme)
+	}
 
 	header := styles.HeaderStyle.Render("// TODO LIST")
 
@@ -33,7 +37,19 @@ func (m *Model) View() string {
 		sortStr = "Done"
 	}
 
-	help := fmt.Sprintf("Theme: %s (t) • Sort: %s (s) • New (n) • Edit (e) • Check (Space) • Notify (@) • Del (d)", currentTheme.Name, sortStr)
+	help := fmt.Sprintf("Theme: %s (t) • Sort: %s (s) • New (n) • Edit (e) • Check (Space) • Notify (@) • Del (d) • Backups (b)", currentTheme.Name, sortStr)
+	if sync := syncSummary(); sync != "" {
+		help += " • " + sync
+	}
+	if fp := KeyFingerprint(); fp != "" {
+		help += " • Key " + fp
+	}
+	if m.State == StateRestoring {
+		help = "Select backup (↑/↓) • Restore (Enter) • Cancel (Esc)"
+	}
+	if m.Notice != "" {
+		help = m.Notice
+	}
 	status := styles.HelpStyle.Render(help)
 
 	ui := lipgloss.JoinVertical(lipgloss.Center, header, container, status)
@@ -143,6 +159,66 @@ func (m *Model) viewList(t themes.Theme) string {
 	return s.String()
 }
 
+func (m *Model) viewBackups(t themes.Theme) string {
+	var s strings.Builder
+
+	s.WriteString(lipgloss.NewStyle().Foreground(t.Accent).Render("Restore a backup"))
+	s.WriteString("\n\n")
+
+	// Container height (see View) less the title above
+	start, end := visibleRange(len(m.Backups), m.BackupCursor, m.Height-7-2)
+	for i := start; i < end; i++ {
+		b := m.Backups[i]
+		numberStr := fmt.Sprintf("%d.", i+1)
+		row := lipgloss.JoinHorizontal(lipgloss.Top,
+			lipgloss.NewStyle().Foreground(t.Dim).Width(4).Align(lipgloss.Right).Render(numberStr),
+			" ",
+			lipgloss.NewStyle().Foreground(t.Fg).Render(b.Time.Local().Format(time.DateTime)),
+			"   ",
+			lipgloss.NewStyle().Foreground(t.Dim).Render(shortDur(time.Since(b.Time))+" ago"),
+		)
+
+		if i == m.BackupCursor {
+			s.WriteString(styles.ListSelectedStyle.Render(row))
+		} else {
+			s.WriteString(styles.ListItemStyle.Render(row))
+		}
+		s.WriteString("\n")
+	}
+	return s.String()
+}
+
+// visibleRange returns the rows [start, end) of a list of count rows that
+// fit in height lines, scrolled to keep the cursor in the middle when it can
+func visibleRange(count, cursor, height int) (start, end int) {
+	height = max(height, 1)
+	if count <= height {
+		return 0, count
+	}
+	start = min(max(cursor-height/2, 0), count-height)
+	return start, start + height
+}
+
+// syncSummary describes the offline cache state, or "" when it is disabled
+func syncSummary() string {
+	status, ok := SyncStatus()
+	if !ok {
+		return ""
+	}
+
+	summary := "Synced"
+	if status.Pending > 0 {
+		summary = fmt.Sprintf("%d pending", status.Pending)
+	}
+	if !status.Online {
+		summary += " (offline)"
+	}
+	if status.Conflicts > 0 {
+		summary += fmt.Sprintf(", %d conflicts", status.Conflicts)
+	}
+	return "Sync: " + summary
+}
+
 func shortDur(d time.Duration) string {
 	d = d.Round(time.Second)
 	h := int(d.Hours())
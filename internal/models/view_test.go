@@ -0,0 +1,30 @@
+package models
+
+import "testing"
+
+func TestVisibleRange(t *testing.T) {
+	tests := []struct {
+		name                  string
+		count, cursor, height int
+		start, end            int
+	}{
+		{"fits", 3, 2, 10, 0, 3},
+		{"empty", 0, 0, 10, 0, 0},
+		{"cursor at top", 50, 0, 10, 0, 10},
+		{"cursor in middle", 50, 25, 10, 20, 30},
+		{"cursor at bottom", 50, 49, 10, 40, 50},
+		{"no room", 50, 7, -3, 7, 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := visibleRange(tt.count, tt.cursor, tt.height)
+			if start != tt.start || end != tt.end {
+				t.Fatalf("visibleRange(%d, %d, %d) = %d, %d, expected %d, %d",
+					tt.count, tt.cursor, tt.height, start, end, tt.start, tt.end)
+			}
+			if tt.count > 0 && (tt.cursor < start || tt.cursor >= end) {
+				t.Fatalf("cursor %d is not in [%d, %d)", tt.cursor, start, end)
+			}
+		})
+	}
+}
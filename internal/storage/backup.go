@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrBackupFailed wraps snapshot errors returned by Save and Update. The
+// data itself was saved successfully when they return an error matching it.
+var ErrBackupFailed = errors.New("backup failed")
+
+// backupTimeFormat is the timestamp suffix of snapshot keys, which doubles
+// as the backup ID shown to users
+const backupTimeFormat = "20060102T150405Z"
+
+// BackupPolicy controls automatic snapshots taken by StorageManager.Save.
+// A snapshot of a key is stored as <Prefix><key>.<timestamp>.
+type BackupPolicy struct {
+	Prefix   string        // key prefix for snapshots, e.g. "backup."
+	Keys     []string      // keys to snapshot; every saved key when empty
+	Interval time.Duration // minimum time between snapshots of a key
+	Recent   int           // always keep the newest N snapshots
+	Hourly   int           // keep the newest snapshot of each of the last N hours
+	Daily    int           // keep the newest snapshot of each of the last N days
+	// With Recent, Hourly and Daily all zero every snapshot is kept
+}
+
+// Backup is a single stored snapshot
+type Backup struct {
+	ID   string
+	Key  string
+	Time time.Time
+}
+
+// EnableBackups turns on automatic snapshots for subsequent saves
+func (sm *StorageManager) EnableBackups(policy BackupPolicy) {
+	sm.backups = &policy
+	sm.lastBackup = make(map[string]time.Time)
+}
+
+// Backups lists the snapshots of key, newest first
+func (sm *StorageManager) Backups(key string) ([]Backup, error) {
+	if sm.backups == nil {
+		return nil, errors.New("backups are not enabled")
+	}
+
+	prefix := sm.backupKey(key, "")
+	keys, err := sm.List(prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var backups []Backup
+	for _, k := range keys {
+		id := strings.TrimPrefix(k, prefix)
+		t, err := time.Parse(backupTimeFormat, id)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, Backup{ID: id, Key: key, Time: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Time.After(backups[j].Time) })
+	return backups, nil
+}
+
+// LoadBackup returns the decrypted contents of a snapshot
+func (sm *StorageManager) LoadBackup(key, id string) ([]byte, error) {
+	if sm.backups == nil {
+		return nil, errors.New("backups are not enabled")
+	}
+	if _, err := time.Parse(backupTimeFormat, id); err != nil {
+		return nil, fmt.Errorf("invalid backup id %q", id)
+	}
+	return sm.Load(sm.backupKey(key, id))
+}
+
+// RestoreBackup replaces key with the contents of a snapshot. The current
+// data is snapshotted first so the restore itself can be undone.
+func (sm *StorageManager) RestoreBackup(key, id string) error {
+	data, err := sm.LoadBackup(key, id)
+	if err != nil {
+		return fmt.Errorf("failed to read backup %s: %w", id, err)
+	}
+
+	if current, err := sm.Load(key); err == nil {
+		if err := sm.snapshot(key, current); err != nil {
+			return fmt.Errorf("failed to snapshot current data before restore: %w", err)
+		}
+	}
+
+	return sm.Save(key, data)
+}
+
+// maybeSnapshot takes a snapshot of key if the policy covers it and the
+// interval has passed since the last one, then prunes old snapshots
+func (sm *StorageManager) maybeSnapshot(key string, data []byte) error {
+	policy := sm.backups
+	if policy == nil || strings.HasPrefix(key, policy.Prefix) || !policy.covers(key) {
+		return nil
+	}
+
+	last, ok := sm.lastBackup[key]
+	if !ok {
+		backups, err := sm.Backups(key)
+		if err != nil {
+			return err
+		}
+		if len(backups) > 0 {
+			last = backups[0].Time
+		}
+	}
+	// Snapshot IDs have second resolution, so never take two in one second
+	interval := max(policy.Interval, time.Second)
+	if !last.IsZero() && sm.now().Sub(last) < interval {
+		sm.lastBackup[key] = last
+		return nil
+	}
+
+	return sm.snapshot(key, data)
+}
+
+func (sm *StorageManager) snapshot(key string, data []byte) error {
+	now := sm.now().UTC().Truncate(time.Second)
+	if err := sm.Save(sm.backupKey(key, now.Format(backupTimeFormat)), data); err != nil {
+		return err
+	}
+	sm.lastBackup[key] = now
+	return sm.pruneBackups(key)
+}
+
+// pruneBackups deletes snapshots of key that the retention policy does not keep
+func (sm *StorageManager) pruneBackups(key string) error {
+	backups, err := sm.Backups(key)
+	if err != nil {
+		return err
+	}
+
+	keep := sm.backups.retain(backups)
+	var errs []error
+	for _, b := range backups {
+		if keep[b.ID] {
+			continue
+		}
+		if err := sm.Delete(sm.backupKey(key, b.ID)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (sm *StorageManager) backupKey(key, id string) string {
+	return sm.backups.Prefix + key + "." + id
+}
+
+func (sm *StorageManager) now() time.Time {
+	if sm.clock != nil {
+		return sm.clock()
+	}
+	return time.Now()
+}
+
+func (p *BackupPolicy) covers(key string) bool {
+	if len(p.Keys) == 0 {
+		return true
+	}
+	for _, k := range p.Keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// retain returns the IDs of the snapshots to keep; backups must be sorted
+// newest first
+func (p *BackupPolicy) retain(backups []Backup) map[string]bool {
+	keep := make(map[string]bool)
+
+	// Without any retention limits nothing is rotated out
+	if p.Recent <= 0 && p.Hourly <= 0 && p.Daily <= 0 {
+		for _, b := range backups {
+			keep[b.ID] = true
+		}
+		return keep
+	}
+	for i := 0; i < len(backups) && i < p.Recent; i++ {
+		keep[backups[i].ID] = true
+	}
+
+	keepNewestPer := func(limit int, bucket func(time.Time) time.Time) {
+		seen := make(map[time.Time]bool)
+		for _, b := range backups {
+			if len(seen) >= limit {
+				return
+			}
+			slot := bucket(b.Time)
+			if seen[slot] {
+				continue
+			}
+			seen[slot] = true
+			keep[b.ID] = true
+		}
+	}
+	keepNewestPer(p.Hourly, func(t time.Time) time.Time { return t.Truncate(time.Hour) })
+	keepNewestPer(p.Daily, func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	})
+
+	return keep
+}
@@ -0,0 +1,149 @@
+package storage
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newBackupManager(t *testing.T, policy BackupPolicy) (*StorageManager, *mockStorage, *time.Time) {
+	t.Helper()
+
+	st := newMockStorage()
+	sm := NewStorageManager(st, nil)
+	sm.EnableBackups(policy)
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	sm.clock = func() time.Time { return now }
+	return sm, st, &now
+}
+
+func TestStorageManager_Backup_Interval(t *testing.T) {
+	sm, _, now := newBackupManager(t, BackupPolicy{Prefix: "backup.", Interval: time.Hour, Recent: 10})
+
+	_ = sm.Save("todos.json", []byte("v1"))
+	*now = now.Add(10 * time.Minute)
+	_ = sm.Save("todos.json", []byte("v2"))
+
+	backups, err := sm.Backups("todos.json")
+	if err != nil {
+		t.Fatalf("list backups failed: %v", err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("expected 1 backup within the interval, got %d", len(backups))
+	}
+
+	*now = now.Add(time.Hour)
+	_ = sm.Save("todos.json", []byte("v3"))
+
+	backups, _ = sm.Backups("todos.json")
+	if len(backups) != 2 {
+		t.Fatalf("expected 2 backups, got %d", len(backups))
+	}
+	if backups[0].ID != "20261018T131000Z" {
+		t.Fatalf("expected newest first, got %s", backups[0].ID)
+	}
+
+	data, err := sm.LoadBackup("todos.json", backups[0].ID)
+	if err != nil || string(data) != "v3" {
+		t.Fatalf("unexpected backup data: %q, %v", data, err)
+	}
+}
+
+func TestStorageManager_Backup_OnlyConfiguredKeys(t *testing.T) {
+	sm, st, _ := newBackupManager(t, BackupPolicy{Prefix: "backup.", Keys: []string{"todos.json"}, Recent: 10})
+
+	_ = sm.Save("other.json", []byte("v"))
+	_ = sm.Save("todos.json", []byte("v"))
+
+	if len(st.data) != 3 {
+		t.Fatalf("expected only todos.json to be snapshotted, got keys %v", st.data)
+	}
+}
+
+func TestStorageManager_Backup_Retention(t *testing.T) {
+	sm, _, now := newBackupManager(t, BackupPolicy{Prefix: "backup.", Recent: 2, Hourly: 3, Daily: 2})
+
+	start := *now
+	// One snapshot every 20 minutes for two days
+	for i := 0; i < 6*24; i++ {
+		*now = start.Add(time.Duration(i) * 20 * time.Minute)
+		if err := sm.Save("todos.json", []byte("v")); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	backups, _ := sm.Backups("todos.json")
+	// 2 recent (both in the latest hour) + newest of 2 earlier hours + newest of the previous day
+	if len(backups) != 5 {
+		for _, b := range backups {
+			t.Logf("kept %s", b.ID)
+		}
+		t.Fatalf("expected 5 backups after pruning, got %d", len(backups))
+	}
+}
+
+func TestStorageManager_RestoreBackup(t *testing.T) {
+	sm, _, now := newBackupManager(t, BackupPolicy{Prefix: "backup.", Recent: 10})
+
+	_ = sm.Save("todos.json", []byte("old"))
+	backups, _ := sm.Backups("todos.json")
+	oldID := backups[0].ID
+
+	*now = now.Add(time.Minute)
+	_ = sm.Save("todos.json", []byte("new"))
+
+	*now = now.Add(time.Minute)
+	if err := sm.RestoreBackup("todos.json", oldID); err != nil {
+		t.Fatalf("restore failed: %v", err)
+	}
+
+	data, _ := sm.Load("todos.json")
+	if string(data) != "old" {
+		t.Fatalf("expected restored data, got %q", data)
+	}
+
+	backups, _ = sm.Backups("todos.json")
+	pre, err := sm.LoadBackup("todos.json", backups[0].ID)
+	if err != nil || string(pre) != "new" {
+		t.Fatalf("expected pre-restore snapshot of current data, got %q, %v", pre, err)
+	}
+}
+
+func TestStorageManager_RestoreBackup_InvalidID(t *testing.T) {
+	sm, _, _ := newBackupManager(t, BackupPolicy{Prefix: "backup."})
+
+	if err := sm.RestoreBackup("todos.json", "../../etc"); err == nil {
+		t.Fatalf("expected invalid id error")
+	}
+}
+
+func TestStorageManager_Backups_Disabled(t *testing.T) {
+	sm := NewStorageManager(newMockStorage(), nil)
+
+	if _, err := sm.Backups("todos.json"); err == nil {
+		t.Fatalf("expected error when backups are disabled")
+	}
+}
+
+func TestStorageManager_Backup_ErrorDoesNotFailSave(t *testing.T) {
+	st := newMockStorage()
+	sm := NewStorageManager(&failingListStorage{st}, nil)
+	sm.EnableBackups(BackupPolicy{Prefix: "backup."})
+
+	err := sm.Save("todos.json", []byte("v"))
+	if !errors.Is(err, ErrBackupFailed) {
+		t.Fatalf("expected ErrBackupFailed, got %v", err)
+	}
+	if string(st.data["todos.json"]) != "v" {
+		t.Fatalf("data should still be saved")
+	}
+}
+
+type failingListStorage struct {
+	*mockStorage
+}
+
+func (f *failingListStorage) List(prefix string) ([]string, error) {
+	return nil, errors.New("list error")
+}
@@ -0,0 +1,653 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// syncStateKey holds the pending queue and last synced hashes in the cache,
+// and syncBasePrefix the last synced copy of each key for three-way merges.
+// Both are hidden from List.
+const (
+	syncStateKey   = ".sync-state.json"
+	syncBasePrefix = ".sync-base."
+	conflictInfix  = ".conflict."
+)
+
+// IsCacheStateKey reports whether key is sync state that CachedStorage
+// keeps in the local store next to the cached keys
+func IsCacheStateKey(key string) bool {
+	return key == syncStateKey || strings.HasPrefix(key, syncBasePrefix)
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+// After a failed dial the remote is not dialed again for dialBackoffMin,
+// doubling up to dialBackoffMax, so an unreachable remote does not make
+// every cache miss wait for a connect timeout
+const (
+	dialBackoffMin = time.Second
+	dialBackoffMax = time.Minute
+)
+
+// ConflictFunc resolves a key changed both locally and remotely since the
+// last sync. It gets the (encrypted) contents at the last sync, nil when
+// unknown, and the local and remote contents, and returns the data to store
+// on both sides.
+type ConflictFunc func(key string, base, local, remote []byte) ([]byte, error)
+
+// ErrConflictUnresolved is returned by a ConflictFunc to fall back to the
+// default handling for a key
+var ErrConflictUnresolved = errors.New("conflict not resolved")
+
+// SyncStatus describes the state of a CachedStorage for display
+type SyncStatus struct {
+	Online    bool
+	Pending   int
+	Conflicts int
+	LastSync  time.Time
+	LastError error
+
+	// Revision is bumped whenever a sync changes the local copy of a key,
+	// so callers know to reload
+	Revision uint64
+}
+
+// syncState is persisted in the cache so pending changes survive restarts
+type syncState struct {
+	Base    map[string]string `json:"base"`    // hash of the remote copy at the last sync
+	Pending map[string]string `json:"pending"` // key -> opPut or opDelete
+}
+
+// CachedStorage is an offline-first Storage. Reads and writes go to a local
+// cache; changes are queued and pushed to the remote backend by Sync, which
+// runs in the background after Start. The remote is dialed lazily so the app
+// starts without a network.
+//
+// A key changed on both sides is passed to the ConflictFunc. Without one,
+// the local copy wins and the remote copy is kept as <key>.conflict.<time>.
+type CachedStorage struct {
+	operationScope
+
+	local   Storage
+	dial    func() (Storage, error)
+	resolve ConflictFunc
+
+	mu       sync.Mutex
+	remote   Storage
+	state    syncState
+	seq      map[string]uint64 // bumped on every local change to detect saves during a push
+	watched  map[string]bool   // keys read this session, refreshed from the remote on sync
+	status   SyncStatus
+	nextDial time.Time     // no dial before this after a failure
+	backoff  time.Duration // wait after the last failed dial
+
+	dialMu sync.Mutex // serializes dials; never held with mu while dialing
+
+	syncMu sync.Mutex // serializes Sync
+	kick   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	clock  func() time.Time
+}
+
+// NewCachedStorage creates a cache in local that syncs to the backend
+// returned by dial
+func NewCachedStorage(local Storage, dial func() (Storage, error)) (*CachedStorage, error) {
+	cs := &CachedStorage{
+		operationScope: newOperationScope(),
+		local:          local,
+		dial:           dial,
+		state:          syncState{Base: make(map[string]string), Pending: make(map[string]string)},
+		seq:            make(map[string]uint64),
+		watched:        make(map[string]bool),
+		kick:           make(chan struct{}, 1),
+	}
+
+	exists, err := local.Exists(syncStateKey)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		raw, err := local.Load(syncStateKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &cs.state); err != nil {
+			return nil, fmt.Errorf("invalid sync state: %w", err)
+		}
+		if cs.state.Base == nil {
+			cs.state.Base = make(map[string]string)
+		}
+		if cs.state.Pending == nil {
+			cs.state.Pending = make(map[string]string)
+		}
+	}
+	cs.status.Pending = len(cs.state.Pending)
+	return cs, nil
+}
+
+// SetConflictFunc sets the resolver for keys changed on both sides
+func (cs *CachedStorage) SetConflictFunc(resolve ConflictFunc) {
+	cs.resolve = resolve
+}
+
+// Start syncs every interval, and shortly after each local change, until Close
+func (cs *CachedStorage) Start(interval time.Duration) {
+	if cs.stop != nil {
+		return
+	}
+	cs.stop = make(chan struct{})
+	cs.done = make(chan struct{})
+
+	go func() {
+		defer close(cs.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := cs.Sync(); err != nil {
+				log.Printf("Sync failed: %v", err)
+			}
+			select {
+			case <-cs.stop:
+				return
+			case <-ticker.C:
+			case <-cs.kick:
+			}
+		}
+	}()
+}
+
+// Status returns a snapshot of the sync state
+func (cs *CachedStorage) Status() SyncStatus {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.status
+}
+
+func (cs *CachedStorage) Load(key string) ([]byte, error) {
+	cs.mu.Lock()
+	cs.watched[key] = true
+	exists, err := cs.local.Exists(key)
+	if err != nil || exists {
+		defer cs.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		return cs.local.Load(key)
+	}
+	if cs.state.Pending[key] == opDelete {
+		cs.mu.Unlock()
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+	cs.mu.Unlock()
+
+	// Not cached yet: fetch it from the remote
+	remote, err := cs.connect()
+	if err != nil {
+		return nil, err
+	}
+	data, found, err := cs.remoteLoad(remote, key)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if _, pending := cs.state.Pending[key]; !pending {
+		if err := cs.local.Save(key, data); err != nil {
+			return nil, err
+		}
+		if err := cs.setBase(key, data); err != nil {
+			return nil, err
+		}
+		if err := cs.saveState(); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+func (cs *CachedStorage) Save(key string, data []byte) error {
+	cs.mu.Lock()
+	if err := cs.local.Save(key, data); err != nil {
+		cs.mu.Unlock()
+		return err
+	}
+	err := cs.queue(key, opPut)
+	cs.mu.Unlock()
+	cs.trigger()
+	return err
+}
+
+func (cs *CachedStorage) Delete(key string) error {
+	cs.mu.Lock()
+	exists, err := cs.local.Exists(key)
+	if err == nil && exists {
+		err = cs.local.Delete(key)
+	}
+	if err != nil {
+		cs.mu.Unlock()
+		return err
+	}
+	err = cs.queue(key, opDelete)
+	cs.mu.Unlock()
+	cs.trigger()
+	return err
+}
+
+func (cs *CachedStorage) Exists(key string) (bool, error) {
+	cs.mu.Lock()
+	exists, err := cs.local.Exists(key)
+	deleted := cs.state.Pending[key] == opDelete
+	cs.mu.Unlock()
+	if err != nil || exists || deleted {
+		return exists, err
+	}
+
+	remote, err := cs.connect()
+	if err != nil {
+		return false, err
+	}
+	_, found, err := cs.remoteLoad(remote, key)
+	return found, err
+}
+
+// List merges the cached keys with the remote ones when it is reachable
+func (cs *CachedStorage) List(prefix string) ([]string, error) {
+	cs.mu.Lock()
+	localKeys, err := cs.local.List(prefix)
+	pending := make(map[string]string, len(cs.state.Pending))
+	for k, op := range cs.state.Pending {
+		pending[k] = op
+	}
+	cs.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, k := range localKeys {
+		if !strings.HasPrefix(k, ".sync-") {
+			seen[k] = true
+		}
+	}
+	if remote, err := cs.connect(); err == nil {
+		ctx, cancel := cs.operationContext()
+		remoteKeys, err := listContext(ctx, remote, prefix)
+		cancel()
+		cs.setError(err)
+		for _, k := range remoteKeys {
+			if pending[k] != opDelete {
+				seen[k] = true
+			}
+		}
+	}
+
+	keys := make([]string, 0, len(seen))
+	for k := range seen {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close stops the background sync, pushes pending changes one last time and
+// closes both sides
+func (cs *CachedStorage) Close() error {
+	if cs.stop != nil {
+		close(cs.stop)
+		<-cs.done
+		cs.stop = nil
+	}
+	syncErr := cs.Sync()
+
+	cs.mu.Lock()
+	remote := cs.remote
+	cs.remote = nil
+	cs.mu.Unlock()
+
+	var closeErr error
+	if remote != nil {
+		closeErr = remote.Close()
+	}
+	return errors.Join(syncErr, closeErr, cs.local.Close())
+}
+
+// Sync pushes queued changes to the remote and refreshes keys read this
+// session that changed remotely
+func (cs *CachedStorage) Sync() error {
+	cs.syncMu.Lock()
+	defer cs.syncMu.Unlock()
+
+	remote, err := cs.connect()
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	pending := make(map[string]string, len(cs.state.Pending))
+	seqs := make(map[string]uint64, len(cs.state.Pending))
+	for k, op := range cs.state.Pending {
+		pending[k] = op
+		seqs[k] = cs.seq[k]
+	}
+	var watched []string
+	for k := range cs.watched {
+		if _, ok := pending[k]; !ok {
+			watched = append(watched, k)
+		}
+	}
+	cs.mu.Unlock()
+
+	keys := make([]string, 0, len(pending))
+	for k := range pending {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		if err := cs.push(remote, key, pending[key], seqs[key]); err != nil {
+			errs = append(errs, fmt.Errorf("push %s: %w", key, err))
+		}
+	}
+	sort.Strings(watched)
+	for _, key := range watched {
+		if err := cs.pull(remote, key); err != nil {
+			errs = append(errs, fmt.Errorf("pull %s: %w", key, err))
+		}
+	}
+
+	err = errors.Join(errs...)
+	cs.mu.Lock()
+	if err == nil {
+		cs.status.LastSync = cs.now()
+	}
+	cs.mu.Unlock()
+	cs.setError(err)
+	return err
+}
+
+// push sends one queued change. seq is the change counter when the queue
+// was read; a newer local change keeps the key queued.
+func (cs *CachedStorage) push(remote Storage, key, op string, seq uint64) error {
+	remoteData, found, err := cs.remoteLoad(remote, key)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	base := cs.state.Base[key]
+	cs.mu.Unlock()
+	remoteChanged := found && hashData(remoteData) != base
+
+	if op == opDelete {
+		if remoteChanged && base != "" {
+			// Changed remotely after we last saw it: keep the remote copy
+			return cs.finish(key, seq, remoteData, true)
+		}
+		if found {
+			ctx, cancel := cs.operationContext()
+			err := deleteContext(ctx, remote, key)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+		return cs.finish(key, seq, nil, false)
+	}
+
+	cs.mu.Lock()
+	localData, err := cs.local.Load(key)
+	cs.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	data := localData
+	if remoteChanged && hashData(remoteData) != hashData(localData) {
+		data, err = cs.resolveConflict(remote, key, localData, remoteData)
+		if err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := cs.operationContext()
+	err = saveContext(ctx, remote, key, data)
+	cancel()
+	if err != nil {
+		return err
+	}
+	return cs.finish(key, seq, data, !bytes.Equal(data, localData))
+}
+
+// finish records a pushed key. data is the remote contents (nil when
+// deleted); writeLocal copies it into the cache unless the key changed
+// locally in the meantime.
+func (cs *CachedStorage) finish(key string, seq uint64, data []byte, writeLocal bool) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err := cs.setBase(key, data); err != nil {
+		return err
+	}
+	if cs.seq[key] == seq {
+		delete(cs.state.Pending, key)
+		if writeLocal {
+			if err := cs.local.Save(key, data); err != nil {
+				return err
+			}
+			cs.status.Revision++
+		}
+	}
+	cs.status.Pending = len(cs.state.Pending)
+	return cs.saveState()
+}
+
+// pull refreshes a cached key that has no local changes
+func (cs *CachedStorage) pull(remote Storage, key string) error {
+	data, found, err := cs.remoteLoad(remote, key)
+	if err != nil {
+		return err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if _, pending := cs.state.Pending[key]; pending {
+		return nil
+	}
+	base, known := cs.state.Base[key]
+	switch {
+	case !found && known:
+		// The remote positively reported the key missing (see remoteLoad)
+		if err := cs.setBase(key, nil); err != nil {
+			return err
+		}
+		if exists, err := cs.local.Exists(key); err != nil {
+			return err
+		} else if exists {
+			if err := cs.local.Delete(key); err != nil {
+				return err
+			}
+		}
+		cs.status.Revision++
+	case found && hashData(data) != base:
+		if err := cs.local.Save(key, data); err != nil {
+			return err
+		}
+		if err := cs.setBase(key, data); err != nil {
+			return err
+		}
+		cs.status.Revision++
+	default:
+		return nil
+	}
+	return cs.saveState()
+}
+
+func (cs *CachedStorage) resolveConflict(remote Storage, key string, localData, remoteData []byte) ([]byte, error) {
+	cs.mu.Lock()
+	cs.status.Conflicts++
+	cs.mu.Unlock()
+
+	if cs.resolve != nil {
+		cs.mu.Lock()
+		base, err := cs.loadBase(key)
+		cs.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+		data, err := cs.resolve(key, base, localData, remoteData)
+		if !errors.Is(err, ErrConflictUnresolved) {
+			return data, err
+		}
+	}
+
+	conflictKey := key + conflictInfix + cs.now().UTC().Format(backupTimeFormat)
+	log.Printf("Sync conflict on %s: keeping the local copy, remote copy saved as %s", key, conflictKey)
+	ctx, cancel := cs.operationContext()
+	defer cancel()
+	if err := saveContext(ctx, remote, conflictKey, remoteData); err != nil {
+		return nil, err
+	}
+	return localData, nil
+}
+
+// queue records a local change; the caller holds cs.mu
+func (cs *CachedStorage) queue(key, op string) error {
+	cs.state.Pending[key] = op
+	cs.seq[key]++
+	cs.status.Pending = len(cs.state.Pending)
+	return cs.saveState()
+}
+
+// setBase records data as the last synced copy of key, or forgets it when
+// data is nil; the caller holds cs.mu
+func (cs *CachedStorage) setBase(key string, data []byte) error {
+	if data != nil {
+		cs.state.Base[key] = hashData(data)
+		return cs.local.Save(syncBasePrefix+key, data)
+	}
+
+	delete(cs.state.Base, key)
+	exists, err := cs.local.Exists(syncBasePrefix + key)
+	if err != nil || !exists {
+		return err
+	}
+	return cs.local.Delete(syncBasePrefix + key)
+}
+
+// loadBase returns the last synced copy of key, or nil when there is none;
+// the caller holds cs.mu
+func (cs *CachedStorage) loadBase(key string) ([]byte, error) {
+	if _, ok := cs.state.Base[key]; !ok {
+		return nil, nil
+	}
+	exists, err := cs.local.Exists(syncBasePrefix + key)
+	if err != nil || !exists {
+		return nil, err
+	}
+	return cs.local.Load(syncBasePrefix + key)
+}
+
+// saveState persists the sync state; the caller holds cs.mu
+func (cs *CachedStorage) saveState() error {
+	raw, err := json.Marshal(cs.state)
+	if err != nil {
+		return err
+	}
+	return cs.local.Save(syncStateKey, raw)
+}
+
+// connect returns the remote backend, dialing it if needed. The dial runs
+// without holding cs.mu, so local reads and saves do not wait for it.
+func (cs *CachedStorage) connect() (Storage, error) {
+	cs.dialMu.Lock()
+	defer cs.dialMu.Unlock()
+
+	cs.mu.Lock()
+	if cs.remote != nil {
+		defer cs.mu.Unlock()
+		return cs.remote, nil
+	}
+	if wait := cs.nextDial.Sub(cs.now()); wait > 0 {
+		defer cs.mu.Unlock()
+		return nil, fmt.Errorf("remote unreachable, retrying in %s: %w", wait.Round(time.Second), cs.status.LastError)
+	}
+	cs.mu.Unlock()
+
+	remote, err := cs.dial()
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if err != nil {
+		cs.backoff = min(max(2*cs.backoff, dialBackoffMin), dialBackoffMax)
+		cs.nextDial = cs.now().Add(cs.backoff)
+		cs.status.Online = false
+		cs.status.LastError = err
+		return nil, err
+	}
+	cs.backoff = 0
+	cs.nextDial = time.Time{}
+	cs.remote = remote
+	return remote, nil
+}
+
+// remoteLoad fetches a key. found is false without an error only when the
+// remote reported the key missing; any failure is returned as an error.
+func (cs *CachedStorage) remoteLoad(remote Storage, key string) ([]byte, bool, error) {
+	ctx, cancel := cs.operationContext()
+	defer cancel()
+
+	exists, err := existsContext(ctx, remote, key)
+	if err == nil && exists {
+		var data []byte
+		data, err = loadContext(ctx, remote, key)
+		cs.setError(err)
+		return data, err == nil, err
+	}
+	cs.setError(err)
+	return nil, false, err
+}
+
+func (cs *CachedStorage) setError(err error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.status.Online = err == nil
+	cs.status.LastError = err
+}
+
+func (cs *CachedStorage) trigger() {
+	select {
+	case cs.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (cs *CachedStorage) now() time.Time {
+	if cs.clock != nil {
+		return cs.clock()
+	}
+	return time.Now()
+}
+
+func hashData(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,443 @@
+package storage
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// flakyDialer hands out remote until offline is set
+type flakyDialer struct {
+	remote  *mockStorage
+	offline bool
+}
+
+func (d *flakyDialer) dial() (Storage, error) {
+	if d.offline {
+		return nil, errors.New("network unreachable")
+	}
+	return d.remote, nil
+}
+
+func newTestCache(t *testing.T, local *mockStorage, d *flakyDialer) *CachedStorage {
+	t.Helper()
+	cs, err := NewCachedStorage(local, d.dial)
+	if err != nil {
+		t.Fatalf("NewCachedStorage failed: %v", err)
+	}
+	cs.clock = func() time.Time { return time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC) }
+	return cs
+}
+
+func TestCachedStorage_SaveIsLocalUntilSync(t *testing.T) {
+	local := newMockStorage()
+	d := &flakyDialer{remote: newMockStorage()}
+	cs := newTestCache(t, local, d)
+
+	if err := cs.Save("todos.json", []byte("v1")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, ok := d.remote.data["todos.json"]; ok {
+		t.Error("Save should not write to the remote")
+	}
+	if got := cs.Status().Pending; got != 1 {
+		t.Errorf("expected 1 pending change, got %d", got)
+	}
+
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got := string(d.remote.data["todos.json"]); got != "v1" {
+		t.Errorf("expected remote v1, got %q", got)
+	}
+	status := cs.Status()
+	if status.Pending != 0 || !status.Online || status.LastSync.IsZero() {
+		t.Errorf("unexpected status after sync: %+v", status)
+	}
+}
+
+func TestCachedStorage_Offline(t *testing.T) {
+	local := newMockStorage()
+	d := &flakyDialer{remote: newMockStorage(), offline: true}
+	cs := newTestCache(t, local, d)
+
+	if err := cs.Save("todos.json", []byte("v1")); err != nil {
+		t.Fatalf("Save should succeed offline: %v", err)
+	}
+	data, err := cs.Load("todos.json")
+	if err != nil || string(data) != "v1" {
+		t.Fatalf("Load offline = %q, %v", data, err)
+	}
+	if err := cs.Sync(); err == nil {
+		t.Error("expected Sync to fail offline")
+	}
+	status := cs.Status()
+	if status.Online || status.Pending != 1 || status.LastError == nil {
+		t.Errorf("unexpected offline status: %+v", status)
+	}
+
+	d.offline = false
+	if err := cs.Sync(); err == nil {
+		t.Error("expected Sync to wait for the dial backoff")
+	}
+	cs.clock = func() time.Time { return time.Date(2025, 3, 1, 12, 0, 1, 0, time.UTC) }
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync after reconnect failed: %v", err)
+	}
+	if got := string(d.remote.data["todos.json"]); got != "v1" {
+		t.Errorf("expected remote v1 after reconnect, got %q", got)
+	}
+}
+
+func TestCachedStorage_RemoteErrorKeepsQueue(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	cs := newTestCache(t, newMockStorage(), d)
+
+	cs.Save("todos.json", []byte("v1"))
+	d.remote.saveErr = errors.New("connection reset")
+	if err := cs.Sync(); err == nil {
+		t.Fatal("expected Sync to fail")
+	}
+	if got := cs.Status().Pending; got != 1 {
+		t.Errorf("failed push should stay queued, got %d pending", got)
+	}
+
+	d.remote.saveErr = nil
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got := cs.Status().Pending; got != 0 {
+		t.Errorf("expected empty queue, got %d pending", got)
+	}
+}
+
+func TestCachedStorage_LoadFetchesAndCaches(t *testing.T) {
+	local := newMockStorage()
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["todos.json"] = []byte("remote")
+	cs := newTestCache(t, local, d)
+
+	data, err := cs.Load("todos.json")
+	if err != nil || string(data) != "remote" {
+		t.Fatalf("Load = %q, %v", data, err)
+	}
+	if got := string(local.data["todos.json"]); got != "remote" {
+		t.Errorf("expected key to be cached, got %q", got)
+	}
+
+	// Served from the cache while offline
+	d.offline = true
+	cs.remote = nil
+	if data, err := cs.Load("todos.json"); err != nil || string(data) != "remote" {
+		t.Errorf("cached Load = %q, %v", data, err)
+	}
+
+	if _, err := cs.Load("missing.json"); err == nil {
+		t.Error("expected error for a key that is neither cached nor reachable")
+	}
+}
+
+func TestCachedStorage_PullsRemoteChanges(t *testing.T) {
+	local := newMockStorage()
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["todos.json"] = []byte("v1")
+	cs := newTestCache(t, local, d)
+
+	if _, err := cs.Load("todos.json"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// Another device updates the key
+	d.remote.data["todos.json"] = []byte("v2")
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if data, _ := cs.Load("todos.json"); string(data) != "v2" {
+		t.Errorf("expected pulled v2, got %q", data)
+	}
+
+	// ...and then deletes it
+	delete(d.remote.data, "todos.json")
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, ok := local.data["todos.json"]; ok {
+		t.Error("expected remote delete to be pulled")
+	}
+}
+
+func TestCachedStorage_ExistsErrorKeepsLocalCopy(t *testing.T) {
+	local := newMockStorage()
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["todos.json"] = []byte("v1")
+	cs := newTestCache(t, local, d)
+	if _, err := cs.Load("todos.json"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	// E.g. a 403 or a timeout: the key may well still exist
+	d.remote.existsErr = errors.New("access denied")
+	if err := cs.Sync(); err == nil {
+		t.Error("expected Sync to report the error")
+	}
+	if data, ok := local.data["todos.json"]; !ok || string(data) != "v1" {
+		t.Errorf("expected the cached copy to be kept, got %q", data)
+	}
+	if cs.Status().Online {
+		t.Error("expected the remote to be reported offline")
+	}
+}
+
+func TestCachedStorage_ConflictKeepsLocalAndRemoteCopy(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["todos.json"] = []byte("v1")
+	cs := newTestCache(t, newMockStorage(), d)
+	cs.Load("todos.json")
+
+	// Offline edit while another device also saves
+	d.offline = true
+	cs.remote = nil
+	cs.Save("todos.json", []byte("local"))
+	d.remote.data["todos.json"] = []byte("remote")
+
+	d.offline = false
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	if got := string(d.remote.data["todos.json"]); got != "local" {
+		t.Errorf("expected local copy to win, got %q", got)
+	}
+	conflictKey := "todos.json.conflict.20250301T120000Z"
+	if got := string(d.remote.data[conflictKey]); got != "remote" {
+		t.Errorf("expected remote copy under %s, got %q", conflictKey, got)
+	}
+	if got := cs.Status().Conflicts; got != 1 {
+		t.Errorf("expected 1 conflict, got %d", got)
+	}
+}
+
+func TestCachedStorage_ConflictFunc(t *testing.T) {
+	local := newMockStorage()
+	d := &flakyDialer{remote: newMockStorage()}
+	cs := newTestCache(t, local, d)
+	cs.SetConflictFunc(func(key string, base, l, r []byte) ([]byte, error) {
+		if base != nil {
+			t.Errorf("expected no base for a key never synced, got %q", base)
+		}
+		return []byte(string(l) + "+" + string(r)), nil
+	})
+
+	// Both sides created the key independently
+	d.remote.data["todos.json"] = []byte("remote")
+	cs.Save("todos.json", []byte("local"))
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+
+	for name, s := range map[string]*mockStorage{"remote": d.remote, "local": local} {
+		if got := string(s.data["todos.json"]); got != "local+remote" {
+			t.Errorf("expected merged %s copy, got %q", name, got)
+		}
+	}
+}
+
+func TestCachedStorage_DeleteIsQueued(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["todos.json"] = []byte("v1")
+	cs := newTestCache(t, newMockStorage(), d)
+	cs.Load("todos.json")
+
+	if err := cs.Delete("todos.json"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, _ := cs.Exists("todos.json"); exists {
+		t.Error("deleted key should not exist")
+	}
+	if _, ok := d.remote.data["todos.json"]; !ok {
+		t.Error("Delete should not reach the remote before Sync")
+	}
+
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if _, ok := d.remote.data["todos.json"]; ok {
+		t.Error("expected remote key to be deleted")
+	}
+}
+
+func TestCachedStorage_QueueSurvivesRestart(t *testing.T) {
+	local := newMockStorage()
+	d := &flakyDialer{remote: newMockStorage(), offline: true}
+
+	cs := newTestCache(t, local, d)
+	cs.Save("todos.json", []byte("v1"))
+
+	restarted := newTestCache(t, local, d)
+	if got := restarted.Status().Pending; got != 1 {
+		t.Fatalf("expected pending change to be restored, got %d", got)
+	}
+
+	d.offline = false
+	if err := restarted.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got := string(d.remote.data["todos.json"]); got != "v1" {
+		t.Errorf("expected remote v1, got %q", got)
+	}
+}
+
+func TestCachedStorage_List(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["backup.todos.json.1"] = []byte("r")
+	cs := newTestCache(t, newMockStorage(), d)
+	cs.Save("backup.todos.json.2", []byte("l"))
+
+	keys, err := cs.List("")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := []string{"backup.todos.json.1", "backup.todos.json.2"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+	for _, k := range keys {
+		if strings.Contains(k, "sync-state") {
+			t.Errorf("sync state should be hidden, got %v", keys)
+		}
+	}
+}
+
+func TestCachedStorage_CloseFlushes(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	local := newMockStorage()
+	cs := newTestCache(t, local, d)
+	cs.Start(time.Hour)
+
+	cs.Save("todos.json", []byte("v1"))
+	if err := cs.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if got := string(d.remote.data["todos.json"]); got != "v1" {
+		t.Errorf("expected Close to push pending changes, got %q", got)
+	}
+	if !d.remote.closed || !local.closed {
+		t.Error("expected both sides to be closed")
+	}
+}
+
+func TestCachedStorage_ConflictFuncGetsBase(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["todos.json"] = []byte("base")
+	cs := newTestCache(t, newMockStorage(), d)
+	cs.Load("todos.json")
+
+	var gotBase []byte
+	cs.SetConflictFunc(func(key string, base, l, r []byte) ([]byte, error) {
+		gotBase = base
+		return l, nil
+	})
+
+	cs.Save("todos.json", []byte("local"))
+	d.remote.data["todos.json"] = []byte("remote")
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if string(gotBase) != "base" {
+		t.Errorf("expected base %q, got %q", "base", gotBase)
+	}
+
+	// The pushed copy becomes the new base
+	cs.Save("todos.json", []byte("local2"))
+	d.remote.data["todos.json"] = []byte("remote2")
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if string(gotBase) != "local" {
+		t.Errorf("expected base %q, got %q", "local", gotBase)
+	}
+}
+
+func TestCachedStorage_UnresolvedFallsBackToDefault(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	cs := newTestCache(t, newMockStorage(), d)
+	cs.SetConflictFunc(func(key string, base, l, r []byte) ([]byte, error) {
+		return nil, ErrConflictUnresolved
+	})
+
+	d.remote.data["notes.json"] = []byte("remote")
+	cs.Save("notes.json", []byte("local"))
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got := string(d.remote.data["notes.json.conflict.20250301T120000Z"]); got != "remote" {
+		t.Errorf("expected default conflict copy, got %q", got)
+	}
+}
+
+func TestCachedStorage_RevisionTracksLocalChanges(t *testing.T) {
+	d := &flakyDialer{remote: newMockStorage()}
+	d.remote.data["todos.json"] = []byte("v1")
+	cs := newTestCache(t, newMockStorage(), d)
+	cs.Load("todos.json")
+
+	if err := cs.Sync(); err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+	if got := cs.Status().Revision; got != 0 {
+		t.Errorf("nothing changed, expected revision 0, got %d", got)
+	}
+
+	d.remote.data["todos.json"] = []byte("v2")
+	cs.Sync()
+	if got := cs.Status().Revision; got != 1 {
+		t.Errorf("expected revision 1 after a pull, got %d", got)
+	}
+}
+
+// blockingDialer blocks each dial until release is closed
+type blockingDialer struct {
+	remote  *mockStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (d *blockingDialer) dial() (Storage, error) {
+	close(d.started)
+	<-d.release
+	return d.remote, nil
+}
+
+func TestCachedStorage_DialDoesNotBlockLocalAccess(t *testing.T) {
+	local := newMockStorage()
+	d := &blockingDialer{remote: newMockStorage(), started: make(chan struct{}), release: make(chan struct{})}
+	cs, err := NewCachedStorage(local, d.dial)
+	if err != nil {
+		t.Fatalf("NewCachedStorage failed: %v", err)
+	}
+
+	synced := make(chan error)
+	go func() { synced <- cs.Sync() }()
+	<-d.started
+
+	saved := make(chan error)
+	go func() { saved <- cs.Save("todos.json", []byte("v1")) }()
+	select {
+	case err := <-saved:
+		if err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Save blocked on the dial")
+	}
+	if status := cs.Status(); status.Pending != 1 {
+		t.Errorf("expected 1 pending change, got %+v", status)
+	}
+
+	close(d.release)
+	if err := <-synced; err != nil {
+		t.Fatalf("Sync failed: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is applied to values before encryption and recorded in the
+// envelope header, so it can be changed at any time
+type Compression byte
+
+const (
+	CompressNone Compression = 0
+	CompressGzip Compression = 1
+	CompressZstd Compression = 2
+)
+
+// CompressingEncryptor is implemented by encryptors whose header records
+// how the plaintext was compressed. Decrypting undoes the compression.
+type CompressingEncryptor interface {
+	EncryptCompressed(plaintext, ad []byte, c Compression) ([]byte, error)
+}
+
+// maxDecompressed bounds the size of a decompressed value, so a tampered
+// or corrupt value cannot exhaust memory
+const maxDecompressed = 256 << 20
+
+// ParseCompression parses a STORAGE_COMPRESSION value
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return CompressNone, nil
+	case "gzip":
+		return CompressGzip, nil
+	case "zstd":
+		return CompressZstd, nil
+	default:
+		return CompressNone, fmt.Errorf("unsupported compression: %s (supported: none, gzip, zstd)", name)
+	}
+}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressNone:
+		return "none"
+	case CompressGzip:
+		return "gzip"
+	case CompressZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("compression(%d)", byte(c))
+	}
+}
+
+func (c Compression) valid() bool {
+	return c <= CompressZstd
+}
+
+// The zstd encoder and decoder are safe for concurrent EncodeAll/DecodeAll
+// calls and expensive to create, so they are shared
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) {
+		return zstd.NewWriter(nil)
+	})
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) {
+		return zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxDecompressed))
+	})
+)
+
+func compress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressNone:
+		return data, nil
+	case CompressGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressZstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, err
+		}
+		return enc.EncodeAll(data, nil), nil
+	default:
+		return nil, fmt.Errorf("%w: compression %d", ErrUnsupportedFormat, c)
+	}
+}
+
+func decompress(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressNone:
+		return data, nil
+	case CompressGzip:
+		r, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		out, err := io.ReadAll(io.LimitReader(r, maxDecompressed+1))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		if len(out) > maxDecompressed {
+			return nil, fmt.Errorf("%w: decompressed value exceeds %d bytes", ErrCorrupted, maxDecompressed)
+		}
+		return out, nil
+	case CompressZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return nil, err
+		}
+		out, err := dec.DecodeAll(data, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("%w: compression %d", ErrUnsupportedFormat, c)
+	}
+}
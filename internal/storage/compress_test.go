@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// testTaskStore returns indented JSON shaped like a task store with n tasks
+func testTaskStore(n int) []byte {
+	type task struct {
+		ID        int       `json:"id"`
+		Title     string    `json:"title"`
+		Notes     string    `json:"notes"`
+		Done      bool      `json:"done"`
+		CreatedAt time.Time `json:"createdAt"`
+		UpdatedAt time.Time `json:"updatedAt"`
+	}
+	tasks := make([]task, n)
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for i := range tasks {
+		tasks[i] = task{
+			ID:        i + 1,
+			Title:     fmt.Sprintf("Task number %d", i+1),
+			Notes:     "Follow up with the team about the quarterly report and book the meeting room",
+			Done:      i%3 == 0,
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+			UpdatedAt: base.Add(time.Duration(i) * time.Hour),
+		}
+	}
+	data, _ := json.MarshalIndent(map[string]any{"schemaVersion": 1, "tasks": tasks}, "", "  ")
+	return data
+}
+
+func TestStorageManager_Compression(t *testing.T) {
+	data := testTaskStore(500)
+	aes, _ := NewAESEncryptor(make([]byte, 32))
+	passphrase := newTestPassphraseEncryptor(t, "correct horse")
+
+	for _, enc := range []Encryptor{aes, passphrase} {
+		st := newMockStorage()
+		sm := NewStorageManager(st, enc)
+		if err := sm.Save("plain.json", data); err != nil {
+			t.Fatalf("Save failed: %v", err)
+		}
+
+		for _, c := range []Compression{CompressGzip, CompressZstd} {
+			if err := sm.SetCompression(c); err != nil {
+				t.Fatalf("%T %s: SetCompression failed: %v", enc, c, err)
+			}
+			if err := sm.Save(c.String(), data); err != nil {
+				t.Fatalf("%T %s: Save failed: %v", enc, c, err)
+			}
+			if stored, plain := len(st.data[c.String()]), len(st.data["plain.json"]); stored >= plain/2 {
+				t.Errorf("%T %s: stored %d bytes, uncompressed %d", enc, c, stored, plain)
+			}
+
+			// Reading needs no configuration, the header says how
+			out, err := NewStorageManager(st, enc).Load(c.String())
+			if err != nil || string(out) != string(data) {
+				t.Fatalf("%T %s: Load = %d bytes, %v", enc, c, len(out), err)
+			}
+		}
+	}
+}
+
+func TestStorageManager_SetCompression_NoEncryption(t *testing.T) {
+	st := newMockStorage()
+	sm := NewStorageManager(st, nil)
+	if err := sm.SetCompression(CompressZstd); err == nil {
+		t.Fatal("expected error for compression without encryption")
+	}
+	if err := sm.SetCompression(CompressNone); err != nil {
+		t.Fatalf("SetCompression(none) failed: %v", err)
+	}
+
+	data := testTaskStore(10)
+	if err := sm.Save("todos.json", data); err != nil || string(st.data["todos.json"]) != string(data) {
+		t.Fatalf("expected plain JSON at rest, got %v", err)
+	}
+}
+
+func TestAESEncryptor_DecryptVersion1(t *testing.T) {
+	key := make([]byte, 32)
+	gcm, _ := newGCM(key)
+	nonce := make([]byte, gcm.NonceSize())
+	header := append(append([]byte(nil), envelopeMagic...), 1, AlgAES256GCM)
+	header = append(header, KeyID(key)...)
+	v1 := gcm.Seal(append(header, nonce...), nonce, []byte("version 1"), envelopeAD(header, []byte("todos.json")))
+
+	enc, _ := NewAESEncryptor(key)
+	if data, err := enc.DecryptWithAD(v1, []byte("todos.json")); err != nil || string(data) != "version 1" {
+		t.Fatalf("DecryptWithAD = %q, %v", data, err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for name, want := range map[string]Compression{"": CompressNone, "none": CompressNone, "gzip": CompressGzip, "ZSTD": CompressZstd} {
+		if c, err := ParseCompression(name); err != nil || c != want {
+			t.Errorf("ParseCompression(%q) = %v, %v", name, c, err)
+		}
+	}
+	if _, err := ParseCompression("brotli"); err == nil {
+		t.Error("expected error for an unsupported compression")
+	}
+}
+
+// throttledStorage delays saves by the time the data would take to upload
+type throttledStorage struct {
+	*mockStorage
+	bytesPerSecond int
+}
+
+func (s *throttledStorage) Save(key string, data []byte) error {
+	time.Sleep(time.Duration(len(data)) * time.Second / time.Duration(s.bytesPerSecond))
+	return s.mockStorage.Save(key, data)
+}
+
+// BenchmarkStorageManager_Save measures save latency of a 2000-task store
+// over a 10 MB/s link, the typical cost of one keystroke with a remote
+// backend
+func BenchmarkStorageManager_Save(b *testing.B) {
+	data := testTaskStore(2000)
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+
+	for _, c := range []Compression{CompressNone, CompressGzip, CompressZstd} {
+		b.Run(c.String(), func(b *testing.B) {
+			st := &throttledStorage{mockStorage: newMockStorage(), bytesPerSecond: 10 << 20}
+			sm := NewStorageManager(st, enc)
+			if err := sm.SetCompression(c); err != nil {
+				b.Fatal(err)
+			}
+
+			b.SetBytes(int64(len(data)))
+			for b.Loop() {
+				if err := sm.Save("todos.json", data); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(len(st.data["todos.json"])), "stored-bytes")
+		})
+	}
+}
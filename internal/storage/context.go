@@ -0,0 +1,92 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// ContextStorage is implemented by backends whose operations can be bounded
+// by a context. The plain Storage methods run with context.Background().
+type ContextStorage interface {
+	Storage
+	LoadContext(ctx context.Context, key string) ([]byte, error)
+	SaveContext(ctx context.Context, key string, data []byte) error
+	DeleteContext(ctx context.Context, key string) error
+	ExistsContext(ctx context.Context, key string) (bool, error)
+	ListContext(ctx context.Context, prefix string) ([]string, error)
+}
+
+// operationScope bounds every storage operation with a per-operation timeout
+// and a shared cancellation, so a hung backend cannot block the TUI forever
+type operationScope struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	timeout time.Duration
+}
+
+func newOperationScope() operationScope {
+	ctx, cancel := context.WithCancel(context.Background())
+	return operationScope{ctx: ctx, cancel: cancel}
+}
+
+// SetTimeout sets the per-operation timeout; zero disables it
+func (s *operationScope) SetTimeout(timeout time.Duration) {
+	s.timeout = timeout
+}
+
+// Cancel aborts in-flight operations and makes later ones fail immediately
+func (s *operationScope) Cancel() {
+	s.cancel()
+}
+
+func (s *operationScope) operationContext() (context.Context, context.CancelFunc) {
+	if s.timeout > 0 {
+		return context.WithTimeout(s.ctx, s.timeout)
+	}
+	return context.WithCancel(s.ctx)
+}
+
+// timeoutContext bounds a one-off operation by timeout, unless it is 0
+func timeoutContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// The helpers below run an operation on s with ctx when s supports it
+
+func loadContext(ctx context.Context, s Storage, key string) ([]byte, error) {
+	if cs, ok := s.(ContextStorage); ok {
+		return cs.LoadContext(ctx, key)
+	}
+	return s.Load(key)
+}
+
+func saveContext(ctx context.Context, s Storage, key string, data []byte) error {
+	if cs, ok := s.(ContextStorage); ok {
+		return cs.SaveContext(ctx, key, data)
+	}
+	return s.Save(key, data)
+}
+
+func deleteContext(ctx context.Context, s Storage, key string) error {
+	if cs, ok := s.(ContextStorage); ok {
+		return cs.DeleteContext(ctx, key)
+	}
+	return s.Delete(key)
+}
+
+func existsContext(ctx context.Context, s Storage, key string) (bool, error) {
+	if cs, ok := s.(ContextStorage); ok {
+		return cs.ExistsContext(ctx, key)
+	}
+	return s.Exists(key)
+}
+
+func listContext(ctx context.Context, s Storage, prefix string) ([]string, error) {
+	if cs, ok := s.(ContextStorage); ok {
+		return cs.ListContext(ctx, prefix)
+	}
+	return s.List(prefix)
+}
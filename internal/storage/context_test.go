@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// blockingStorage blocks every context-aware operation until ctx is done
+type blockingStorage struct {
+	*mockStorage
+}
+
+func (b *blockingStorage) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *blockingStorage) SaveContext(ctx context.Context, key string, data []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *blockingStorage) DeleteContext(ctx context.Context, key string) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *blockingStorage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func (b *blockingStorage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestStorageManager_Timeout(t *testing.T) {
+	sm := NewStorageManager(&blockingStorage{newMockStorage()}, nil)
+	sm.SetTimeout(10 * time.Millisecond)
+
+	start := time.Now()
+	_, err := sm.Load("k")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("timeout was not applied")
+	}
+
+	if err := sm.Save("k", []byte("v")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded on save, got %v", err)
+	}
+}
+
+func TestStorageManager_Cancel(t *testing.T) {
+	sm := NewStorageManager(&blockingStorage{newMockStorage()}, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := sm.Exists("k")
+		done <- err
+	}()
+
+	sm.Cancel()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected canceled, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("in-flight operation was not cancelled")
+	}
+}
+
+func TestStorageManager_PlainStorageIgnoresContext(t *testing.T) {
+	sm := NewStorageManager(newMockStorage(), nil)
+	sm.SetTimeout(time.Nanosecond)
+
+	if err := sm.Save("k", []byte("v")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+}
+
+func TestFileStorage_CancelledContext(t *testing.T) {
+	fs, _ := NewFileStorage(t.TempDir())
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := fs.SaveContext(ctx, "k", []byte("v")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected canceled, got %v", err)
+	}
+	if exists, _ := fs.Exists("k"); exists {
+		t.Fatalf("cancelled save should not write")
+	}
+}
+
+func TestRecordManager_Timeout(t *testing.T) {
+	rm := NewRecordManager(&blockingRecordStorage{}, nil)
+	rm.SetTimeout(10 * time.Millisecond)
+
+	if _, err := rm.ListTasks(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+type blockingRecordStorage struct{}
+
+func (b *blockingRecordStorage) ListTasks(ctx context.Context) ([]TaskRecord, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (b *blockingRecordStorage) PutTask(ctx context.Context, task TaskRecord) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (b *blockingRecordStorage) DeleteTask(ctx context.Context, id int64) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
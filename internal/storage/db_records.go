@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// DBRecordStorage implements per-task SQL storage, one row per task
+type DBRecordStorage struct {
+	db        *sql.DB
+	tableName string
+}
+
+// Records returns a record-level store sharing this storage's connection
+// and schema
+func (ds *DBStorage) Records(tableName string) (RecordStorage, error) {
+	return NewDBRecordStorage(ds.db, ds.schema, tableName)
+}
+
+// NewDBRecordStorage creates the table in schema (the search_path when
+// empty) if needed
+func NewDBRecordStorage(db *sql.DB, schema, tableName string) (*DBRecordStorage, error) {
+	tableName, err := qualifiedTable(schema, tableName)
+	if err != nil {
+		return nil, err
+	}
+	return newDBRecordStorage(db, tableName, "TIMESTAMPTZ")
+}
+
+// newDBRecordStorage creates the table with timeType as the due_at column
+// type, which drivers use to decide whether to return a time.Time
+func newDBRecordStorage(db *sql.DB, tableName, timeType string) (*DBRecordStorage, error) {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + tableName + ` (
+			id BIGINT PRIMARY KEY,
+			title TEXT NOT NULL,
+			done BOOLEAN NOT NULL DEFAULT FALSE,
+			due_at ` + timeType + `,
+			notified BOOLEAN NOT NULL DEFAULT FALSE
+		)
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DBRecordStorage{
+		db:        db,
+		tableName: tableName,
+	}, nil
+}
+
+func (rs *DBRecordStorage) ListTasks(ctx context.Context) ([]TaskRecord, error) {
+	rows, err := rs.db.QueryContext(ctx,
+		"SELECT id, title, done, due_at, notified FROM "+rs.tableName+" ORDER BY id",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tasks []TaskRecord
+	for rows.Next() {
+		var task TaskRecord
+		var dueAt sql.NullTime
+		if err := rows.Scan(&task.ID, &task.Title, &task.Done, &dueAt, &task.Notified); err != nil {
+			return nil, err
+		}
+		if dueAt.Valid {
+			task.DueAt = dueAt.Time
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, rows.Err()
+}
+
+func (rs *DBRecordStorage) PutTask(ctx context.Context, task TaskRecord) error {
+	var dueAt sql.NullTime
+	if !task.DueAt.IsZero() {
+		dueAt = sql.NullTime{Time: task.DueAt.UTC().Truncate(time.Microsecond), Valid: true}
+	}
+
+	_, err := rs.db.ExecContext(ctx, `
+		INSERT INTO `+rs.tableName+` (id, title, done, due_at, notified)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (id) DO UPDATE SET title = $2, done = $3, due_at = $4, notified = $5
+	`, task.ID, task.Title, task.Done, dueAt, task.Notified)
+	return err
+}
+
+func (rs *DBRecordStorage) DeleteTask(ctx context.Context, id int64) error {
+	_, err := rs.db.ExecContext(ctx, "DELETE FROM "+rs.tableName+" WHERE id = $1", id)
+	return err
+}
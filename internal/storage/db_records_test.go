@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func newMockDBRecordStorage(t *testing.T) (*DBRecordStorage, sqlmock.Sqlmock, func()) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+
+	rs := &DBRecordStorage{
+		db:        db,
+		tableName: "test_records",
+	}
+
+	return rs, mock, func() {
+		db.Close()
+	}
+}
+
+func TestNewDBRecordStorage_CreatesTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "todo"."test_records"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if _, err := NewDBRecordStorage(db, "todo", "test_records"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDBRecordStorage_ListTasks(t *testing.T) {
+	rs, mock, cleanup := newMockDBRecordStorage(t)
+	defer cleanup()
+
+	due := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	rows := sqlmock.NewRows([]string{"id", "title", "done", "due_at", "notified"}).
+		AddRow(int64(1), "first", false, nil, false).
+		AddRow(int64(2), "second", true, due, true)
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT id, title, done, due_at, notified FROM test_records ORDER BY id",
+	)).WillReturnRows(rows)
+
+	tasks, err := rs.ListTasks(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(tasks) != 2 {
+		t.Fatalf("expected 2 tasks, got %d", len(tasks))
+	}
+	if !tasks[0].DueAt.IsZero() {
+		t.Fatalf("expected zero due time for NULL column")
+	}
+	if tasks[1].Title != "second" || !tasks[1].Done || !tasks[1].DueAt.Equal(due) {
+		t.Fatalf("unexpected task: %+v", tasks[1])
+	}
+}
+
+func TestDBRecordStorage_ListTasks_Error(t *testing.T) {
+	rs, mock, cleanup := newMockDBRecordStorage(t)
+	defer cleanup()
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, title")).
+		WillReturnError(errors.New("query error"))
+
+	if _, err := rs.ListTasks(context.Background()); err == nil {
+		t.Fatalf("expected query error")
+	}
+}
+
+func TestDBRecordStorage_PutTask(t *testing.T) {
+	rs, mock, cleanup := newMockDBRecordStorage(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(
+		`INSERT INTO test_records (id, title, done, due_at, notified)`,
+	)).
+		WithArgs(int64(7), "task", true, nil, false).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	if err := rs.PutTask(context.Background(), TaskRecord{ID: 7, Title: "task", Done: true}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestDBRecordStorage_PutTask_Error(t *testing.T) {
+	rs, mock, cleanup := newMockDBRecordStorage(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(`INSERT INTO test_records`)).
+		WillReturnError(errors.New("insert error"))
+
+	if err := rs.PutTask(context.Background(), TaskRecord{ID: 1}); err == nil {
+		t.Fatalf("expected insert error")
+	}
+}
+
+func TestDBRecordStorage_DeleteTask(t *testing.T) {
+	rs, mock, cleanup := newMockDBRecordStorage(t)
+	defer cleanup()
+
+	mock.ExpectExec(regexp.QuoteMeta(
+		"DELETE FROM test_records WHERE id = $1",
+	)).
+		WithArgs(int64(3)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := rs.DeleteTask(context.Background(), 3); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"regexp"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
 )
@@ -169,3 +171,129 @@ func TestDBStorage_Exists_Error(t *testing.T) {
 		t.Fatalf("expected exists error")
 	}
 }
+
+func TestDBStorage_List(t *testing.T) {
+	ds, mock, cleanup := newMockDBStorage(t)
+	defer cleanup()
+
+	rows := sqlmock.NewRows([]string{"key"}).AddRow("a_1").AddRow("a_2")
+
+	mock.ExpectQuery(regexp.QuoteMeta(
+		"SELECT key FROM test_table WHERE key LIKE $1 ESCAPE '\\' ORDER BY key",
+	)).
+		WithArgs(`a\_%`).
+		WillReturnRows(rows)
+
+	keys, err := ds.List("a_")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestNewDBStorage(t *testing.T) {
+	_, mock, err := sqlmock.NewWithDSN("db-storage-new", sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+
+	mock.ExpectPing()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE SCHEMA IF NOT EXISTS "todo"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "todo"."tasks"`)).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ds, err := NewDBStorage(DBOptions{Driver: "sqlmock", DSN: "db-storage-new", Schema: "todo", Table: "tasks", MaxOpenConns: 3})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ds.Close()
+
+	if got := ds.db.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("expected 3 max open connections, got %d", got)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Fatalf("unmet expectations: %v", err)
+	}
+}
+
+func TestNewDBStorage_ConnectTimeout(t *testing.T) {
+	_, mock, err := sqlmock.NewWithDSN("db-storage-timeout", sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	mock.ExpectPing().WillDelayFor(time.Second)
+
+	start := time.Now()
+	_, err = NewDBStorage(DBOptions{Driver: "sqlmock", DSN: "db-storage-timeout", Table: "tasks", ConnectTimeout: 50 * time.Millisecond})
+	if err == nil {
+		t.Fatalf("expected a connection error")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("connecting took %s, expected the timeout to stop it", elapsed)
+	}
+}
+
+func TestPostgresBackend_PoolSizeOptIn(t *testing.T) {
+	backend, _ := LookupBackend("postgres")
+	for _, setting := range backend.Settings {
+		if setting.Name == "POSTGRES_MAX_OPEN_CONNS" && setting.Default != "" {
+			t.Fatalf("expected no pool size limit by default, got %s", setting.Default)
+		}
+	}
+}
+
+func TestNewDBStorage_PingError(t *testing.T) {
+	_, mock, err := sqlmock.NewWithDSN("db-storage-ping", sqlmock.MonitorPingsOption(true))
+	if err != nil {
+		t.Fatalf("failed to create sqlmock: %v", err)
+	}
+	mock.ExpectPing().WillReturnError(errors.New("connection refused"))
+
+	_, err = NewDBStorage(DBOptions{Driver: "sqlmock", DSN: "db-storage-ping", Table: "tasks"})
+	if err == nil || !regexp.MustCompile("cannot connect to the database: .*connection refused").MatchString(err.Error()) {
+		t.Fatalf("expected a connection error, got %v", err)
+	}
+}
+
+func TestQualifiedTable(t *testing.T) {
+	tests := []struct {
+		schema, table, want string
+		wantErr             bool
+	}{
+		{"", "tasks", `"tasks"`, false},
+		{"todo", "task_records", `"todo"."task_records"`, false},
+		{"", "Tasks", `"tasks"`, false},
+		{"Todo", "my_Tasks$1", `"todo"."my_tasks$1"`, false},
+		{"", `"My Tasks"`, `"My Tasks"`, false},
+		{`"Todo App"`, `"say ""hi"""`, `"Todo App"."say ""hi"""`, false},
+		{"", "tasks; DROP TABLE users", "", true},
+		{"", `"tasks"; DROP TABLE "users"`, "", true},
+		{"", `""`, "", true},
+		{"", "1tasks", "", true},
+		{"public.x", "tasks", "", true},
+		{"", "", "", true},
+	}
+	for _, tt := range tests {
+		got, err := qualifiedTable(tt.schema, tt.table)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("qualifiedTable(%q, %q) = %q, %v", tt.schema, tt.table, got, err)
+		}
+	}
+}
+
+func TestDBDriversRegistered(t *testing.T) {
+	backend, _ := LookupBackend("postgres")
+	for _, setting := range backend.Settings {
+		if setting.Name != "POSTGRES_DRIVER" {
+			continue
+		}
+		for _, driver := range setting.Choices {
+			if !slices.Contains(sql.Drivers(), driver) {
+				t.Errorf("driver %q is not linked in", driver)
+			}
+		}
+	}
+}
@@ -1,38 +1,108 @@
 package storage
 
 import (
+	"context"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 )
 
+func init() {
+	RegisterBackend(Backend{
+		Name:        "file",
+		Description: "JSON files in DATA_PATH",
+		Local:       true,
+		New: func(cfg BackendConfig) (Storage, error) {
+			return NewFileStorage(cfg.DataPath)
+		},
+		Locate: func(cfg BackendConfig) string {
+			return pathLocation(cfg.DataPath)
+		},
+	})
+}
+
 // FileStorage implements local file storage
 type FileStorage struct {
 	basePath string
 }
 
 func NewFileStorage(basePath string) (*FileStorage, error) {
-	if err := os.MkdirAll(basePath, 0755); err != nil {
+	if err := os.MkdirAll(basePath, 0700); err != nil {
 		return nil, err
 	}
 	return &FileStorage{basePath: basePath}, nil
 }
 
 func (fs *FileStorage) Load(key string) ([]byte, error) {
+	return fs.LoadContext(context.Background(), key)
+}
+
+func (fs *FileStorage) Save(key string, data []byte) error {
+	return fs.SaveContext(context.Background(), key, data)
+}
+
+func (fs *FileStorage) Delete(key string) error {
+	return fs.DeleteContext(context.Background(), key)
+}
+
+func (fs *FileStorage) Exists(key string) (bool, error) {
+	return fs.ExistsContext(context.Background(), key)
+}
+
+func (fs *FileStorage) List(prefix string) ([]string, error) {
+	return fs.ListContext(context.Background(), prefix)
+}
+
+// Close is a no-op; files are opened and closed per operation
+func (fs *FileStorage) Close() error {
+	return nil
+}
+
+// Local file operations cannot be interrupted; the context is only checked
+// before starting so a cancelled manager stops touching the disk.
+
+func (fs *FileStorage) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	path := filepath.Join(fs.basePath, key)
 	return os.ReadFile(path)
 }
 
-func (fs *FileStorage) Save(key string, data []byte) error {
+func (fs *FileStorage) SaveContext(ctx context.Context, key string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	path := filepath.Join(fs.basePath, key)
-	return os.WriteFile(path, data, 0644)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// Older versions created data files readable by everyone
+	if err := f.Chmod(0600); err != nil {
+		log.Printf("Warning: failed to restrict %s: %v", path, err)
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
 }
 
-func (fs *FileStorage) Delete(key string) error {
+func (fs *FileStorage) DeleteContext(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	path := filepath.Join(fs.basePath, key)
 	return os.Remove(path)
 }
 
-func (fs *FileStorage) Exists(key string) (bool, error) {
+func (fs *FileStorage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
 	path := filepath.Join(fs.basePath, key)
 	_, err := os.Stat(path)
 	if err == nil {
@@ -43,3 +113,23 @@ func (fs *FileStorage) Exists(key string) (bool, error) {
 	}
 	return false, err
 }
+
+func (fs *FileStorage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(fs.basePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		keys = append(keys, entry.Name())
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
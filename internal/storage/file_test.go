@@ -41,6 +41,45 @@ func TestFileStorage_SaveLoad(t *testing.T) {
 	}
 }
 
+func TestFileStorage_Save_Mode(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	fs, _ := NewFileStorage(dir)
+
+	if err := fs.Save("test-key", []byte("secret")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	for path, want := range map[string]os.FileMode{dir: 0700, filepath.Join(dir, "test-key"): 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("stat failed: %v", err)
+		}
+		if got := info.Mode().Perm(); got != want {
+			t.Errorf("%s: expected mode %04o, got %04o", path, want, got)
+		}
+	}
+}
+
+func TestFileStorage_Save_RestrictsExistingFile(t *testing.T) {
+	dir := t.TempDir()
+	fs, _ := NewFileStorage(dir)
+	path := filepath.Join(dir, "todos.json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+
+	if err := fs.Save("todos.json", []byte("new")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("stat failed: %v", err)
+	}
+	if got := info.Mode().Perm(); got != 0600 {
+		t.Errorf("expected mode 0600 after saving, got %04o", got)
+	}
+}
+
 func TestFileStorage_Load_NotFound(t *testing.T) {
 	dir := t.TempDir()
 	fs, _ := NewFileStorage(dir)
@@ -137,3 +176,25 @@ func TestFileStorage_Exists_Error(t *testing.T) {
 		t.Fatalf("expected stat error")
 	}
 }
+
+func TestFileStorage_List(t *testing.T) {
+	dir := t.TempDir()
+	fs, _ := NewFileStorage(dir)
+
+	for _, key := range []string{"todos.json", "todos.json.bak", "other"} {
+		if err := fs.Save(key, []byte("v")); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(dir, "todos.dir"), 0755); err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+
+	keys, err := fs.List("todos")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "todos.json" || keys[1] != "todos.json.bak" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+func init() {
+	RegisterBackend(Backend{
+		Name:        "git",
+		Description: "git repository, one commit per change",
+		Local:       true,
+		Settings: []Setting{
+			{Name: "GIT_REPO_PATH", Description: "working tree; DATA_PATH/git when unset"},
+			{Name: "GIT_REMOTE", Description: "optional remote pulled on start and pushed after each save", Kind: SettingURL},
+			{Name: "GIT_BRANCH", Description: "branch", Default: "main"},
+		},
+		New: func(cfg BackendConfig) (Storage, error) {
+			return NewGitStorage(GitOptions{
+				Path:   gitRepoPath(cfg),
+				Remote: cfg.Settings.Get("GIT_REMOTE"),
+				Branch: cfg.Settings.Get("GIT_BRANCH"),
+			})
+		},
+		Locate: func(cfg BackendConfig) string {
+			// Branches share the working tree, so only the path counts
+			return pathLocation(gitRepoPath(cfg))
+		},
+	})
+}
+
+func gitRepoPath(cfg BackendConfig) string {
+	if path := cfg.Settings.Get("GIT_REPO_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(cfg.DataPath, "git")
+}
+
+// GitOptions configures a GitStorage
+type GitOptions struct {
+	Path   string // working tree, initialized if needed
+	Remote string // optional remote URL or path, pulled on open and pushed after each change
+	Branch string // defaults to "main"
+}
+
+// GitStorage keeps each key as a file in a git working tree and commits
+// every change, so the history of the task list can be inspected with the
+// usual git tools. It shells out to the git binary.
+//
+// When a push is rejected because the remote moved on, local commits are
+// rebased onto it, preferring the local side of conflicting changes; the
+// overwritten remote version stays in the history.
+type GitStorage struct {
+	mu     sync.Mutex
+	path   string
+	remote string
+	branch string
+}
+
+func NewGitStorage(opts GitOptions) (*GitStorage, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, errors.New("git storage requires the git binary in PATH")
+	}
+	if opts.Branch == "" {
+		opts.Branch = "main"
+	}
+
+	gs := &GitStorage{path: opts.Path, remote: opts.Remote, branch: opts.Branch}
+	if err := gs.open(context.Background()); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// open initializes the repository and brings it up to date with the remote
+func (gs *GitStorage) open(ctx context.Context) error {
+	if err := os.MkdirAll(gs.path, 0700); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(gs.path, ".git")); os.IsNotExist(err) {
+		if _, err := gs.git(ctx, "init", "-q", "-b", gs.branch); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	// Commits need an identity; keep the user's own when configured
+	if name, _ := gs.git(ctx, "config", "user.name"); name == "" {
+		if _, err := gs.git(ctx, "config", "user.name", "todo"); err != nil {
+			return err
+		}
+	}
+	if email, _ := gs.git(ctx, "config", "user.email"); email == "" {
+		if _, err := gs.git(ctx, "config", "user.email", "todo@localhost"); err != nil {
+			return err
+		}
+	}
+
+	if gs.remote == "" {
+		return nil
+	}
+	if current, err := gs.git(ctx, "remote", "get-url", "origin"); err != nil {
+		if _, err := gs.git(ctx, "remote", "add", "origin", gs.remote); err != nil {
+			return err
+		}
+	} else if current != gs.remote {
+		if _, err := gs.git(ctx, "remote", "set-url", "origin", gs.remote); err != nil {
+			return err
+		}
+	}
+	// Work offline from the local history when the remote is unreachable
+	if err := gs.pull(ctx); err != nil {
+		log.Printf("Git pull failed, using the local repository: %v", err)
+	}
+	return nil
+}
+
+func (gs *GitStorage) Load(key string) ([]byte, error) {
+	return gs.LoadContext(context.Background(), key)
+}
+
+func (gs *GitStorage) Save(key string, data []byte) error {
+	return gs.SaveContext(context.Background(), key, data)
+}
+
+func (gs *GitStorage) Delete(key string) error {
+	return gs.DeleteContext(context.Background(), key)
+}
+
+func (gs *GitStorage) Exists(key string) (bool, error) {
+	return gs.ExistsContext(context.Background(), key)
+}
+
+func (gs *GitStorage) List(prefix string) ([]string, error) {
+	return gs.ListContext(context.Background(), prefix)
+}
+
+// Close is a no-op; every change is committed (and pushed) immediately
+func (gs *GitStorage) Close() error {
+	return nil
+}
+
+func (gs *GitStorage) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	return os.ReadFile(filepath.Join(gs.path, key))
+}
+
+func (gs *GitStorage) SaveContext(ctx context.Context, key string, data []byte) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(gs.path, key), data, 0600); err != nil {
+		return err
+	}
+	if _, err := gs.git(ctx, "add", "--", key); err != nil {
+		return err
+	}
+	return gs.commit(ctx, "Update "+key)
+}
+
+func (gs *GitStorage) DeleteContext(ctx context.Context, key string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(gs.path, key)); err != nil {
+		return err
+	}
+	if _, err := gs.git(ctx, "rm", "-q", "--", key); err != nil {
+		return err
+	}
+	return gs.commit(ctx, "Delete "+key)
+}
+
+func (gs *GitStorage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	_, err := os.Stat(filepath.Join(gs.path, key))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+func (gs *GitStorage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	entries, err := os.ReadDir(gs.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), prefix) {
+			continue
+		}
+		keys = append(keys, entry.Name())
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// commit records staged changes and pushes them. Saving unchanged data
+// creates no commit but still pushes, so an earlier failed push is retried.
+func (gs *GitStorage) commit(ctx context.Context, message string) error {
+	if _, err := gs.git(ctx, "diff", "--cached", "--quiet"); err != nil {
+		if _, err := gs.git(ctx, "commit", "-q", "-m", message); err != nil {
+			return err
+		}
+	}
+	if gs.remote == "" {
+		return nil
+	}
+	if err := gs.push(ctx); err != nil {
+		return fmt.Errorf("committed locally, but push failed: %w", err)
+	}
+	return nil
+}
+
+func (gs *GitStorage) push(ctx context.Context) error {
+	if _, err := gs.git(ctx, "push", "-q", "origin", "HEAD:"+gs.branch); err == nil {
+		return nil
+	}
+	// Rejected, most likely because another device pushed first
+	if err := gs.pull(ctx); err != nil {
+		return err
+	}
+	_, err := gs.git(ctx, "push", "-q", "origin", "HEAD:"+gs.branch)
+	return err
+}
+
+// pull rebases local commits onto the remote branch. An empty remote is
+// not an error.
+func (gs *GitStorage) pull(ctx context.Context) error {
+	if _, err := gs.git(ctx, "fetch", "-q", "origin"); err != nil {
+		return err
+	}
+	if _, err := gs.git(ctx, "rev-parse", "--verify", "-q", "origin/"+gs.branch); err != nil {
+		return nil
+	}
+	if _, err := gs.git(ctx, "rev-parse", "--verify", "-q", "HEAD"); err != nil {
+		// Fresh repository: start from the remote branch
+		_, err := gs.git(ctx, "reset", "-q", "--hard", "origin/"+gs.branch)
+		return err
+	}
+
+	// During a rebase "theirs" is the local commits being replayed
+	if _, err := gs.git(ctx, "rebase", "-q", "-X", "theirs", "origin/"+gs.branch); err != nil {
+		gs.git(ctx, "rebase", "--abort")
+		return err
+	}
+	return nil
+}
+
+func (gs *GitStorage) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", append([]string{"-C", gs.path}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, msg)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
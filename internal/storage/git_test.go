@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestGitStorage(t *testing.T, opts GitOptions) *GitStorage {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	if opts.Path == "" {
+		opts.Path = filepath.Join(t.TempDir(), "repo")
+	}
+
+	gs, err := NewGitStorage(opts)
+	if err != nil {
+		t.Fatalf("failed to create git storage: %v", err)
+	}
+	t.Cleanup(func() {
+		gs.Close()
+	})
+	return gs
+}
+
+// newBareRemote creates an empty bare repository to push to
+func newBareRemote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	path := filepath.Join(t.TempDir(), "remote.git")
+	if out, err := exec.Command("git", "init", "-q", "--bare", "-b", "main", path).CombinedOutput(); err != nil {
+		t.Fatalf("git init --bare failed: %v: %s", err, out)
+	}
+	return path
+}
+
+func gitLog(t *testing.T, gs *GitStorage) []string {
+	t.Helper()
+	out, err := gs.git(t.Context(), "log", "--format=%s")
+	if err != nil {
+		t.Fatalf("git log failed: %v", err)
+	}
+	return strings.Split(out, "\n")
+}
+
+func TestGitStorage_SaveCommits(t *testing.T) {
+	gs := newTestGitStorage(t, GitOptions{})
+
+	if err := gs.Save("todos.json", []byte("v1")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := gs.Save("todos.json", []byte("v2")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	// Unchanged data creates no commit
+	if err := gs.Save("todos.json", []byte("v2")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	data, err := gs.Load("todos.json")
+	if err != nil || string(data) != "v2" {
+		t.Fatalf("Load = %q, %v", data, err)
+	}
+
+	want := []string{"Update todos.json", "Update todos.json"}
+	if got := gitLog(t, gs); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected history %v, got %v", want, got)
+	}
+}
+
+func TestGitStorage_DeleteAndList(t *testing.T) {
+	gs := newTestGitStorage(t, GitOptions{})
+
+	gs.Save("backup.b", []byte("b"))
+	gs.Save("backup.a", []byte("a"))
+	gs.Save("todos.json", []byte("t"))
+
+	keys, err := gs.List("backup.")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if want := []string{"backup.a", "backup.b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+
+	if err := gs.Delete("backup.a"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, _ := gs.Exists("backup.a"); exists {
+		t.Error("expected key to be deleted")
+	}
+	if got := gitLog(t, gs)[0]; got != "Delete backup.a" {
+		t.Errorf("expected delete commit, got %q", got)
+	}
+
+	if err := gs.Delete("missing"); err == nil {
+		t.Error("expected error deleting a missing key")
+	}
+}
+
+func TestGitStorage_PushAndClone(t *testing.T) {
+	remote := newBareRemote(t)
+
+	first := newTestGitStorage(t, GitOptions{Remote: remote})
+	if err := first.Save("todos.json", []byte("from first")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	// A second device picks the data up on open
+	second := newTestGitStorage(t, GitOptions{Remote: remote})
+	data, err := second.Load("todos.json")
+	if err != nil || string(data) != "from first" {
+		t.Fatalf("Load on second device = %q, %v", data, err)
+	}
+}
+
+func TestGitStorage_DivergedPushRebases(t *testing.T) {
+	remote := newBareRemote(t)
+
+	first := newTestGitStorage(t, GitOptions{Remote: remote})
+	first.Save("todos.json", []byte("base"))
+	second := newTestGitStorage(t, GitOptions{Remote: remote})
+
+	if err := first.Save("todos.json", []byte("first")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := second.Save("notes.json", []byte("second")); err != nil {
+		t.Fatalf("Save on a diverged clone failed: %v", err)
+	}
+	if err := second.Save("todos.json", []byte("second")); err != nil {
+		t.Fatalf("conflicting Save failed: %v", err)
+	}
+
+	third := newTestGitStorage(t, GitOptions{Remote: remote})
+	if data, _ := third.Load("todos.json"); string(data) != "second" {
+		t.Errorf("expected the last pushed copy to win, got %q", data)
+	}
+	if data, _ := third.Load("notes.json"); string(data) != "second" {
+		t.Errorf("expected notes.json from the second device, got %q", data)
+	}
+
+	history := strings.Join(gitLog(t, third), "\n")
+	if strings.Count(history, "Update todos.json") != 3 {
+		t.Errorf("expected every save in the history, got:\n%s", history)
+	}
+}
+
+func TestGitStorage_PushFailureKeepsCommit(t *testing.T) {
+	gs := newTestGitStorage(t, GitOptions{Remote: filepath.Join(t.TempDir(), "missing.git")})
+
+	err := gs.Save("todos.json", []byte("v1"))
+	if err == nil || !strings.Contains(err.Error(), "committed locally") {
+		t.Fatalf("expected push error, got %v", err)
+	}
+	if data, _ := gs.Load("todos.json"); string(data) != "v1" {
+		t.Errorf("expected data to be committed locally, got %q", data)
+	}
+}
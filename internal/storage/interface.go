@@ -1,11 +1,16 @@
 package storage
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
+	"strings"
+	"time"
 )
 
 // Storage interface for different storage backends
@@ -14,6 +19,8 @@ type Storage interface {
 	Save(key string, data []byte) error
 	Delete(key string) error
 	Exists(key string) (bool, error)
+	List(prefix string) ([]string, error)
+	Close() error
 }
 
 // Encryptor handles data encryption/decryption
@@ -22,25 +29,145 @@ type Encryptor interface {
 	Decrypt(ciphertext []byte) ([]byte, error)
 }
 
-// AESEncryptor implements AES-GCM encryption
+// AEADEncryptor is implemented by encryptors that authenticate associated
+// data along with the ciphertext. StorageManager passes the storage key
+// name, so a value copied under another key fails to decrypt.
+type AEADEncryptor interface {
+	Encryptor
+	EncryptWithAD(plaintext, ad []byte) ([]byte, error)
+	DecryptWithAD(ciphertext, ad []byte) ([]byte, error)
+}
+
+// Wiper is implemented by encryptors that can zero their key material once
+// they are no longer used. StorageManager.Close calls it.
+type Wiper interface {
+	Wipe()
+}
+
+// KeyDeriver is implemented by encryptors that derive keys for other uses
+// from their data keys, e.g. to authenticate the audit log
+type KeyDeriver interface {
+	// DeriveKeys returns a key for label derived from each data key the
+	// encryptor decrypts with, the one it encrypts with first
+	DeriveKeys(label string) [][]byte
+}
+
+var (
+	// ErrUnknownKey is returned when data was encrypted with a key that is
+	// neither the current key nor one of the previous keys
+	ErrUnknownKey = errors.New("encrypted with an unknown key")
+
+	// ErrUnsupportedFormat is returned for envelopes written by a newer
+	// version or with an unknown algorithm
+	ErrUnsupportedFormat = errors.New("unsupported encryption format")
+
+	// ErrNotEncrypted is returned when loading plaintext JSON with
+	// encryption enabled, e.g. data written before encryption was added
+	ErrNotEncrypted = errors.New("data is not encrypted")
+
+	// ErrEncrypted is returned when loading encrypted data with
+	// encryption disabled
+	ErrEncrypted = errors.New("data is encrypted")
+)
+
+// Envelope layout:
+//
+//	magic | version | algorithm | compression | key ID | nonce | sealed
+//
+// The header and the associated data are authenticated as GCM additional
+// data. Version 1 had no compression byte. Data written before envelopes
+// were added is just nonce | sealed.
+var envelopeMagic = []byte("TDEV")
+
+const (
+	envelopeVersion  = 2
+	keyIDSize        = 8
+	envelopeHeader   = 4 + 1 + 1 + 1 + keyIDSize
+	envelopeHeaderV1 = 4 + 1 + 1 + keyIDSize
+)
+
+// Envelope algorithms
+const (
+	AlgAES256GCM byte = 1
+)
+
+// IsEnvelope reports whether data starts with an encryption envelope header
+func IsEnvelope(data []byte) bool {
+	return len(data) >= envelopeHeaderV1 && bytes.HasPrefix(data, envelopeMagic)
+}
+
+// IsEncrypted reports whether data is recognizably encrypted, with a key
+// or a passphrase. Data written before envelopes cannot be recognized.
+func IsEncrypted(data []byte) bool {
+	return IsEnvelope(data) || bytes.HasPrefix(data, passphraseMagic)
+}
+
+// IsPlaintext reports whether data is unencrypted JSON
+func IsPlaintext(data []byte) bool {
+	return !IsEncrypted(data) && json.Valid(data)
+}
+
+// AESEncryptor implements AES-GCM encryption. Ciphertexts carry the ID
+// of the key they were written with, so data encrypted with a previous
+// key (e.g. during key rotation) can still be read.
 type AESEncryptor struct {
-	key []byte
+	key      []byte
+	previous []*AESEncryptor // tried by Decrypt, never used to encrypt
 }
 
-func NewAESEncryptor(key []byte) (*AESEncryptor, error) {
+// NewAESEncryptor encrypts with key and decrypts with key or any of the
+// previous keys. The keys are copied, so the caller can clear its slices.
+func NewAESEncryptor(key []byte, previous ...[]byte) (*AESEncryptor, error) {
 	if len(key) != 32 { // AES-256
 		return nil, errors.New("key must be 32 bytes for AES-256")
 	}
-	return &AESEncryptor{key: key}, nil
+	e := &AESEncryptor{key: bytes.Clone(key)}
+	for _, k := range previous {
+		old, err := NewAESEncryptor(k)
+		if err != nil {
+			return nil, err
+		}
+		e.previous = append(e.previous, old)
+	}
+	return e, nil
+}
+
+// KeyID returns the ID stored with data encrypted with key
+func KeyID(key []byte) []byte {
+	sum := sha256.Sum256(key)
+	return sum[:keyIDSize]
+}
+
+// Fingerprint formats the key ID for people to compare across devices,
+// e.g. "1a2b-3c4d-5e6f-7a8b"
+func Fingerprint(key []byte) string {
+	id := hex.EncodeToString(KeyID(key))
+	groups := make([]string, 0, len(id)/4)
+	for i := 0; i < len(id); i += 4 {
+		groups = append(groups, id[i:i+4])
+	}
+	return strings.Join(groups, "-")
 }
 
 func (e *AESEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
+	return e.EncryptWithAD(plaintext, nil)
+}
+
+func (e *AESEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	return e.DecryptWithAD(ciphertext, nil)
+}
+
+func (e *AESEncryptor) EncryptWithAD(plaintext, ad []byte) ([]byte, error) {
+	return e.EncryptCompressed(plaintext, ad, CompressNone)
+}
+
+func (e *AESEncryptor) EncryptCompressed(plaintext, ad []byte, c Compression) ([]byte, error) {
+	plaintext, err := compress(c, plaintext)
 	if err != nil {
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(e.key)
 	if err != nil {
 		return nil, err
 	}
@@ -50,17 +177,82 @@ func (e *AESEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
 		return nil, err
 	}
 
-	ciphertext := gcm.Seal(nonce, nonce, plaintext, nil)
-	return ciphertext, nil
+	header := make([]byte, 0, envelopeHeader+len(nonce))
+	header = append(header, envelopeMagic...)
+	header = append(header, envelopeVersion, AlgAES256GCM, byte(c))
+	header = append(header, KeyID(e.key)...)
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, envelopeAD(header, ad)), nil
 }
 
-func (e *AESEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
-	block, err := aes.NewCipher(e.key)
-	if err != nil {
+func (e *AESEncryptor) DecryptWithAD(ciphertext, ad []byte) ([]byte, error) {
+	if !IsEnvelope(ciphertext) {
+		// Written before envelopes: try every key
+		var err error
+		for _, k := range e.keys() {
+			var plaintext []byte
+			if plaintext, err = k.open(ciphertext, nil); err == nil {
+				return plaintext, nil
+			}
+		}
 		return nil, err
 	}
 
-	gcm, err := cipher.NewGCM(block)
+	size, c := envelopeHeader, CompressNone
+	switch v := ciphertext[4]; v {
+	case 1:
+		size = envelopeHeaderV1
+	case envelopeVersion:
+		if len(ciphertext) < envelopeHeader {
+			return nil, fmt.Errorf("%w: truncated envelope", ErrCorrupted)
+		}
+		c = Compression(ciphertext[6])
+		if !c.valid() {
+			return nil, fmt.Errorf("%w: compression %d", ErrUnsupportedFormat, c)
+		}
+	default:
+		return nil, fmt.Errorf("%w: envelope version %d", ErrUnsupportedFormat, v)
+	}
+	if alg := ciphertext[5]; alg != AlgAES256GCM {
+		return nil, fmt.Errorf("%w: algorithm %d", ErrUnsupportedFormat, alg)
+	}
+
+	header, body := ciphertext[:size], ciphertext[size:]
+	id := header[size-keyIDSize:]
+	for _, k := range e.keys() {
+		if bytes.Equal(KeyID(k.key), id) {
+			plaintext, err := k.open(body, envelopeAD(header, ad))
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+			}
+			return decompress(c, plaintext)
+		}
+	}
+	return nil, fmt.Errorf("%w %x", ErrUnknownKey, id)
+}
+
+// Wipe zeroes the keys; the encryptor cannot be used afterwards
+func (e *AESEncryptor) Wipe() {
+	for _, k := range e.keys() {
+		clear(k.key)
+	}
+}
+
+func (e *AESEncryptor) DeriveKeys(label string) [][]byte {
+	var keys [][]byte
+	for _, k := range e.keys() {
+		keys = append(keys, hmacSHA256(k.key, label))
+	}
+	return keys
+}
+
+func (e *AESEncryptor) keys() []*AESEncryptor {
+	return append([]*AESEncryptor{e}, e.previous...)
+}
+
+// open decrypts nonce | sealed
+func (e *AESEncryptor) open(ciphertext, ad []byte) ([]byte, error) {
+	gcm, err := newGCM(e.key)
 	if err != nil {
 		return nil, err
 	}
@@ -71,60 +263,204 @@ func (e *AESEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
 	}
 
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return nil, err
-	}
+	return gcm.Open(nil, nonce, ciphertext, ad)
+}
 
-	return plaintext, nil
+// envelopeAD is the GCM additional data for an envelope: the header,
+// then the caller's associated data
+func envelopeAD(header, ad []byte) []byte {
+	return append(bytes.Clone(header), ad...)
 }
 
 // StorageManager
 type StorageManager struct {
-	storage   Storage
-	encryptor Encryptor
+	operationScope
+	storage     Storage
+	encryptor   Encryptor
+	compression Compression
+
+	backups    *BackupPolicy
+	lastBackup map[string]time.Time
+	clock      func() time.Time
 }
 
 func NewStorageManager(storage Storage, encryptor Encryptor) *StorageManager {
 	return &StorageManager{
-		storage:   storage,
-		encryptor: encryptor,
+		operationScope: newOperationScope(),
+		storage:        storage,
+		encryptor:      encryptor,
 	}
 }
 
+// Encryptor returns the encryptor, or nil when encryption is disabled
+func (sm *StorageManager) Encryptor() Encryptor {
+	return sm.encryptor
+}
+
 func (sm *StorageManager) Load(key string) ([]byte, error) {
-	data, err := sm.storage.Load(key)
+	ctx, cancel := sm.operationContext()
+	defer cancel()
+
+	data, err := loadContext(ctx, sm.storage, key)
 	if err != nil {
 		return nil, err
 	}
+	return sm.decrypt(key, data)
+}
+
+// decrypt returns the plaintext of data stored under key
+func (sm *StorageManager) decrypt(key string, data []byte) ([]byte, error) {
+	if sm.encryptor == nil {
+		if IsEncrypted(data) {
+			return nil, fmt.Errorf("%w: %s", ErrEncrypted, key)
+		}
+		return data, nil
+	}
+
+	plaintext, err := DecryptValue(sm.encryptor, key, data)
+	if err != nil && IsPlaintext(data) {
+		return nil, fmt.Errorf("%w: %s", ErrNotEncrypted, key)
+	}
+	return plaintext, err
+}
 
-	if sm.encryptor != nil {
-		return sm.encryptor.Decrypt(data)
+// EncryptPlaintext encrypts key in place if it holds plaintext JSON and
+// reports whether it did. The encrypted copy is read back before returning.
+func (sm *StorageManager) EncryptPlaintext(key string) (bool, error) {
+	if sm.encryptor == nil {
+		return false, errors.New("encryption is disabled")
 	}
 
-	return data, nil
+	ctx, cancel := sm.operationContext()
+	data, err := loadContext(ctx, sm.storage, key)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	if !IsPlaintext(data) {
+		return false, nil
+	}
+
+	if err := sm.Save(key, data); err != nil && !errors.Is(err, ErrBackupFailed) {
+		return false, err
+	}
+	check, err := sm.Load(key)
+	if err != nil {
+		return true, fmt.Errorf("verification failed for %s: %w", key, err)
+	}
+	if !bytes.Equal(check, data) {
+		return true, fmt.Errorf("verification failed for %s: data does not match", key)
+	}
+	return true, nil
 }
 
 func (sm *StorageManager) Save(key string, data []byte) error {
-	var toSave []byte
-	var err error
+	toSave, err := sm.encrypt(key, data)
+	if err != nil {
+		return err
+	}
 
-	if sm.encryptor != nil {
-		toSave, err = sm.encryptor.Encrypt(data)
-		if err != nil {
-			return err
+	ctx, cancel := sm.operationContext()
+	defer cancel()
+
+	if err := saveContext(ctx, sm.storage, key, toSave); err != nil {
+		return err
+	}
+
+	if err := sm.maybeSnapshot(key, data); err != nil {
+		return fmt.Errorf("%w: %v", ErrBackupFailed, err)
+	}
+	return nil
+}
+
+// encrypt returns data as stored under key
+func (sm *StorageManager) encrypt(key string, data []byte) ([]byte, error) {
+	if sm.encryptor == nil {
+		return data, nil
+	}
+	return encryptValue(sm.encryptor, key, data, sm.compression)
+}
+
+// SetCompression compresses values before encryption with c. The
+// compression is recorded in the encryptor's header (see
+// CompressingEncryptor), so it fails without encryption or with an
+// encryptor that has no such header, instead of storing values
+// uncompressed.
+func (sm *StorageManager) SetCompression(c Compression) error {
+	if c != CompressNone {
+		if sm.encryptor == nil {
+			return fmt.Errorf("%s compression needs encryption: values are compressed inside the encrypted envelope", c)
+		}
+		if _, ok := sm.encryptor.(CompressingEncryptor); !ok {
+			return fmt.Errorf("%s compression is only supported with a key or passphrase", c)
 		}
-	} else {
-		toSave = data
 	}
+	sm.compression = c
+	return nil
+}
+
+// EncryptValue encrypts the value stored under key, binding it to the key
+// when the encryptor supports associated data
+func EncryptValue(e Encryptor, key string, data []byte) ([]byte, error) {
+	return encryptValue(e, key, data, CompressNone)
+}
+
+func encryptValue(e Encryptor, key string, data []byte, c Compression) ([]byte, error) {
+	if ce, ok := e.(CompressingEncryptor); ok && c != CompressNone {
+		return ce.EncryptCompressed(data, storageAD(key), c)
+	}
+	if aead, ok := e.(AEADEncryptor); ok {
+		return aead.EncryptWithAD(data, storageAD(key))
+	}
+	return e.Encrypt(data)
+}
 
-	return sm.storage.Save(key, toSave)
+// DecryptValue decrypts the value stored under key
+func DecryptValue(e Encryptor, key string, data []byte) ([]byte, error) {
+	if aead, ok := e.(AEADEncryptor); ok {
+		return aead.DecryptWithAD(data, storageAD(key))
+	}
+	return e.Decrypt(data)
+}
+
+// storageAD is the associated data for a storage key. Conflict copies made
+// by CachedStorage hold the remote ciphertext of the original key, so they
+// authenticate as that key.
+func storageAD(key string) []byte {
+	if i := strings.Index(key, conflictInfix); i > 0 {
+		key = key[:i]
+	}
+	return []byte(key)
 }
 
 func (sm *StorageManager) Delete(key string) error {
-	return sm.storage.Delete(key)
+	ctx, cancel := sm.operationContext()
+	defer cancel()
+
+	return deleteContext(ctx, sm.storage, key)
 }
 
 func (sm *StorageManager) Exists(key string) (bool, error) {
-	return sm.storage.Exists(key)
+	ctx, cancel := sm.operationContext()
+	defer cancel()
+
+	return existsContext(ctx, sm.storage, key)
+}
+
+// Close cancels in-flight operations and releases the backend's connections.
+// Pending saves must be flushed by the caller before closing.
+func (sm *StorageManager) Close() error {
+	sm.Cancel()
+	err := sm.storage.Close()
+	if w, ok := sm.encryptor.(Wiper); ok {
+		w.Wipe()
+	}
+	return err
+}
+
+func (sm *StorageManager) List(prefix string) ([]string, error) {
+	ctx, cancel := sm.operationContext()
+	defer cancel()
+
+	return listContext(ctx, sm.storage, prefix)
 }
@@ -3,6 +3,8 @@ package storage
 import (
 	"bytes"
 	"errors"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -12,6 +14,7 @@ type mockStorage struct {
 	saveErr   error
 	deleteErr error
 	existsErr error
+	closed    bool
 }
 
 func newMockStorage() *mockStorage {
@@ -55,6 +58,22 @@ func (m *mockStorage) Exists(key string) (bool, error) {
 	return ok, nil
 }
 
+func (m *mockStorage) Close() error {
+	m.closed = true
+	return nil
+}
+
+func (m *mockStorage) List(prefix string) ([]string, error) {
+	var keys []string
+	for k := range m.data {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
 func TestAESEncryptor_New(t *testing.T) {
 	key := make([]byte, 32)
 	_, err := NewAESEncryptor(key)
@@ -101,6 +120,163 @@ func TestAESEncryptor_Decrypt_InvalidCiphertext(t *testing.T) {
 	}
 }
 
+func TestAESEncryptor_PreviousKeys(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	oldEnc, _ := NewAESEncryptor(oldKey)
+	written, _ := oldEnc.Encrypt([]byte("old data"))
+
+	if !bytes.Equal(written[envelopeHeader-keyIDSize:envelopeHeader], KeyID(oldKey)) {
+		t.Fatal("expected the key ID in the ciphertext header")
+	}
+
+	rotating, err := NewAESEncryptor(newKey, oldKey)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data, err := rotating.Decrypt(written); err != nil || string(data) != "old data" {
+		t.Fatalf("Decrypt with a previous key = %q, %v", data, err)
+	}
+
+	// New data is only readable with the new key
+	rewritten, _ := rotating.Encrypt([]byte("new data"))
+	if _, err := oldEnc.Decrypt(rewritten); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+	newEnc, _ := NewAESEncryptor(newKey)
+	if _, err := newEnc.Decrypt(written); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey for data of a dropped key, got %v", err)
+	}
+}
+
+func TestStorageManager_Close_WipesKeys(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	encryptor, _ := NewAESEncryptor(key, bytes.Repeat([]byte{2}, 32))
+	clear(key) // the encryptor keeps its own copy
+	if _, err := encryptor.Encrypt([]byte("data")); err != nil {
+		t.Fatalf("Encrypt failed after clearing the caller's key: %v", err)
+	}
+
+	sm := NewStorageManager(newMockStorage(), encryptor)
+	if err := sm.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for _, k := range encryptor.keys() {
+		if !bytes.Equal(k.key, make([]byte, 32)) {
+			t.Errorf("expected the key to be zeroed, got %x", k.key)
+		}
+	}
+}
+
+func TestAESEncryptor_DeriveKeys(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+	oldEnc, _ := NewAESEncryptor(oldKey)
+	rotating, _ := NewAESEncryptor(newKey, oldKey)
+
+	keys := rotating.DeriveKeys("audit")
+	if len(keys) != 2 {
+		t.Fatalf("expected a key per data key, got %d", len(keys))
+	}
+	if !bytes.Equal(keys[1], oldEnc.DeriveKeys("audit")[0]) {
+		t.Error("expected the previous key's derived key second")
+	}
+	if bytes.Equal(keys[0], newKey) || bytes.Equal(keys[0], rotating.DeriveKeys("other")[0]) {
+		t.Error("expected a key that differs from the data key and per label")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	fp := Fingerprint(key)
+	if len(fp) != 19 || strings.Count(fp, "-") != 3 {
+		t.Fatalf("unexpected fingerprint format %q", fp)
+	}
+	if fp == Fingerprint(bytes.Repeat([]byte{2}, 32)) {
+		t.Error("different keys have the same fingerprint")
+	}
+}
+
+func TestAESEncryptor_DecryptLegacy(t *testing.T) {
+	key := bytes.Repeat([]byte{3}, 32)
+	gcm, _ := newGCM(key)
+	nonce := make([]byte, gcm.NonceSize())
+	legacy := gcm.Seal(nonce, nonce, []byte("before key IDs"), nil)
+
+	enc, _ := NewAESEncryptor(bytes.Repeat([]byte{4}, 32), key)
+	if data, err := enc.Decrypt(legacy); err != nil || string(data) != "before key IDs" {
+		t.Fatalf("Decrypt = %q, %v", data, err)
+	}
+}
+
+func TestAESEncryptor_Decrypt_Corrupted(t *testing.T) {
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	ciphertext, _ := enc.Encrypt([]byte("data"))
+	ciphertext[len(ciphertext)-1] ^= 1
+
+	if _, err := enc.Decrypt(ciphertext); !errors.Is(err, ErrCorrupted) {
+		t.Fatalf("expected ErrCorrupted, got %v", err)
+	}
+}
+
+func TestAESEncryptor_Envelope(t *testing.T) {
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	ciphertext, _ := enc.EncryptWithAD([]byte("data"), []byte("todos.json"))
+
+	if !IsEnvelope(ciphertext) || ciphertext[4] != envelopeVersion || ciphertext[5] != AlgAES256GCM {
+		t.Fatalf("unexpected envelope header %x", ciphertext[:envelopeHeader])
+	}
+	if IsEnvelope([]byte(`{"tasks":[]}`)) {
+		t.Error("plain JSON detected as an envelope")
+	}
+
+	tests := map[string]func([]byte) []byte{
+		"newer version":     func(c []byte) []byte { c[4] = envelopeVersion + 1; return c },
+		"unknown algorithm": func(c []byte) []byte { c[5] = 0xff; return c },
+	}
+	for name, tamper := range tests {
+		_, err := enc.DecryptWithAD(tamper(bytes.Clone(ciphertext)), []byte("todos.json"))
+		if !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("%s: expected ErrUnsupportedFormat, got %v", name, err)
+		}
+	}
+}
+
+func TestAESEncryptor_AssociatedData(t *testing.T) {
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	ciphertext, _ := enc.EncryptWithAD([]byte("data"), []byte("todos.json"))
+
+	if data, err := enc.DecryptWithAD(ciphertext, []byte("todos.json")); err != nil || string(data) != "data" {
+		t.Fatalf("DecryptWithAD = %q, %v", data, err)
+	}
+	if _, err := enc.DecryptWithAD(ciphertext, []byte("notes.json")); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for other associated data, got %v", err)
+	}
+}
+
+func TestStorageManager_BindsKeyName(t *testing.T) {
+	st := newMockStorage()
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	sm := NewStorageManager(st, enc)
+
+	if err := sm.Save("todos.json", []byte("tasks")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	// A value swapped in from another key is rejected
+	st.data["notes.json"] = st.data["todos.json"]
+	if _, err := sm.Load("notes.json"); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted, got %v", err)
+	}
+
+	// Conflict copies hold the ciphertext of the original key
+	st.data["todos.json.conflict.20250301T120000Z"] = st.data["todos.json"]
+	if data, err := sm.Load("todos.json.conflict.20250301T120000Z"); err != nil || string(data) != "tasks" {
+		t.Errorf("Load conflict copy = %q, %v", data, err)
+	}
+}
+
 func TestStorageManager_SaveLoad_NoEncryption(t *testing.T) {
 	st := newMockStorage()
 	sm := NewStorageManager(st, nil)
@@ -203,3 +379,70 @@ func TestStorageManager_Exists(t *testing.T) {
 		t.Fatalf("expected key to exist")
 	}
 }
+
+func TestStorageManager_List(t *testing.T) {
+	st := newMockStorage()
+	sm := NewStorageManager(st, nil)
+
+	st.data["a.json"] = []byte("1")
+	st.data["b.json"] = []byte("2")
+
+	keys, err := sm.List("a")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "a.json" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestStorageManager_Close(t *testing.T) {
+	st := newMockStorage()
+	sm := NewStorageManager(st, nil)
+
+	if err := sm.Close(); err != nil {
+		t.Fatalf("close failed: %v", err)
+	}
+	if !st.closed {
+		t.Fatalf("expected backend to be closed")
+	}
+}
+
+func TestStorageManager_Load_Plaintext(t *testing.T) {
+	st := newMockStorage()
+	st.data["todos.json"] = []byte(`{"tasks":[]}`)
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+
+	if _, err := NewStorageManager(st, enc).Load("todos.json"); !errors.Is(err, ErrNotEncrypted) {
+		t.Fatalf("expected ErrNotEncrypted, got %v", err)
+	}
+
+	// Encrypted data is not handed out as is with encryption disabled
+	NewStorageManager(st, enc).Save("notes.json", []byte("notes"))
+	if _, err := NewStorageManager(st, nil).Load("notes.json"); !errors.Is(err, ErrEncrypted) {
+		t.Fatalf("expected ErrEncrypted, got %v", err)
+	}
+}
+
+func TestStorageManager_EncryptPlaintext(t *testing.T) {
+	st := newMockStorage()
+	st.data["todos.json"] = []byte(`{"tasks":[]}`)
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	sm := NewStorageManager(st, enc)
+
+	encrypted, err := sm.EncryptPlaintext("todos.json")
+	if err != nil || !encrypted {
+		t.Fatalf("EncryptPlaintext = %v, %v", encrypted, err)
+	}
+	if !IsEnvelope(st.data["todos.json"]) {
+		t.Fatal("expected the data to be encrypted in place")
+	}
+	if data, err := sm.Load("todos.json"); err != nil || string(data) != `{"tasks":[]}` {
+		t.Fatalf("Load = %q, %v", data, err)
+	}
+
+	// Already encrypted data is left alone
+	if encrypted, err := sm.EncryptPlaintext("todos.json"); err != nil || encrypted {
+		t.Fatalf("second EncryptPlaintext = %v, %v", encrypted, err)
+	}
+}
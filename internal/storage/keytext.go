@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// keyArmorType is the PEM block type of an armored key
+const keyArmorType = "TODO ENCRYPTION KEY"
+
+// ArmorKey formats a key as a PEM block carrying its fingerprint, so a
+// key damaged in transit is detected on import
+func ArmorKey(key []byte) string {
+	return string(pem.EncodeToMemory(&pem.Block{
+		Type:    keyArmorType,
+		Headers: map[string]string{"Fingerprint": Fingerprint(key)},
+		Bytes:   key,
+	}))
+}
+
+// KeyMnemonic formats a 32-byte key as a 24-word BIP-39 recovery phrase
+func KeyMnemonic(key []byte) (string, error) {
+	return bip39.NewMnemonic(key)
+}
+
+// ParseKeyText accepts an armored key, a 24-word recovery phrase or 64 hex
+// characters, as written by ArmorKey, KeyMnemonic or hex encoding
+func ParseKeyText(text string) ([]byte, error) {
+	// Indentation and CRLF line ends, e.g. from an email, do not matter
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = strings.Join(lines, "\n")
+
+	if block, _ := pem.Decode([]byte(text)); block != nil {
+		if block.Type != keyArmorType {
+			return nil, fmt.Errorf("unexpected armored block %q", block.Type)
+		}
+		if len(block.Bytes) != 32 {
+			return nil, fmt.Errorf("armored key must be 32 bytes, got %d", len(block.Bytes))
+		}
+		if fp := block.Headers["Fingerprint"]; fp != "" && fp != Fingerprint(block.Bytes) {
+			return nil, errors.New("armored key does not match its fingerprint, it was damaged in transit")
+		}
+		return block.Bytes, nil
+	}
+	if strings.HasPrefix(text, "-----BEGIN") {
+		return nil, errors.New("armored key is incomplete or damaged")
+	}
+
+	if len(text) == 64 {
+		if raw, err := hex.DecodeString(text); err == nil {
+			return raw, nil
+		}
+	}
+
+	words := strings.Fields(strings.ToLower(text))
+	raw, err := bip39.EntropyFromMnemonic(strings.Join(words, " "))
+	if err != nil {
+		return nil, fmt.Errorf("not a key: expected an armored key, a 24-word recovery phrase or 64 hex characters (%v)", err)
+	}
+	if len(raw) != 32 {
+		return nil, fmt.Errorf("recovery phrase must have 24 words, got %d", len(words))
+	}
+	return raw, nil
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestParseKeyText_RoundTrip(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab, 0x01}, 16)
+	mnemonic, err := KeyMnemonic(key)
+	if err != nil {
+		t.Fatalf("KeyMnemonic failed: %v", err)
+	}
+	if words := len(strings.Fields(mnemonic)); words != 24 {
+		t.Fatalf("expected 24 words, got %d", words)
+	}
+
+	inputs := map[string]string{
+		"armor":            ArmorKey(key),
+		"armor indented":   "\n  " + strings.ReplaceAll(ArmorKey(key), "\n", "\r\n  "),
+		"mnemonic":         mnemonic,
+		"mnemonic wrapped": strings.ToUpper(strings.Replace(mnemonic, " ", "\n", 6)),
+		"hex":              hex.EncodeToString(key) + "\n",
+	}
+	for name, text := range inputs {
+		got, err := ParseKeyText(text)
+		if err != nil {
+			t.Errorf("%s: ParseKeyText failed: %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, key) {
+			t.Errorf("%s: got key %x, want %x", name, got, key)
+		}
+	}
+}
+
+func TestParseKeyText_Invalid(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	armor := ArmorKey(key)
+	mnemonic, _ := KeyMnemonic(key)
+	words := strings.Fields(mnemonic)
+
+	inputs := map[string]string{
+		"damaged fingerprint": strings.Replace(armor, Fingerprint(key), Fingerprint(bytes.Repeat([]byte{8}, 32)), 1),
+		"truncated armor":     armor[:len(armor)/2],
+		"other block":         strings.ReplaceAll(armor, keyArmorType, "PRIVATE KEY"),
+		"12 words":            strings.Join(words[:12], " "),
+		"wrong checksum":      strings.Join(append(words[:23], words[0]), " "),
+		"short hex":           hex.EncodeToString(key[:16]),
+		"empty":               "",
+	}
+	for name, text := range inputs {
+		if _, err := ParseKeyText(text); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
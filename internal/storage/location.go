@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// pathLocation returns path made absolute with symlinks resolved, so two
+// spellings of the same directory compare equal
+func pathLocation(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	return filepath.Clean(path)
+}
+
+// urlLocation returns the host and path of a URL, without credentials or
+// query parameters
+func urlLocation(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.Host == "" {
+		return RedactURL(value)
+	}
+	return strings.ToLower(u.Host) + strings.TrimSuffix(u.Path, "/")
+}
+
+// dsnLocation returns the server and database of a PostgreSQL URL or
+// key=value connection string
+func dsnLocation(dsn string) string {
+	if strings.Contains(dsn, "://") {
+		return urlLocation(dsn)
+	}
+
+	params := make(map[string]string)
+	for _, match := range keyValueParam.FindAllStringSubmatch(dsn, -1) {
+		params[strings.ToLower(match[1])] = strings.Trim(match[2], "'")
+	}
+	host := strings.ToLower(params["host"])
+	if port := params["port"]; port != "" {
+		host += ":" + port
+	}
+	return host + "/" + params["dbname"]
+}
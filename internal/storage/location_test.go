@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestBackend_Location(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		backend string
+		a, b    BackendConfig
+		same    bool
+	}{
+		{"file", BackendConfig{DataPath: dir}, BackendConfig{DataPath: filepath.Join(dir, ".", "sub", "..")}, true},
+		{"file", BackendConfig{DataPath: dir}, BackendConfig{DataPath: filepath.Join(dir, "other")}, false},
+		{"sqlite", BackendConfig{DataPath: dir}, BackendConfig{Settings: Settings{"SQLITE_PATH": filepath.Join(dir, "todo.db")}}, true},
+		{"s3",
+			BackendConfig{Settings: Settings{"S3_BUCKET": "todo", "S3_PREFIX": "alice/", "S3_ACCESS_KEY_ID": "AKIA1"}},
+			BackendConfig{Settings: Settings{"S3_BUCKET": "todo", "S3_PREFIX": "alice/", "S3_PROFILE": "work"}},
+			true},
+		{"s3",
+			BackendConfig{Settings: Settings{"S3_BUCKET": "todo", "S3_PREFIX": "alice/"}},
+			BackendConfig{Settings: Settings{"S3_BUCKET": "todo", "S3_PREFIX": "bob/"}},
+			false},
+		{"postgres",
+			BackendConfig{Settings: Settings{"POSTGRES_DSN": "postgres://todo:one@DB:5432/todo?sslmode=disable"}},
+			BackendConfig{Settings: Settings{"POSTGRES_DSN": "postgres://admin:two@db:5432/todo", "POSTGRES_DRIVER": "pgx"}},
+			true},
+		{"postgres",
+			BackendConfig{Settings: Settings{"POSTGRES_DSN": "host=db port=5432 dbname=todo password=one"}},
+			BackendConfig{Settings: Settings{"POSTGRES_DSN": "host=db port=5432 dbname=todo_test password=one"}},
+			false},
+		{"redis",
+			BackendConfig{Settings: Settings{"REDIS_URL": "redis://:secret@localhost:6379"}},
+			BackendConfig{Settings: Settings{"REDIS_URL": "redis://localhost:6379/0"}},
+			true},
+	}
+	for _, tt := range tests {
+		backend, ok := LookupBackend(tt.backend)
+		if !ok {
+			t.Fatalf("backend %s is not registered", tt.backend)
+		}
+		a, err := backend.Location(tt.a)
+		if err != nil {
+			t.Fatalf("%s: Location failed: %v", tt.backend, err)
+		}
+		b, err := backend.Location(tt.b)
+		if err != nil {
+			t.Fatalf("%s: Location failed: %v", tt.backend, err)
+		}
+		if (a == b) != tt.same {
+			t.Errorf("%s: locations %q and %q, want same=%t", tt.backend, a, b, tt.same)
+		}
+	}
+}
+
+func TestBackend_Location_HidesCredentials(t *testing.T) {
+	backend, _ := LookupBackend("postgres")
+	location, err := backend.Location(BackendConfig{Settings: Settings{"POSTGRES_DSN": "postgres://todo:s3cret@db/todo"}})
+	if err != nil {
+		t.Fatalf("Location failed: %v", err)
+	}
+	if location != "postgres:db/todo#.tasks" {
+		t.Errorf("unexpected location %q", location)
+	}
+}
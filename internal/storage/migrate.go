@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// MigrateOptions controls how Migrate copies keys between backends
+type MigrateOptions struct {
+	Keys         []string // keys to copy; every key in the source when empty
+	DeleteSource bool     // delete source keys once the copy is verified
+
+	// Include filters the listed source keys when Keys is empty, e.g. to
+	// leave out unrelated files in a shared directory. Optional.
+	Include func(key string) bool
+}
+
+// MigrateResult lists the keys Migrate copied, deleted and skipped
+type MigrateResult struct {
+	Copied  []string
+	Deleted []string
+	Skipped []string // listed keys left out by MigrateOptions.Include
+}
+
+// Migrate copies keys from src to dst. Data is decrypted with the source
+// encryptor and re-encrypted with the destination's, then read back from
+// dst and compared before anything is removed from src.
+func Migrate(src, dst *StorageManager, opts MigrateOptions) (*MigrateResult, error) {
+	result := &MigrateResult{}
+	keys := opts.Keys
+	if len(keys) == 0 {
+		listed, err := src.List("")
+		if err != nil {
+			return nil, fmt.Errorf("failed to list source keys: %w", err)
+		}
+		for _, key := range listed {
+			switch {
+			case key == RecipientsKey:
+				// The recipient set belongs to the source's encryption, not its data
+			case opts.Include != nil && !opts.Include(key):
+				result.Skipped = append(result.Skipped, key)
+			default:
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	plaintexts := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		data, err := src.Load(key)
+		if err != nil {
+			return result, fmt.Errorf("failed to read %q from source: %w", key, err)
+		}
+		if err := dst.Save(key, data); err != nil {
+			return result, fmt.Errorf("failed to write %q to destination: %w", key, err)
+		}
+		plaintexts[key] = data
+		result.Copied = append(result.Copied, key)
+	}
+
+	for _, key := range keys {
+		data, err := dst.Load(key)
+		if err != nil {
+			return result, fmt.Errorf("failed to verify %q in destination: %w", key, err)
+		}
+		if !bytes.Equal(data, plaintexts[key]) {
+			return result, fmt.Errorf("verification failed for %q: destination data does not match source", key)
+		}
+	}
+
+	if !opts.DeleteSource {
+		return result, nil
+	}
+
+	for _, key := range keys {
+		if err := src.Delete(key); err != nil {
+			return result, fmt.Errorf("failed to delete %q from source: %w", key, err)
+		}
+		result.Deleted = append(result.Deleted, key)
+	}
+	return result, nil
+}
+
+// CopyRecords copies every task record from src to dst, encrypting the
+// titles with dst's encryptor, and reads them back from dst to verify the
+// copy. It returns the copied records, decrypted.
+func CopyRecords(src, dst *RecordManager) ([]TaskRecord, error) {
+	tasks, err := src.ListTasks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read task records: %w", err)
+	}
+	for _, task := range tasks {
+		if err := dst.PutTask(task); err != nil {
+			return nil, fmt.Errorf("failed to write task record %d: %w", task.ID, err)
+		}
+	}
+
+	copied, err := dst.ListTasks()
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify task records: %w", err)
+	}
+	byID := make(map[int64]TaskRecord, len(copied))
+	for _, task := range copied {
+		byID[task.ID] = task
+	}
+	for _, task := range tasks {
+		if got, ok := byID[task.ID]; !ok || !sameRecord(got, task) {
+			return nil, fmt.Errorf("verification failed for task record %d: destination does not match source", task.ID)
+		}
+	}
+	return tasks, nil
+}
+
+// sameRecord compares due times to the millisecond, the precision MongoDB
+// keeps
+func sameRecord(a, b TaskRecord) bool {
+	return a.ID == b.ID &&
+		a.Title == b.Title &&
+		a.Done == b.Done &&
+		a.Notified == b.Notified &&
+		a.DueAt.Truncate(time.Millisecond).Equal(b.DueAt.Truncate(time.Millisecond))
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMigrate_ReencryptsAllKeys(t *testing.T) {
+	srcEnc, _ := NewAESEncryptor(bytes.Repeat([]byte{1}, 32))
+	dstEnc, _ := NewAESEncryptor(bytes.Repeat([]byte{2}, 32))
+	srcStore, dstStore := newMockStorage(), newMockStorage()
+	src := NewStorageManager(srcStore, srcEnc)
+	dst := NewStorageManager(dstStore, dstEnc)
+
+	_ = src.Save("todos.json", []byte("tasks"))
+	_ = src.Save("settings.json", []byte("settings"))
+
+	result, err := Migrate(src, dst, MigrateOptions{})
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(result.Copied) != 2 || len(result.Deleted) != 0 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	out, err := dst.Load("todos.json")
+	if err != nil || string(out) != "tasks" {
+		t.Fatalf("unexpected destination data: %q, %v", out, err)
+	}
+	if _, err := srcEnc.Decrypt(dstStore.data["todos.json"]); err == nil {
+		t.Fatalf("destination should be encrypted with the destination key")
+	}
+	if len(srcStore.data) != 2 {
+		t.Fatalf("source should be kept")
+	}
+}
+
+func TestMigrate_SelectedKeysAndDeleteSource(t *testing.T) {
+	srcStore, dstStore := newMockStorage(), newMockStorage()
+	src := NewStorageManager(srcStore, nil)
+	dst := NewStorageManager(dstStore, nil)
+
+	srcStore.data["a"] = []byte("1")
+	srcStore.data["b"] = []byte("2")
+
+	result, err := Migrate(src, dst, MigrateOptions{Keys: []string{"a"}, DeleteSource: true})
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(result.Deleted) != 1 || result.Deleted[0] != "a" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if _, ok := srcStore.data["a"]; ok {
+		t.Fatalf("expected source key to be deleted")
+	}
+	if _, ok := dstStore.data["b"]; ok {
+		t.Fatalf("unselected key should not be copied")
+	}
+}
+
+func TestMigrate_SourceDecryptError(t *testing.T) {
+	srcStore := newMockStorage()
+	srcStore.data["todos.json"] = []byte("not encrypted")
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	src := NewStorageManager(srcStore, enc)
+	dst := NewStorageManager(newMockStorage(), nil)
+
+	if _, err := Migrate(src, dst, MigrateOptions{DeleteSource: true}); err == nil {
+		t.Fatalf("expected decrypt error")
+	}
+	if _, ok := srcStore.data["todos.json"]; !ok {
+		t.Fatalf("source must not be deleted on failure")
+	}
+}
+
+func TestMigrate_DestinationWriteError(t *testing.T) {
+	srcStore, dstStore := newMockStorage(), newMockStorage()
+	srcStore.data["a"] = []byte("1")
+	dstStore.saveErr = errors.New("write error")
+
+	_, err := Migrate(NewStorageManager(srcStore, nil), NewStorageManager(dstStore, nil), MigrateOptions{DeleteSource: true})
+	if err == nil {
+		t.Fatalf("expected write error")
+	}
+	if _, ok := srcStore.data["a"]; !ok {
+		t.Fatalf("source must not be deleted on failure")
+	}
+}
+
+func TestMigrate_IncludeSkipsOtherKeys(t *testing.T) {
+	srcStore, dstStore := newMockStorage(), newMockStorage()
+	src := NewStorageManager(srcStore, nil)
+	dst := NewStorageManager(dstStore, nil)
+
+	srcStore.data["todos.json"] = []byte("tasks")
+	srcStore.data["todo.log"] = []byte("not data")
+
+	result, err := Migrate(src, dst, MigrateOptions{
+		Include: func(key string) bool { return key == "todos.json" },
+	})
+	if err != nil {
+		t.Fatalf("migrate failed: %v", err)
+	}
+	if len(result.Copied) != 1 || len(result.Skipped) != 1 || result.Skipped[0] != "todo.log" {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+	if _, ok := dstStore.data["todo.log"]; ok {
+		t.Fatalf("skipped key should not be copied")
+	}
+}
+
+func TestCopyRecords(t *testing.T) {
+	srcEnc, _ := NewAESEncryptor(bytes.Repeat([]byte{1}, 32))
+	dstEnc, _ := NewAESEncryptor(bytes.Repeat([]byte{2}, 32))
+	srcRecords, dstRecords := newMockRecordStorage(), newMockRecordStorage()
+	src := NewRecordManager(srcRecords, srcEnc)
+	dst := NewRecordManager(dstRecords, dstEnc)
+
+	due := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	_ = src.PutTask(TaskRecord{ID: 1, Title: "one", DueAt: due})
+	_ = src.PutTask(TaskRecord{ID: 2, Title: "two", Done: true})
+
+	tasks, err := CopyRecords(src, dst)
+	if err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	if len(tasks) != 2 || len(dstRecords.tasks) != 2 {
+		t.Fatalf("unexpected copy: %+v", tasks)
+	}
+
+	copied, err := dst.ListTasks()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if copied[0].Title != "one" || !copied[0].DueAt.Equal(due) || !copied[1].Done {
+		t.Fatalf("unexpected destination records: %+v", copied)
+	}
+	if _, err := NewRecordManager(dstRecords, srcEnc).ListTasks(); err == nil {
+		t.Fatalf("destination titles should be encrypted with the destination key")
+	}
+}
+
+func TestCopyRecords_WriteError(t *testing.T) {
+	srcRecords, dstRecords := newMockRecordStorage(), newMockRecordStorage()
+	srcRecords.tasks[1] = TaskRecord{ID: 1, Title: "one"}
+	dstRecords.putErr = errors.New("put error")
+
+	if _, err := CopyRecords(NewRecordManager(srcRecords, nil), NewRecordManager(dstRecords, nil)); err == nil {
+		t.Fatalf("expected write error")
+	}
+}
@@ -3,14 +3,45 @@ package storage
 import (
 	"context"
 	"errors"
+	"regexp"
+	"strings"
+	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+func init() {
+	RegisterBackend(Backend{
+		Name:        "mongodb",
+		Aliases:     []string{"mongo"},
+		Description: "MongoDB collection",
+		Records:     true,
+		Settings: []Setting{
+			{Name: "MONGO_URI", Description: "connection string", Default: "mongodb://localhost:27017", Kind: SettingURL},
+			{Name: "MONGO_DB", Description: "database", Default: "todo"},
+			{Name: "MONGO_COLLECTION", Description: "collection", Default: "tasks"},
+		},
+		New: func(cfg BackendConfig) (Storage, error) {
+			s := cfg.Settings
+			return NewMongoStorage(s.Get("MONGO_URI"), s.Get("MONGO_DB"), s.Get("MONGO_COLLECTION"))
+		},
+		Locate: func(cfg BackendConfig) string {
+			// The URI path only names the authentication database
+			s := cfg.Settings
+			hosts, _, _ := strings.Cut(urlLocation(s.Get("MONGO_URI")), "/")
+			return hosts + "/" + s.Get("MONGO_DB") + "." + s.Get("MONGO_COLLECTION")
+		},
+	})
+}
+
+// mongoDisconnectTimeout bounds how long Close waits for the client to shut down
+const mongoDisconnectTimeout = 5 * time.Second
+
 // MongoStorage implements MongoDB storage
 type MongoStorage struct {
+	client     *mongo.Client
 	collection *mongo.Collection
 }
 
@@ -26,12 +57,42 @@ func NewMongoStorage(uri, database, collection string) (*MongoStorage, error) {
 	}
 
 	coll := client.Database(database).Collection(collection)
-	return &MongoStorage{collection: coll}, nil
+	return &MongoStorage{client: client, collection: coll}, nil
+}
+
+// Close disconnects the client created by NewMongoStorage
+func (ms *MongoStorage) Close() error {
+	if ms.client == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), mongoDisconnectTimeout)
+	defer cancel()
+	return ms.client.Disconnect(ctx)
 }
 
 func (ms *MongoStorage) Load(key string) ([]byte, error) {
+	return ms.LoadContext(context.Background(), key)
+}
+
+func (ms *MongoStorage) Save(key string, data []byte) error {
+	return ms.SaveContext(context.Background(), key, data)
+}
+
+func (ms *MongoStorage) Delete(key string) error {
+	return ms.DeleteContext(context.Background(), key)
+}
+
+func (ms *MongoStorage) Exists(key string) (bool, error) {
+	return ms.ExistsContext(context.Background(), key)
+}
+
+func (ms *MongoStorage) List(prefix string) ([]string, error) {
+	return ms.ListContext(context.Background(), prefix)
+}
+
+func (ms *MongoStorage) LoadContext(ctx context.Context, key string) ([]byte, error) {
 	var doc mongoDocument
-	err := ms.collection.FindOne(context.TODO(), bson.M{"_id": key}).Decode(&doc)
+	err := ms.collection.FindOne(ctx, bson.M{"_id": key}).Decode(&doc)
 	if err != nil {
 		if err == mongo.ErrNoDocuments {
 			return nil, errors.New("key not found")
@@ -41,25 +102,73 @@ func (ms *MongoStorage) Load(key string) ([]byte, error) {
 	return doc.Data, nil
 }
 
-func (ms *MongoStorage) Save(key string, data []byte) error {
+func (ms *MongoStorage) SaveContext(ctx context.Context, key string, data []byte) error {
 	doc := mongoDocument{
 		Key:  key,
 		Data: data,
 	}
 	opts := options.Replace().SetUpsert(true)
-	_, err := ms.collection.ReplaceOne(context.TODO(), bson.M{"_id": key}, doc, opts)
+	_, err := ms.collection.ReplaceOne(ctx, bson.M{"_id": key}, doc, opts)
 	return err
 }
 
-func (ms *MongoStorage) Delete(key string) error {
-	_, err := ms.collection.DeleteOne(context.TODO(), bson.M{"_id": key})
+// Swap implements Swapper with a filter on the stored data, or an insert
+// that fails on the duplicate _id when old is nil
+func (ms *MongoStorage) Swap(ctx context.Context, key string, old, data []byte) error {
+	if old == nil {
+		_, err := ms.collection.InsertOne(ctx, mongoDocument{Key: key, Data: data})
+		if mongo.IsDuplicateKeyError(err) {
+			return ErrModified
+		}
+		return err
+	}
+
+	result, err := ms.collection.UpdateOne(ctx,
+		bson.M{"_id": key, "data": old},
+		bson.M{"$set": bson.M{"data": data}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrModified
+	}
+	return nil
+}
+
+func (ms *MongoStorage) DeleteContext(ctx context.Context, key string) error {
+	_, err := ms.collection.DeleteOne(ctx, bson.M{"_id": key})
 	return err
 }
 
-func (ms *MongoStorage) Exists(key string) (bool, error) {
-	count, err := ms.collection.CountDocuments(context.TODO(), bson.M{"_id": key})
+func (ms *MongoStorage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	count, err := ms.collection.CountDocuments(ctx, bson.M{"_id": key})
 	if err != nil {
 		return false, err
 	}
 	return count > 0, nil
 }
+
+func (ms *MongoStorage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	filter := bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}}
+	opts := options.Find().
+		SetProjection(bson.M{"_id": 1}).
+		SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := ms.collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var keys []string
+	for cursor.Next(ctx) {
+		var doc struct {
+			Key string `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		keys = append(keys, doc.Key)
+	}
+	return keys, cursor.Err()
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoRecordStorage implements per-task MongoDB storage, one document per task
+type MongoRecordStorage struct {
+	collection *mongo.Collection
+}
+
+type mongoTaskDocument struct {
+	ID       int64     `bson:"_id"`
+	Title    string    `bson:"title"`
+	Done     bool      `bson:"done"`
+	DueAt    time.Time `bson:"dueAt,omitempty"`
+	Notified bool      `bson:"notified"`
+}
+
+// Records returns a record-level store in a sibling collection of the same database
+func (ms *MongoStorage) Records(collection string) (RecordStorage, error) {
+	return NewMongoRecordStorage(ms.collection.Database().Collection(collection)), nil
+}
+
+func NewMongoRecordStorage(collection *mongo.Collection) *MongoRecordStorage {
+	return &MongoRecordStorage{collection: collection}
+}
+
+func (rs *MongoRecordStorage) ListTasks(ctx context.Context) ([]TaskRecord, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "_id", Value: 1}})
+	cursor, err := rs.collection.Find(ctx, bson.M{}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var tasks []TaskRecord
+	for cursor.Next(ctx) {
+		var doc mongoTaskDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, TaskRecord{
+			ID:       doc.ID,
+			Title:    doc.Title,
+			Done:     doc.Done,
+			DueAt:    doc.DueAt,
+			Notified: doc.Notified,
+		})
+	}
+
+	return tasks, cursor.Err()
+}
+
+func (rs *MongoRecordStorage) PutTask(ctx context.Context, task TaskRecord) error {
+	doc := mongoTaskDocument{
+		ID:       task.ID,
+		Title:    task.Title,
+		Done:     task.Done,
+		DueAt:    task.DueAt,
+		Notified: task.Notified,
+	}
+	opts := options.Replace().SetUpsert(true)
+	_, err := rs.collection.ReplaceOne(ctx, bson.M{"_id": task.ID}, doc, opts)
+	return err
+}
+
+func (rs *MongoRecordStorage) DeleteTask(ctx context.Context, id int64) error {
+	_, err := rs.collection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
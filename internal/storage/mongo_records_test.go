@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestMongoRecordStorage_ListTasks(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("success", func(mt *mtest.T) {
+		due := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(
+				0,
+				"db.coll",
+				mtest.FirstBatch,
+				bson.D{
+					{Key: "_id", Value: int64(1)},
+					{Key: "title", Value: "first"},
+					{Key: "done", Value: false},
+					{Key: "notified", Value: false},
+				},
+				bson.D{
+					{Key: "_id", Value: int64(2)},
+					{Key: "title", Value: "second"},
+					{Key: "done", Value: true},
+					{Key: "dueAt", Value: due},
+					{Key: "notified", Value: true},
+				},
+			),
+		)
+
+		rs := NewMongoRecordStorage(mt.Coll)
+		tasks, err := rs.ListTasks(context.Background())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(tasks) != 2 {
+			t.Fatalf("expected 2 tasks, got %d", len(tasks))
+		}
+		if tasks[1].Title != "second" || !tasks[1].Done || !tasks[1].DueAt.Equal(due) {
+			t.Fatalf("unexpected task: %+v", tasks[1])
+		}
+	})
+}
+
+func TestMongoRecordStorage_ListTasks_Error(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("find error", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(
+				mtest.CommandError{
+					Code:    1,
+					Message: "find failed",
+				},
+			),
+		)
+
+		rs := NewMongoRecordStorage(mt.Coll)
+		if _, err := rs.ListTasks(context.Background()); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
+
+func TestMongoRecordStorage_PutTask(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(mtest.CreateSuccessResponse())
+
+		rs := NewMongoRecordStorage(mt.Coll)
+		if err := rs.PutTask(context.Background(), TaskRecord{ID: 1, Title: "task"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+}
+
+func TestMongoRecordStorage_DeleteTask_Error(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("delete error", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCommandErrorResponse(
+				mtest.CommandError{
+					Code:    1,
+					Message: "delete failed",
+				},
+			),
+		)
+
+		rs := NewMongoRecordStorage(mt.Coll)
+		if err := rs.DeleteTask(context.Background(), 1); err == nil {
+			t.Fatalf("expected error")
+		}
+	})
+}
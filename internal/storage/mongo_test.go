@@ -218,3 +218,35 @@ func TestMongoStorage_Load_MapsErrNoDocuments(t *testing.T) {
 		}
 	})
 }
+
+func TestMongoStorage_List(t *testing.T) {
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+
+	mt.Run("success", func(mt *mtest.T) {
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(
+				0,
+				"db.coll",
+				mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: "todos.json"}},
+				bson.D{{Key: "_id", Value: "todos.json.bak"}},
+			),
+		)
+
+		ms := newMongoStorage(mt)
+		keys, err := ms.List("todos")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(keys) != 2 || keys[1] != "todos.json.bak" {
+			t.Fatalf("unexpected keys: %v", keys)
+		}
+	})
+}
+
+func TestMongoStorage_Close_WithoutClient(t *testing.T) {
+	ms := &MongoStorage{}
+	if err := ms.Close(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
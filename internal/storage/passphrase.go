@@ -0,0 +1,294 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+)
+
+var (
+	// ErrWrongPassphrase is returned by PassphraseEncryptor.Decrypt when the
+	// data was encrypted with a different passphrase
+	ErrWrongPassphrase = errors.New("wrong passphrase")
+
+	// ErrCorrupted is returned when encrypted data fails authentication
+	// even though the key is right
+	ErrCorrupted = errors.New("encrypted data is corrupted")
+)
+
+// KDFParams are the Argon2id cost parameters
+type KDFParams struct {
+	Time    uint32 // passes over memory
+	Memory  uint32 // KiB
+	Threads uint8
+}
+
+// DefaultKDFParams follow the second recommendation of RFC 9106
+var DefaultKDFParams = KDFParams{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+// Upper bounds for parameters read from stored data, so a tampered header
+// cannot make Decrypt allocate unbounded memory
+const (
+	maxKDFTime    = 16
+	maxKDFMemory  = 2 * 1024 * 1024 // 2 GiB
+	maxKDFThreads = 64
+)
+
+// Passphrase ciphertext layout:
+//
+//	magic | version | time | memory | threads | salt | check | compression | nonce | sealed
+//
+// The header up to compression, followed by the caller's associated data,
+// is authenticated as GCM additional data. Version 1 had no associated
+// data and versions 1 and 2 no compression byte.
+// check is derived from the passphrase, so a mismatch identifies a wrong
+// passphrase before decryption is attempted.
+var passphraseMagic = []byte("TDPK")
+
+const (
+	passphraseVersion = 3
+	saltSize          = 16
+	checkSize         = 16
+	passphraseHeader  = 4 + 1 + 4 + 4 + 1 + saltSize + checkSize
+)
+
+// PassphraseEncryptor implements AES-GCM encryption with a key derived
+// from a passphrase using Argon2id. The salt and cost parameters are
+// stored with every ciphertext, so the passphrase is all that is needed
+// to decrypt; no key file is kept.
+//
+// New data uses the salt of the first ciphertext decrypted, so a store
+// keeps a single salt and the key is derived once.
+type PassphraseEncryptor struct {
+	passphrase []byte
+
+	mu      sync.Mutex
+	current passphraseKey
+	adopted bool                     // current came from stored data
+	keys    map[string]passphraseKey // by header prefix up to the salt
+}
+
+type passphraseKey struct {
+	params KDFParams
+	salt   []byte
+	key    []byte // AES-256 key
+	check  []byte
+}
+
+func NewPassphraseEncryptor(passphrase string, params KDFParams) (*PassphraseEncryptor, error) {
+	if passphrase == "" {
+		return nil, errors.New("passphrase must not be empty")
+	}
+	if err := params.validate(); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	e := &PassphraseEncryptor{
+		passphrase: []byte(passphrase),
+		keys:       make(map[string]passphraseKey),
+	}
+	e.current = e.derive(params, salt)
+	return e, nil
+}
+
+func (e *PassphraseEncryptor) Encrypt(plaintext []byte) ([]byte, error) {
+	return e.EncryptWithAD(plaintext, nil)
+}
+
+func (e *PassphraseEncryptor) Decrypt(ciphertext []byte) ([]byte, error) {
+	return e.DecryptWithAD(ciphertext, nil)
+}
+
+func (e *PassphraseEncryptor) EncryptWithAD(plaintext, ad []byte) ([]byte, error) {
+	return e.EncryptCompressed(plaintext, ad, CompressNone)
+}
+
+func (e *PassphraseEncryptor) EncryptCompressed(plaintext, ad []byte, c Compression) ([]byte, error) {
+	plaintext, err := compress(c, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	k := e.current
+	e.mu.Unlock()
+
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := append(k.header(), byte(c))
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	out := append(header, nonce...)
+	return gcm.Seal(out, nonce, plaintext, envelopeAD(header, ad)), nil
+}
+
+func (e *PassphraseEncryptor) DecryptWithAD(ciphertext, ad []byte) ([]byte, error) {
+	if len(ciphertext) < passphraseHeader || !bytes.HasPrefix(ciphertext, passphraseMagic) {
+		return nil, fmt.Errorf("%w: not encrypted with a passphrase", ErrCorrupted)
+	}
+	version := ciphertext[4]
+	if version < 1 || version > passphraseVersion {
+		return nil, fmt.Errorf("%w: passphrase format version %d", ErrUnsupportedFormat, version)
+	}
+	size, c := passphraseHeader, CompressNone
+	if version >= 3 {
+		size++
+		if len(ciphertext) < size {
+			return nil, fmt.Errorf("%w: truncated header", ErrCorrupted)
+		}
+		if c = Compression(ciphertext[passphraseHeader]); !c.valid() {
+			return nil, fmt.Errorf("%w: compression %d", ErrUnsupportedFormat, c)
+		}
+	}
+
+	params := KDFParams{
+		Time:    binary.BigEndian.Uint32(ciphertext[5:9]),
+		Memory:  binary.BigEndian.Uint32(ciphertext[9:13]),
+		Threads: ciphertext[13],
+	}
+	if err := params.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	salt := ciphertext[14 : 14+saltSize]
+	check := ciphertext[14+saltSize : passphraseHeader]
+
+	k := e.key(params, salt)
+	if !hmac.Equal(check, k.check) {
+		return nil, ErrWrongPassphrase
+	}
+
+	gcm, err := newGCM(k.key)
+	if err != nil {
+		return nil, err
+	}
+	header, rest := ciphertext[:size], ciphertext[size:]
+	if len(rest) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", ErrCorrupted)
+	}
+	aad := header
+	if version > 1 {
+		aad = envelopeAD(header, ad)
+	}
+	plaintext, err := gcm.Open(nil, rest[:gcm.NonceSize()], rest[gcm.NonceSize():], aad)
+	if err != nil {
+		return nil, ErrCorrupted
+	}
+
+	e.mu.Lock()
+	if !e.adopted {
+		e.current = k
+		e.adopted = true
+	}
+	e.mu.Unlock()
+	return decompress(c, plaintext)
+}
+
+// Wipe zeroes the passphrase and the derived keys; the encryptor cannot be
+// used afterwards
+func (e *PassphraseEncryptor) Wipe() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	clear(e.passphrase)
+	clear(e.current.key)
+	for _, k := range e.keys {
+		clear(k.key)
+	}
+}
+
+// DeriveKeys derives from the key of every salt seen so far, the salt new
+// data is encrypted with first
+func (e *PassphraseEncryptor) DeriveKeys(label string) [][]byte {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	keys := [][]byte{hmacSHA256(e.current.key, label)}
+	for _, k := range e.keys {
+		if !bytes.Equal(k.key, e.current.key) {
+			keys = append(keys, hmacSHA256(k.key, label))
+		}
+	}
+	return keys
+}
+
+// key returns the derived key for params and salt, deriving it at most once
+func (e *PassphraseEncryptor) key(params KDFParams, salt []byte) passphraseKey {
+	id := string(passphraseKey{params: params, salt: salt}.header()[:14+saltSize])
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if k, ok := e.keys[id]; ok {
+		return k
+	}
+	k := e.derive(params, salt)
+	e.keys[id] = k
+	return k
+}
+
+func (e *PassphraseEncryptor) derive(params KDFParams, salt []byte) passphraseKey {
+	master := argon2.IDKey(e.passphrase, salt, params.Time, params.Memory, params.Threads, 32)
+	return passphraseKey{
+		params: params,
+		salt:   append([]byte(nil), salt...),
+		key:    hmacSHA256(master, "todo encryption key"),
+		check:  hmacSHA256(master, "todo passphrase check")[:checkSize],
+	}
+}
+
+func (k passphraseKey) header() []byte {
+	header := make([]byte, 0, passphraseHeader+1)
+	header = append(header, passphraseMagic...)
+	header = append(header, passphraseVersion)
+	header = binary.BigEndian.AppendUint32(header, k.params.Time)
+	header = binary.BigEndian.AppendUint32(header, k.params.Memory)
+	header = append(header, k.params.Threads)
+	header = append(header, k.salt...)
+	return append(header, k.check...)
+}
+
+func (p KDFParams) validate() error {
+	if p.Time < 1 || p.Time > maxKDFTime {
+		return fmt.Errorf("argon2 time must be between 1 and %d, got %d", maxKDFTime, p.Time)
+	}
+	if p.Memory < 8*uint32(p.Threads) || p.Memory > maxKDFMemory {
+		return fmt.Errorf("argon2 memory must be between %d and %d KiB, got %d", 8*uint32(p.Threads), maxKDFMemory, p.Memory)
+	}
+	if p.Threads < 1 || p.Threads > maxKDFThreads {
+		return fmt.Errorf("argon2 threads must be between 1 and %d, got %d", maxKDFThreads, p.Threads)
+	}
+	return nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func hmacSHA256(key []byte, label string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(label))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// testKDFParams keep the tests fast; never use them for real data
+var testKDFParams = KDFParams{Time: 1, Memory: 64, Threads: 1}
+
+func newTestPassphraseEncryptor(t *testing.T, passphrase string) *PassphraseEncryptor {
+	t.Helper()
+	e, err := NewPassphraseEncryptor(passphrase, testKDFParams)
+	if err != nil {
+		t.Fatalf("failed to create encryptor: %v", err)
+	}
+	return e
+}
+
+func TestPassphraseEncryptor_RoundTrip(t *testing.T) {
+	e := newTestPassphraseEncryptor(t, "correct horse")
+
+	ciphertext, err := e.Encrypt([]byte("secret tasks"))
+	if err != nil {
+		t.Fatalf("Encrypt failed: %v", err)
+	}
+	if bytes.Contains(ciphertext, []byte("secret tasks")) {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+
+	// A fresh encryptor needs nothing but the passphrase
+	plaintext, err := newTestPassphraseEncryptor(t, "correct horse").Decrypt(ciphertext)
+	if err != nil || string(plaintext) != "secret tasks" {
+		t.Fatalf("Decrypt = %q, %v", plaintext, err)
+	}
+}
+
+func TestPassphraseEncryptor_WrongPassphrase(t *testing.T) {
+	ciphertext, _ := newTestPassphraseEncryptor(t, "correct horse").Encrypt([]byte("data"))
+
+	_, err := newTestPassphraseEncryptor(t, "battery staple").Decrypt(ciphertext)
+	if !errors.Is(err, ErrWrongPassphrase) {
+		t.Fatalf("expected ErrWrongPassphrase, got %v", err)
+	}
+}
+
+func TestPassphraseEncryptor_Corrupted(t *testing.T) {
+	e := newTestPassphraseEncryptor(t, "correct horse")
+	ciphertext, _ := e.Encrypt([]byte("data"))
+
+	tests := map[string][]byte{
+		"flipped body bit": func() []byte {
+			c := bytes.Clone(ciphertext)
+			c[len(c)-1] ^= 1
+			return c
+		}(),
+		"truncated":           ciphertext[:passphraseHeader+4],
+		"not passphrase data": []byte("plain json"),
+		"absurd memory cost": func() []byte {
+			c := bytes.Clone(ciphertext)
+			c[9] = 0xff
+			return c
+		}(),
+	}
+	for name, c := range tests {
+		if _, err := e.Decrypt(c); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: expected ErrCorrupted, got %v", name, err)
+		}
+	}
+}
+
+func TestPassphraseEncryptor_AssociatedData(t *testing.T) {
+	e := newTestPassphraseEncryptor(t, "correct horse")
+	ciphertext, _ := e.EncryptWithAD([]byte("data"), []byte("todos.json"))
+
+	if _, err := e.DecryptWithAD(ciphertext, []byte("notes.json")); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("expected ErrCorrupted for other associated data, got %v", err)
+	}
+	if data, err := e.DecryptWithAD(ciphertext, []byte("todos.json")); err != nil || string(data) != "data" {
+		t.Fatalf("DecryptWithAD = %q, %v", data, err)
+	}
+}
+
+func TestPassphraseEncryptor_AdoptsStoredSalt(t *testing.T) {
+	first := newTestPassphraseEncryptor(t, "correct horse")
+	stored, _ := first.Encrypt([]byte("data"))
+
+	second := newTestPassphraseEncryptor(t, "correct horse")
+	if _, err := second.Decrypt(stored); err != nil {
+		t.Fatalf("Decrypt failed: %v", err)
+	}
+	written, _ := second.Encrypt([]byte("more"))
+
+	if !bytes.Equal(written[:passphraseHeader], stored[:passphraseHeader]) {
+		t.Error("expected new data to reuse the stored salt")
+	}
+}
+
+func TestPassphraseEncryptor_DeriveKeys(t *testing.T) {
+	first := newTestPassphraseEncryptor(t, "correct horse")
+	stored, _ := first.Encrypt([]byte("data"))
+
+	// After adopting the stored salt, both encryptors derive the same key
+	second := newTestPassphraseEncryptor(t, "correct horse")
+	second.Decrypt(stored)
+	if !bytes.Equal(first.DeriveKeys("audit")[0], second.DeriveKeys("audit")[0]) {
+		t.Error("expected the key derived from the shared salt first")
+	}
+}
+
+func TestNewPassphraseEncryptor_Invalid(t *testing.T) {
+	if _, err := NewPassphraseEncryptor("", testKDFParams); err == nil {
+		t.Error("expected error for an empty passphrase")
+	}
+	if _, err := NewPassphraseEncryptor("x", KDFParams{Time: 0, Memory: 64, Threads: 1}); err == nil {
+		t.Error("expected error for zero time")
+	}
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"filippo.io/age"
+)
+
+// RecipientsKey holds the data key of a RecipientEncryptor, wrapped for
+// every recipient. It is not encrypted by StorageManager and Migrate
+// skips it.
+const RecipientsKey = ".recipients"
+
+// ErrNotRecipient is returned when the data key is not wrapped for the
+// identity opening it
+var ErrNotRecipient = errors.New("not a recipient of this data")
+
+// recipientSet is the stored form of RecipientsKey. Keys is age-encrypted
+// to every recipient and holds the current data key followed by previous
+// ones still needed to read data during a rotation.
+type recipientSet struct {
+	Version    int      `json:"version"`
+	Recipients []string `json:"recipients"`
+	Keys       []byte   `json:"keys"`
+}
+
+const recipientSetVersion = 1
+
+// RecipientEncryptor encrypts with a random data key that is stored in the
+// backend, wrapped for the age X25519 public key of each member of a
+// shared list. Members unwrap it with their own identity, so no raw key is
+// passed around. The recipient list is not authenticated; only members
+// should be able to write to the backend.
+type RecipientEncryptor struct {
+	*AESEncryptor
+	keys       [][]byte // current data key first
+	recipients []string
+}
+
+// OpenRecipientEncryptor unwraps the data key stored in st with identity.
+// When st has no recipient set yet, a new data key is created and stored
+// with identity as the only recipient.
+func OpenRecipientEncryptor(ctx context.Context, st Storage, identity *age.X25519Identity) (*RecipientEncryptor, error) {
+	exists, err := existsContext(ctx, st, RecipientsKey)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			return nil, err
+		}
+		e, err := newRecipientEncryptor([][]byte{key}, []string{identity.Recipient().String()})
+		if err != nil {
+			return nil, err
+		}
+		return e, e.Store(ctx, st)
+	}
+
+	raw, err := loadContext(ctx, st, RecipientsKey)
+	if err != nil {
+		return nil, err
+	}
+	var set recipientSet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("invalid recipient set: %w", err)
+	}
+	if set.Version > recipientSetVersion {
+		return nil, fmt.Errorf("%w: recipient set version %d", ErrUnsupportedFormat, set.Version)
+	}
+
+	r, err := age.Decrypt(bytes.NewReader(set.Keys), identity)
+	if err != nil {
+		var noMatch *age.NoIdentityMatchError
+		if errors.As(err, &noMatch) {
+			return nil, fmt.Errorf("%w: ask a member to run 'todo recipients add %s'", ErrNotRecipient, identity.Recipient())
+		}
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	payload, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	if len(payload) == 0 || len(payload)%32 != 0 {
+		return nil, fmt.Errorf("%w: invalid data key length %d", ErrCorrupted, len(payload))
+	}
+
+	var keys [][]byte
+	for k := range slices.Chunk(payload, 32) {
+		keys = append(keys, k)
+	}
+	return newRecipientEncryptor(keys, set.Recipients)
+}
+
+func newRecipientEncryptor(keys [][]byte, recipients []string) (*RecipientEncryptor, error) {
+	// Copies share no key slices, so wiping one leaves the others usable
+	cloned := make([][]byte, len(keys))
+	for i, k := range keys {
+		cloned[i] = bytes.Clone(k)
+	}
+	keys = cloned
+
+	aes, err := NewAESEncryptor(keys[0], keys[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	return &RecipientEncryptor{AESEncryptor: aes, keys: keys, recipients: recipients}, nil
+}
+
+// Wipe zeroes the data keys; the encryptor cannot be used afterwards
+func (e *RecipientEncryptor) Wipe() {
+	e.AESEncryptor.Wipe()
+	for _, k := range e.keys {
+		clear(k)
+	}
+}
+
+// Recipients returns the age public keys the data key is wrapped for
+func (e *RecipientEncryptor) Recipients() []string {
+	return slices.Clone(e.recipients)
+}
+
+// WithRecipients returns a copy wrapped for recipients instead. It is not
+// stored until Store is called.
+func (e *RecipientEncryptor) WithRecipients(recipients []string) (*RecipientEncryptor, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("at least one recipient is required")
+	}
+	for _, r := range recipients {
+		if _, err := age.ParseX25519Recipient(r); err != nil {
+			return nil, fmt.Errorf("invalid recipient %q: %w", r, err)
+		}
+	}
+	return newRecipientEncryptor(e.keys, slices.Clone(recipients))
+}
+
+// Rotate returns a copy with a new data key. The old keys are kept for
+// decryption until Settle is called, so Store the result before
+// re-encrypting any data.
+func (e *RecipientEncryptor) Rotate() (*RecipientEncryptor, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return newRecipientEncryptor(append([][]byte{key}, e.keys...), e.recipients)
+}
+
+// Settle returns a copy that only keeps the current data key, once all
+// data is re-encrypted with it
+func (e *RecipientEncryptor) Settle() (*RecipientEncryptor, error) {
+	return newRecipientEncryptor(e.keys[:1], e.recipients)
+}
+
+// Store wraps the data keys for the recipients and saves them to st
+func (e *RecipientEncryptor) Store(ctx context.Context, st Storage) error {
+	recipients := make([]age.Recipient, 0, len(e.recipients))
+	for _, r := range e.recipients {
+		parsed, err := age.ParseX25519Recipient(r)
+		if err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", r, err)
+		}
+		recipients = append(recipients, parsed)
+	}
+
+	var wrapped bytes.Buffer
+	w, err := age.Encrypt(&wrapped, recipients...)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(bytes.Join(e.keys, nil)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	raw, err := json.MarshalIndent(recipientSet{
+		Version:    recipientSetVersion,
+		Recipients: e.recipients,
+		Keys:       wrapped.Bytes(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return saveContext(ctx, st, RecipientsKey, raw)
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func newTestIdentity(t *testing.T) *age.X25519Identity {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate identity: %v", err)
+	}
+	return identity
+}
+
+func TestRecipientEncryptor_SharedDataKey(t *testing.T) {
+	ctx := context.Background()
+	st := newMockStorage()
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	aliceEnc, err := OpenRecipientEncryptor(ctx, st, alice)
+	if err != nil {
+		t.Fatalf("OpenRecipientEncryptor failed: %v", err)
+	}
+	if err := NewStorageManager(st, aliceEnc).Save("todos.json", []byte("shared")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if _, err := OpenRecipientEncryptor(ctx, st, bob); !errors.Is(err, ErrNotRecipient) {
+		t.Fatalf("expected ErrNotRecipient, got %v", err)
+	}
+
+	added, err := aliceEnc.WithRecipients(append(aliceEnc.Recipients(), bob.Recipient().String()))
+	if err != nil {
+		t.Fatalf("WithRecipients failed: %v", err)
+	}
+	if err := added.Store(ctx, st); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	bobEnc, err := OpenRecipientEncryptor(ctx, st, bob)
+	if err != nil {
+		t.Fatalf("OpenRecipientEncryptor for bob failed: %v", err)
+	}
+	data, err := NewStorageManager(st, bobEnc).Load("todos.json")
+	if err != nil || string(data) != "shared" {
+		t.Fatalf("bob Load = %q, %v", data, err)
+	}
+}
+
+func TestRecipientEncryptor_RemoveAndRotate(t *testing.T) {
+	ctx := context.Background()
+	st := newMockStorage()
+	alice, bob := newTestIdentity(t), newTestIdentity(t)
+
+	enc, _ := OpenRecipientEncryptor(ctx, st, alice)
+	enc, _ = enc.WithRecipients(append(enc.Recipients(), bob.Recipient().String()))
+	enc.Store(ctx, st)
+	NewStorageManager(st, enc).Save("todos.json", []byte("tasks"))
+
+	removed, err := enc.WithRecipients([]string{alice.Recipient().String()})
+	if err != nil {
+		t.Fatalf("WithRecipients failed: %v", err)
+	}
+	rotated, err := removed.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if err := rotated.Store(ctx, st); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	// Until settled, data under the old key stays readable
+	reopened, err := OpenRecipientEncryptor(ctx, st, alice)
+	if err != nil {
+		t.Fatalf("OpenRecipientEncryptor failed: %v", err)
+	}
+	settled, _ := reopened.Settle()
+	if _, err := Migrate(NewStorageManager(st, reopened), NewStorageManager(st, settled), MigrateOptions{}); err != nil {
+		t.Fatalf("re-encryption failed: %v", err)
+	}
+	if err := settled.Store(ctx, st); err != nil {
+		t.Fatalf("Store failed: %v", err)
+	}
+
+	if _, err := OpenRecipientEncryptor(ctx, st, bob); !errors.Is(err, ErrNotRecipient) {
+		t.Fatalf("expected ErrNotRecipient for a removed member, got %v", err)
+	}
+	if _, err := NewStorageManager(st, enc).Load("todos.json"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected the old data key to be useless, got %v", err)
+	}
+}
+
+func TestRecipientEncryptor_WithRecipients_Invalid(t *testing.T) {
+	enc, _ := OpenRecipientEncryptor(context.Background(), newMockStorage(), newTestIdentity(t))
+
+	if _, err := enc.WithRecipients(nil); err == nil {
+		t.Error("expected error for no recipients")
+	}
+	if _, err := enc.WithRecipients([]string{"not-a-key"}); err == nil {
+		t.Error("expected error for an invalid recipient")
+	}
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// TaskRecord is a single task as stored by a RecordStorage backend
+type TaskRecord struct {
+	ID       int64
+	Title    string
+	Done     bool
+	DueAt    time.Time
+	Notified bool
+}
+
+// RecordStorage stores tasks one record at a time instead of as a single blob
+type RecordStorage interface {
+	ListTasks(ctx context.Context) ([]TaskRecord, error)
+	PutTask(ctx context.Context, task TaskRecord) error
+	DeleteTask(ctx context.Context, id int64) error
+}
+
+// RecordProvider is implemented by backends that can expose a
+// record-level store next to their key/value blobs
+type RecordProvider interface {
+	Records(name string) (RecordStorage, error)
+}
+
+// RecordManager wraps a RecordStorage and encrypts sensitive fields.
+// Only the title is encrypted so done/due fields stay queryable server-side.
+type RecordManager struct {
+	operationScope
+	records       RecordStorage
+	encryptor     Encryptor
+	encryptTitles bool
+}
+
+func NewRecordManager(records RecordStorage, encryptor Encryptor) *RecordManager {
+	return &RecordManager{
+		operationScope: newOperationScope(),
+		records:        records,
+		encryptor:      encryptor,
+		encryptTitles:  true,
+	}
+}
+
+// SetTitleEncryption controls whether titles are encrypted on write, e.g.
+// to search them server-side. Either way, encrypted titles are decrypted
+// and plain ones are read as they are, so switching never locks out rows
+// written in the other mode.
+func (rm *RecordManager) SetTitleEncryption(enabled bool) {
+	rm.encryptTitles = enabled
+}
+
+func (rm *RecordManager) ListTasks() ([]TaskRecord, error) {
+	ctx, cancel := rm.operationContext()
+	defer cancel()
+
+	tasks, err := rm.records.ListTasks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if rm.encryptor == nil {
+		return tasks, nil
+	}
+
+	for i := range tasks {
+		title, err := rm.decryptTitle(tasks[i].ID, tasks[i].Title)
+		if err != nil {
+			return nil, err
+		}
+		tasks[i].Title = title
+	}
+	return tasks, nil
+}
+
+func (rm *RecordManager) PutTask(task TaskRecord) error {
+	if rm.encryptor != nil && rm.encryptTitles {
+		title, err := rm.encryptTitle(task.ID, task.Title)
+		if err != nil {
+			return err
+		}
+		task.Title = title
+	}
+
+	ctx, cancel := rm.operationContext()
+	defer cancel()
+	return rm.records.PutTask(ctx, task)
+}
+
+func (rm *RecordManager) DeleteTask(id int64) error {
+	ctx, cancel := rm.operationContext()
+	defer cancel()
+	return rm.records.DeleteTask(ctx, id)
+}
+
+// recordAD is the associated data for the title of task id, so a title
+// copied to another row fails to decrypt. The NUL keeps it apart from the
+// storage keys StorageManager binds blobs to.
+func recordAD(id int64) []byte {
+	return []byte("\x00task " + strconv.FormatInt(id, 10))
+}
+
+func (rm *RecordManager) encryptTitle(id int64, title string) (string, error) {
+	var ciphertext []byte
+	var err error
+	if aead, ok := rm.encryptor.(AEADEncryptor); ok {
+		ciphertext, err = aead.EncryptWithAD([]byte(title), recordAD(id))
+	} else {
+		ciphertext, err = rm.encryptor.Encrypt([]byte(title))
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(ciphertext), nil
+}
+
+// decryptTitle decrypts a stored title. Titles that are not recognizably
+// encrypted and do not decrypt, i.e. written with title encryption off,
+// are returned as they are.
+func (rm *RecordManager) decryptTitle(id int64, value string) (string, error) {
+	ciphertext, err := base64.StdEncoding.DecodeString(value)
+	if err != nil {
+		return value, nil
+	}
+
+	aead, ok := rm.encryptor.(AEADEncryptor)
+	var plaintext []byte
+	if ok {
+		plaintext, err = aead.DecryptWithAD(ciphertext, recordAD(id))
+		if err != nil {
+			// Written before titles were bound to their record
+			if legacy, legacyErr := aead.DecryptWithAD(ciphertext, nil); legacyErr == nil {
+				plaintext, err = legacy, nil
+			}
+		}
+	} else {
+		plaintext, err = rm.encryptor.Decrypt(ciphertext)
+	}
+	if err != nil {
+		if !IsEncrypted(ciphertext) {
+			return value, nil
+		}
+		return "", err
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sort"
+	"testing"
+)
+
+type mockRecordStorage struct {
+	tasks  map[int64]TaskRecord
+	putErr error
+}
+
+func newMockRecordStorage() *mockRecordStorage {
+	return &mockRecordStorage{
+		tasks: make(map[int64]TaskRecord),
+	}
+}
+
+func (m *mockRecordStorage) ListTasks(ctx context.Context) ([]TaskRecord, error) {
+	var tasks []TaskRecord
+	for _, t := range m.tasks {
+		tasks = append(tasks, t)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].ID < tasks[j].ID })
+	return tasks, nil
+}
+
+func (m *mockRecordStorage) PutTask(ctx context.Context, task TaskRecord) error {
+	if m.putErr != nil {
+		return m.putErr
+	}
+	m.tasks[task.ID] = task
+	return nil
+}
+
+func (m *mockRecordStorage) DeleteTask(ctx context.Context, id int64) error {
+	delete(m.tasks, id)
+	return nil
+}
+
+func TestRecordManager_NoEncryption(t *testing.T) {
+	rs := newMockRecordStorage()
+	rm := NewRecordManager(rs, nil)
+
+	if err := rm.PutTask(TaskRecord{ID: 1, Title: "plain", Done: true}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	if rs.tasks[1].Title != "plain" {
+		t.Fatalf("expected plaintext title at rest, got %q", rs.tasks[1].Title)
+	}
+
+	tasks, err := rm.ListTasks()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "plain" || !tasks[0].Done {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+}
+
+func TestRecordManager_EncryptsTitleOnly(t *testing.T) {
+	rs := newMockRecordStorage()
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	rm := NewRecordManager(rs, enc)
+
+	if err := rm.PutTask(TaskRecord{ID: 1, Title: "secret", Done: true}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	stored := rs.tasks[1]
+	if stored.Title == "secret" {
+		t.Fatalf("title should be encrypted at rest")
+	}
+	if !stored.Done {
+		t.Fatalf("done flag should be stored in plaintext")
+	}
+
+	tasks, err := rm.ListTasks()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(tasks) != 1 || tasks[0].Title != "secret" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+}
+
+func TestRecordManager_PlainTitles(t *testing.T) {
+	rs := newMockRecordStorage()
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	rm := NewRecordManager(rs, enc)
+
+	if err := rm.PutTask(TaskRecord{ID: 1, Title: "encrypted"}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	rm.SetTitleEncryption(false)
+	if err := rm.PutTask(TaskRecord{ID: 2, Title: "plain"}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	if rs.tasks[2].Title != "plain" {
+		t.Fatalf("expected plaintext title at rest, got %q", rs.tasks[2].Title)
+	}
+
+	// Titles written before the switch still read back
+	tasks, err := rm.ListTasks()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Title != "encrypted" || tasks[1].Title != "plain" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+}
+
+func TestRecordManager_ListTasks_DecryptError(t *testing.T) {
+	rs := newMockRecordStorage()
+	other, _ := NewAESEncryptor(bytes.Repeat([]byte{1}, 32))
+	if err := NewRecordManager(rs, other).PutTask(TaskRecord{ID: 1, Title: "secret"}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	rm := NewRecordManager(rs, enc)
+	if _, err := rm.ListTasks(); err == nil {
+		t.Fatalf("expected decrypt error")
+	}
+}
+
+func TestRecordManager_ListTasks_PlainTitlesWhileEncrypting(t *testing.T) {
+	rs := newMockRecordStorage()
+	rs.tasks[1] = TaskRecord{ID: 1, Title: "not-base64!"}
+	rs.tasks[2] = TaskRecord{ID: 2, Title: "abcd"} // valid base64
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	rm := NewRecordManager(rs, enc)
+
+	tasks, err := rm.ListTasks()
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Title != "not-base64!" || tasks[1].Title != "abcd" {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+}
+
+func TestRecordManager_ListTasks_SwappedTitle(t *testing.T) {
+	rs := newMockRecordStorage()
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	rm := NewRecordManager(rs, enc)
+
+	if err := rm.PutTask(TaskRecord{ID: 1, Title: "one"}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	if err := rm.PutTask(TaskRecord{ID: 2, Title: "two"}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	first := rs.tasks[1]
+	first.Title = rs.tasks[2].Title
+	rs.tasks[1] = first
+
+	if _, err := rm.ListTasks(); err == nil {
+		t.Fatalf("expected title copied from another row to fail")
+	}
+}
+
+func TestRecordManager_PutTask_Error(t *testing.T) {
+	rs := newMockRecordStorage()
+	rs.putErr = errors.New("put error")
+	rm := NewRecordManager(rs, nil)
+
+	if err := rm.PutTask(TaskRecord{ID: 1}); err == nil {
+		t.Fatalf("expected put error")
+	}
+}
+
+func TestRecordManager_DeleteTask(t *testing.T) {
+	rs := newMockRecordStorage()
+	rs.tasks[1] = TaskRecord{ID: 1}
+	rm := NewRecordManager(rs, nil)
+
+	if err := rm.DeleteTask(1); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if _, ok := rs.tasks[1]; ok {
+		t.Fatalf("expected task to be deleted")
+	}
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// redacted replaces secrets in logged values
+const redacted = "***"
+
+// secretParams are substrings of query and key=value parameter names that
+// hold credentials, compared in lower case without '_' and '-'
+var secretParams = []string{
+	"pass", "pwd", "secret", "token", "key", "credential", "signature",
+	"authmechanismproperties", // MongoDB AWS_SESSION_TOKEN
+}
+
+// keyValueParam matches a key=value pair of a connection string such as
+// "host=db user=todo password='p w'"
+var keyValueParam = regexp.MustCompile(`([A-Za-z_][A-Za-z0-9_-]*)\s*=\s*('(?:[^'\\]|\\.)*'|[^\s]*)`)
+
+// RedactURL returns value with the password and credential parameters of
+// a URL or key=value connection string replaced, for logging. Values that
+// cannot be parsed have everything before the host replaced.
+func RedactURL(value string) string {
+	if !strings.Contains(value, "://") {
+		if strings.Contains(value, "=") {
+			return redactKeyValues(value)
+		}
+		return value
+	}
+
+	u, err := url.Parse(value)
+	if err != nil {
+		return redactUnparsed(value)
+	}
+	if u.User != nil {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		} else if u.Scheme == "http" || u.Scheme == "https" {
+			// A lone user name in an HTTP URL is usually an access token
+			u.User = url.User(redacted)
+		}
+	}
+	u.RawQuery = redactQuery(u.RawQuery)
+	return unescapeRedacted(u.String())
+}
+
+// redactUnparsed handles URLs url.Parse rejects, e.g. with an unescaped '@'
+// or ':' in the password: everything up to the last '@' is replaced
+func redactUnparsed(value string) string {
+	scheme, rest, _ := strings.Cut(value, "://")
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		rest = redacted + rest[at:]
+	}
+	if path, query, ok := strings.Cut(rest, "?"); ok {
+		rest = path + "?" + redactQuery(query)
+	}
+	return scheme + "://" + rest
+}
+
+func redactQuery(query string) string {
+	if query == "" {
+		return query
+	}
+	params := strings.Split(query, "&")
+	for i, param := range params {
+		name, _, ok := strings.Cut(param, "=")
+		if ok && isSecretParam(name) {
+			params[i] = name + "=" + redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func redactKeyValues(value string) string {
+	return keyValueParam.ReplaceAllStringFunc(value, func(pair string) string {
+		name := keyValueParam.FindStringSubmatch(pair)[1]
+		if !isSecretParam(name) {
+			return pair
+		}
+		return name + "=" + redacted
+	})
+}
+
+func isSecretParam(name string) bool {
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		name = unescaped
+	}
+	name = strings.NewReplacer("_", "", "-", "").Replace(strings.ToLower(name))
+	for _, s := range secretParams {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// unescapeRedacted undoes url.URL's escaping of the placeholder in userinfo
+func unescapeRedacted(value string) string {
+	return strings.ReplaceAll(value, url.QueryEscape(redacted), redacted)
+}
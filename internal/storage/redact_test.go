@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactURL(t *testing.T) {
+	tests := map[string]string{
+		"postgres://todo:s3cret@db:5432/todo?sslmode=disable":                       "postgres://todo:***@db:5432/todo?sslmode=disable",
+		"postgres://todo:p%3Ass%40word@db/todo":                                     "postgres://todo:***@db/todo",
+		"postgres://todo:p:ss@word@db/todo":                                         "postgres://todo:***@db/todo",
+		"postgres://todo:p@ss word@db/todo":                                         "postgres://***@db/todo",
+		"postgres://db/todo?user=todo&password=s3cret&sslpassword=k":                "postgres://db/todo?user=todo&password=***&sslpassword=***",
+		"host=db user=todo password='s3 cret' sslmode=require":                      "host=db user=todo password=*** sslmode=require",
+		"mongodb://todo:s3cret@a:27017,b:27017/?replicaSet=rs0":                     "mongodb://todo:***@a:27017,b:27017/?replicaSet=rs0",
+		"mongodb+srv://h.example.com/?authMechanismProperties=AWS_SESSION_TOKEN:tk": "mongodb+srv://h.example.com/?authMechanismProperties=***",
+		"https://ghp_token@github.com/alice/todo.git":                               "https://***@github.com/alice/todo.git",
+		"https://s3.example.com/?X-Amz-Credential=AKIA&X-Amz-Signature=abc":         "https://s3.example.com/?X-Amz-Credential=***&X-Amz-Signature=***",
+		"redis://localhost:6379/0":                                                  "redis://localhost:6379/0",
+		"git@github.com:alice/todo.git":                                             "git@github.com:alice/todo.git",
+	}
+	for value, want := range tests {
+		if got := RedactURL(value); got != want {
+			t.Errorf("RedactURL(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestSetting_Validate_RedactsValue(t *testing.T) {
+	setting := Setting{Name: "POSTGRES_DSN", Kind: SettingURL}
+	err := setting.Validate("postgres://todo:s3cret@db\x7f/todo")
+	if err == nil {
+		t.Fatal("expected an invalid URL error")
+	}
+	if strings.Contains(err.Error(), "s3cret") {
+		t.Errorf("error leaks the password: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func init() {
+	RegisterBackend(Backend{
+		Name:        "redis",
+		Description: "Redis or another RESP server (Valkey, KeyDB), with live refresh",
+		Settings: []Setting{
+			{Name: "REDIS_URL", Description: "server URL", Default: "redis://localhost:6379/0", Kind: SettingURL},
+			{Name: "REDIS_PREFIX", Description: "per-user key prefix, e.g. todo:alice:", Default: "todo:"},
+			{Name: "REDIS_BACKUP_TTL", Description: "expire backups after this long; kept when unset", Kind: SettingDuration},
+		},
+		New: func(cfg BackendConfig) (Storage, error) {
+			return NewRedisStorage(RedisOptions{
+				URL:       cfg.Settings.Get("REDIS_URL"),
+				Prefix:    cfg.Settings.Get("REDIS_PREFIX"),
+				TTLPrefix: cfg.BackupPrefix,
+				TTL:       cfg.Settings.Duration("REDIS_BACKUP_TTL"),
+			})
+		},
+		Locate: func(cfg BackendConfig) string {
+			location := urlLocation(cfg.Settings.Get("REDIS_URL"))
+			if !strings.Contains(location, "/") {
+				location += "/0" // the default database
+			}
+			return location + "#" + cfg.Settings.Get("REDIS_PREFIX")
+		},
+	})
+}
+
+const redisConnectTimeout = 5 * time.Second
+
+// Change describes a key written by another client
+type Change struct {
+	Key     string
+	Deleted bool
+}
+
+// Watcher is implemented by backends that notify about changes made by
+// other clients, so the app can refresh without polling. The channel is
+// closed when ctx is cancelled.
+type Watcher interface {
+	Watch(ctx context.Context) (<-chan Change, error)
+}
+
+// RedisOptions configures a RedisStorage
+type RedisOptions struct {
+	URL    string // redis://[user:password@]host:port/db, rediss:// for TLS
+	Prefix string // prepended to every key, e.g. "todo:alice:"
+
+	// Keys starting with TTLPrefix (after Prefix) expire after TTL, e.g. to
+	// let old backups age out on their own. A zero TTL disables expiry.
+	TTLPrefix string
+	TTL       time.Duration
+}
+
+// RedisStorage implements storage on Redis or any server speaking RESP
+// (Valkey, KeyDB, Dragonfly, ...). Every change is published on the
+// <Prefix>changes channel; see Watch.
+type RedisStorage struct {
+	client    *redis.Client
+	prefix    string
+	ttlPrefix string
+	ttl       time.Duration
+	channel   string
+	clientID  string // tags our own notifications so Watch can skip them
+}
+
+// redisChange is the pub/sub message format
+type redisChange struct {
+	Key     string `json:"key"`
+	Deleted bool   `json:"deleted,omitempty"`
+	Source  string `json:"source"`
+}
+
+func NewRedisStorage(opts RedisOptions) (*RedisStorage, error) {
+	redisOpts, err := redis.ParseURL(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	client := redis.NewClient(redisOpts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisConnectTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	return &RedisStorage{
+		client:    client,
+		prefix:    opts.Prefix,
+		ttlPrefix: opts.TTLPrefix,
+		ttl:       opts.TTL,
+		channel:   opts.Prefix + "changes",
+		clientID:  hex.EncodeToString(id),
+	}, nil
+}
+
+func (rs *RedisStorage) Load(key string) ([]byte, error) {
+	return rs.LoadContext(context.Background(), key)
+}
+
+func (rs *RedisStorage) Save(key string, data []byte) error {
+	return rs.SaveContext(context.Background(), key, data)
+}
+
+func (rs *RedisStorage) Delete(key string) error {
+	return rs.DeleteContext(context.Background(), key)
+}
+
+func (rs *RedisStorage) Exists(key string) (bool, error) {
+	return rs.ExistsContext(context.Background(), key)
+}
+
+func (rs *RedisStorage) List(prefix string) ([]string, error) {
+	return rs.ListContext(context.Background(), prefix)
+}
+
+// Close closes the connection pool
+func (rs *RedisStorage) Close() error {
+	return rs.client.Close()
+}
+
+func (rs *RedisStorage) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	data, err := rs.client.Get(ctx, rs.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("key %q not found", key)
+	}
+	return data, err
+}
+
+func (rs *RedisStorage) SaveContext(ctx context.Context, key string, data []byte) error {
+	if err := rs.client.Set(ctx, rs.prefix+key, data, rs.keyTTL(key)).Err(); err != nil {
+		return err
+	}
+	return rs.publish(ctx, key, false)
+}
+
+// Swap implements Swapper with WATCH: the SET is discarded when another
+// client changes the key between the comparison and the write
+func (rs *RedisStorage) Swap(ctx context.Context, key string, old, data []byte) error {
+	err := rs.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(ctx, rs.prefix+key).Bytes()
+		switch {
+		case errors.Is(err, redis.Nil):
+			if old != nil {
+				return ErrModified
+			}
+		case err != nil:
+			return err
+		case old == nil || !bytes.Equal(current, old):
+			return ErrModified
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, rs.prefix+key, data, rs.keyTTL(key))
+			return nil
+		})
+		return err
+	}, rs.prefix+key)
+	if errors.Is(err, redis.TxFailedErr) {
+		return ErrModified
+	}
+	if err != nil {
+		return err
+	}
+	return rs.publish(ctx, key, false)
+}
+
+// keyTTL returns the expiry of key: TTL for keys under TTLPrefix, else none
+func (rs *RedisStorage) keyTTL(key string) time.Duration {
+	if rs.ttl > 0 && rs.ttlPrefix != "" && strings.HasPrefix(key, rs.ttlPrefix) {
+		return rs.ttl
+	}
+	return 0
+}
+
+func (rs *RedisStorage) DeleteContext(ctx context.Context, key string) error {
+	n, err := rs.client.Del(ctx, rs.prefix+key).Result()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("key %q not found", key)
+	}
+	return rs.publish(ctx, key, true)
+}
+
+func (rs *RedisStorage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	n, err := rs.client.Exists(ctx, rs.prefix+key).Result()
+	return n > 0, err
+}
+
+func (rs *RedisStorage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	iter := rs.client.Scan(ctx, 0, escapeGlob(rs.prefix+prefix)+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, strings.TrimPrefix(iter.Val(), rs.prefix))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Watch subscribes to changes published by other clients sharing the prefix
+func (rs *RedisStorage) Watch(ctx context.Context) (<-chan Change, error) {
+	sub := rs.client.Subscribe(ctx, rs.channel)
+	// Wait for the subscription so no change is missed after Watch returns
+	if _, err := sub.Receive(ctx); err != nil {
+		sub.Close()
+		return nil, err
+	}
+
+	changes := make(chan Change)
+	go func() {
+		defer close(changes)
+		defer sub.Close()
+
+		messages := sub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-messages:
+				if !ok {
+					return
+				}
+				var c redisChange
+				if err := json.Unmarshal([]byte(msg.Payload), &c); err != nil || c.Source == rs.clientID {
+					continue
+				}
+				select {
+				case changes <- Change{Key: c.Key, Deleted: c.Deleted}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return changes, nil
+}
+
+func (rs *RedisStorage) publish(ctx context.Context, key string, deleted bool) error {
+	msg, err := json.Marshal(redisChange{Key: key, Deleted: deleted, Source: rs.clientID})
+	if err != nil {
+		return err
+	}
+	return rs.client.Publish(ctx, rs.channel, msg).Err()
+}
+
+// escapeGlob escapes the SCAN MATCH pattern characters in s
+var escapeGlob = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`).Replace
@@ -0,0 +1,164 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestRedisStorage(t *testing.T, mr *miniredis.Miniredis, opts RedisOptions) *RedisStorage {
+	t.Helper()
+	opts.URL = "redis://" + mr.Addr()
+	rs, err := NewRedisStorage(opts)
+	if err != nil {
+		t.Fatalf("failed to create redis storage: %v", err)
+	}
+	t.Cleanup(func() {
+		rs.Close()
+	})
+	return rs
+}
+
+func TestNewRedisStorage_Errors(t *testing.T) {
+	if _, err := NewRedisStorage(RedisOptions{URL: "http://localhost"}); err == nil {
+		t.Error("expected error for a non-redis URL")
+	}
+
+	mr := miniredis.RunT(t)
+	addr := mr.Addr()
+	mr.Close()
+	if _, err := NewRedisStorage(RedisOptions{URL: "redis://" + addr}); err == nil {
+		t.Error("expected error for an unreachable server")
+	}
+}
+
+func TestRedisStorage_SaveLoadPrefix(t *testing.T) {
+	mr := miniredis.RunT(t)
+	alice := newTestRedisStorage(t, mr, RedisOptions{Prefix: "todo:alice:"})
+	bob := newTestRedisStorage(t, mr, RedisOptions{Prefix: "todo:bob:"})
+
+	if err := alice.Save("todos.json", []byte("alice")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if err := bob.Save("todos.json", []byte("bob")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	if data, err := alice.Load("todos.json"); err != nil || string(data) != "alice" {
+		t.Errorf("Load = %q, %v", data, err)
+	}
+	if got, _ := mr.Get("todo:bob:todos.json"); got != "bob" {
+		t.Errorf("expected the key to be stored under the prefix, got %q", got)
+	}
+	if _, err := alice.Load("missing.json"); err == nil {
+		t.Error("expected error for a missing key")
+	}
+}
+
+func TestRedisStorage_ExistsDeleteList(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rs := newTestRedisStorage(t, mr, RedisOptions{Prefix: "todo[1]:"})
+	// Same server, other prefix; must not show up in List
+	mr.Set("todo1:backup.x", "other")
+
+	for _, key := range []string{"backup.b", "backup.a", "todos.json"} {
+		rs.Save(key, []byte(key))
+	}
+
+	keys, err := rs.List("backup.")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if want := []string{"backup.a", "backup.b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+
+	if exists, err := rs.Exists("todos.json"); err != nil || !exists {
+		t.Fatalf("Exists = %v, %v", exists, err)
+	}
+	if err := rs.Delete("todos.json"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, _ := rs.Exists("todos.json"); exists {
+		t.Error("expected key to be deleted")
+	}
+	if err := rs.Delete("todos.json"); err == nil {
+		t.Error("expected error deleting a missing key")
+	}
+}
+
+func TestRedisStorage_BackupTTL(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rs := newTestRedisStorage(t, mr, RedisOptions{Prefix: "todo:", TTLPrefix: "backup.", TTL: time.Hour})
+
+	rs.Save("todos.json", []byte("data"))
+	rs.Save("backup.todos.json.1", []byte("old"))
+
+	if ttl := mr.TTL("todo:todos.json"); ttl != 0 {
+		t.Errorf("expected no TTL on the data key, got %s", ttl)
+	}
+	if ttl := mr.TTL("todo:backup.todos.json.1"); ttl != time.Hour {
+		t.Errorf("expected a 1h TTL on the backup, got %s", ttl)
+	}
+
+	mr.FastForward(2 * time.Hour)
+	if exists, _ := rs.Exists("backup.todos.json.1"); exists {
+		t.Error("expected the backup to expire")
+	}
+	if exists, _ := rs.Exists("todos.json"); !exists {
+		t.Error("expected the data key to be kept")
+	}
+}
+
+func TestRedisStorage_Watch(t *testing.T) {
+	mr := miniredis.RunT(t)
+	first := newTestRedisStorage(t, mr, RedisOptions{Prefix: "todo:"})
+	second := newTestRedisStorage(t, mr, RedisOptions{Prefix: "todo:"})
+
+	changes, err := first.Watch(t.Context())
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+
+	// Our own writes are not reported
+	first.Save("todos.json", []byte("mine"))
+	second.Save("todos.json", []byte("theirs"))
+	second.Delete("todos.json")
+
+	for _, want := range []Change{{Key: "todos.json"}, {Key: "todos.json", Deleted: true}} {
+		select {
+		case got := <-changes:
+			if got != want {
+				t.Errorf("expected %+v, got %+v", want, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %+v", want)
+		}
+	}
+}
+
+func TestRedisStorage_Swap(t *testing.T) {
+	mr := miniredis.RunT(t)
+	rs := newTestRedisStorage(t, mr, RedisOptions{Prefix: "todo:"})
+	ctx := context.Background()
+
+	if err := rs.Swap(ctx, "audit.json", nil, []byte("v1")); err != nil {
+		t.Fatalf("Swap of a new key failed: %v", err)
+	}
+	if err := rs.Swap(ctx, "audit.json", nil, []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for an existing key, got %v", err)
+	}
+	if err := rs.Swap(ctx, "audit.json", []byte("stale"), []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for a changed value, got %v", err)
+	}
+	if err := rs.Swap(ctx, "audit.json", []byte("v1"), []byte("v2")); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if got, _ := mr.Get("todo:audit.json"); got != "v2" {
+		t.Errorf("expected v2, got %q", got)
+	}
+}
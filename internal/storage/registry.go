@@ -0,0 +1,282 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SettingKind determines how a setting is validated and logged
+type SettingKind int
+
+const (
+	SettingString SettingKind = iota
+	SettingBool
+	SettingInt      // not negative
+	SettingDuration // time.ParseDuration format, not negative
+	SettingURL      // logged with credentials redacted (see RedactURL)
+)
+
+// Setting declares one configuration value of a backend
+type Setting struct {
+	Name        string // environment variable, e.g. "S3_BUCKET"
+	Description string
+	Default     string
+	Kind        SettingKind
+	Choices     []string // allowed values, when limited
+	Required    bool
+	Secret      bool // never logged
+}
+
+// Validate checks value against the setting's kind
+func (s Setting) Validate(value string) error {
+	if len(s.Choices) > 0 && !slices.Contains(s.Choices, value) {
+		return fmt.Errorf("invalid %s=%s: expected one of %s", s.Name, value, strings.Join(s.Choices, ", "))
+	}
+
+	var err error
+	switch s.Kind {
+	case SettingBool:
+		_, err = strconv.ParseBool(value)
+	case SettingInt:
+		var n int
+		if n, err = strconv.Atoi(value); err == nil && n < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+	case SettingDuration:
+		var d time.Duration
+		if d, err = time.ParseDuration(value); err == nil && d < 0 {
+			err = fmt.Errorf("must not be negative")
+		}
+	case SettingURL:
+		// url.Error repeats the value, which may hold a password
+		var urlErr *url.Error
+		if _, err = url.Parse(value); errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s=%s: %w", s.Name, s.Display(value), err)
+	}
+	return nil
+}
+
+// Display formats value for logs and messages without its secrets
+func (s Setting) Display(value string) string {
+	switch {
+	case s.Secret:
+		return redacted
+	case s.Kind == SettingURL:
+		return RedactURL(value)
+	default:
+		return value
+	}
+}
+
+// Settings maps setting names to values. Backends receive them validated
+// and with defaults applied.
+type Settings map[string]string
+
+func (s Settings) Get(name string) string {
+	return s[name]
+}
+
+func (s Settings) Bool(name string) bool {
+	b, _ := strconv.ParseBool(s[name])
+	return b
+}
+
+func (s Settings) Int(name string) int {
+	n, _ := strconv.Atoi(s[name])
+	return n
+}
+
+func (s Settings) Duration(name string) time.Duration {
+	d, _ := time.ParseDuration(s[name])
+	return d
+}
+
+// BackendConfig is passed to a backend's constructor
+type BackendConfig struct {
+	DataPath     string        // local data directory, for backends that keep files
+	BackupPrefix string        // key prefix of backup snapshots
+	Timeout      time.Duration // per-operation timeout, 0 for none
+	Settings     Settings
+}
+
+// Backend describes a storage backend that can be selected by name with
+// STORAGE_TYPE.
+//
+// Backends register themselves from an init function. A backend outside
+// this package does the same and is linked in with a blank import, e.g.
+// from a file in cmd/todo guarded by a build tag.
+type Backend struct {
+	Name        string
+	Aliases     []string
+	Description string
+	Local       bool // data stays on this machine, so the offline cache is not used
+	Records     bool // supports the records schema (see RecordProvider)
+	Settings    []Setting
+	New         func(cfg BackendConfig) (Storage, error)
+
+	// Locate identifies the store a resolved config points at, without
+	// credentials (see Backend.Location). Optional.
+	Locate func(cfg BackendConfig) string
+
+	// Files lists the local files a resolved config keeps data in, other
+	// than keys stored as files under DataPath (see Backend.LocalFiles).
+	// Optional.
+	Files func(cfg BackendConfig) []string
+}
+
+var (
+	registryMu sync.RWMutex
+	backends   = make(map[string]Backend) // by name and alias
+)
+
+// RegisterBackend makes a backend available by its name and aliases. It
+// panics if a name is already taken or New is nil.
+func RegisterBackend(b Backend) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if b.New == nil {
+		panic("storage: RegisterBackend " + b.Name + " without a constructor")
+	}
+	for _, name := range append([]string{b.Name}, b.Aliases...) {
+		if _, dup := backends[name]; dup {
+			panic("storage: RegisterBackend called twice for " + name)
+		}
+	}
+	for _, name := range append([]string{b.Name}, b.Aliases...) {
+		backends[name] = b
+	}
+}
+
+// LookupBackend finds a registered backend by name or alias
+func LookupBackend(name string) (Backend, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	b, ok := backends[name]
+	return b, ok
+}
+
+// Backends returns the registered backends sorted by name
+func Backends() []Backend {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var list []Backend
+	for name, b := range backends {
+		if name == b.Name {
+			list = append(list, b)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// BackendNames lists the names of registered backends matching filter
+// (all when nil), for error messages
+func BackendNames(filter func(Backend) bool) string {
+	var names []string
+	for _, b := range Backends() {
+		if filter == nil || filter(b) {
+			names = append(names, b.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+// BackendSettings returns the settings of all registered backends, sorted
+// by name
+func BackendSettings() []Setting {
+	seen := make(map[string]bool)
+	var settings []Setting
+	for _, b := range Backends() {
+		for _, s := range b.Settings {
+			if !seen[s.Name] {
+				seen[s.Name] = true
+				settings = append(settings, s)
+			}
+		}
+	}
+	sort.Slice(settings, func(i, j int) bool { return settings[i].Name < settings[j].Name })
+	return settings
+}
+
+// Open validates the backend's settings, applies defaults and creates it
+func (b Backend) Open(cfg BackendConfig) (Storage, error) {
+	cfg, err := b.resolve(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := b.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize %s storage: %w", b.Name, err)
+	}
+	return storage, nil
+}
+
+// Location identifies the store cfg points at, e.g. the bucket and prefix,
+// without credentials. Two configs with the same location share their data.
+func (b Backend) Location(cfg BackendConfig) (string, error) {
+	cfg, err := b.resolve(cfg)
+	if err != nil {
+		return "", err
+	}
+	if b.Locate != nil {
+		return b.Name + ":" + b.Locate(cfg), nil
+	}
+
+	// Without a Locate function every non-secret setting counts
+	parts := []string{cfg.DataPath}
+	for _, s := range b.Settings {
+		if !s.Secret {
+			parts = append(parts, s.Name+"="+s.Display(cfg.Settings.Get(s.Name)))
+		}
+	}
+	return b.Name + ":" + strings.Join(parts, " "), nil
+}
+
+// resolve validates cfg's settings and applies their defaults
+// LocalFiles returns the local files the backend keeps data in for cfg,
+// e.g. a database file, to check their permissions
+func (b Backend) LocalFiles(cfg BackendConfig) ([]string, error) {
+	if b.Files == nil {
+		return nil, nil
+	}
+	cfg, err := b.resolve(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return b.Files(cfg), nil
+}
+
+func (b Backend) resolve(cfg BackendConfig) (BackendConfig, error) {
+	settings := make(Settings, len(b.Settings))
+	for _, s := range b.Settings {
+		value := cfg.Settings.Get(s.Name)
+		if value == "" {
+			if s.Required {
+				return cfg, fmt.Errorf("%s environment variable is required for %s storage", s.Name, b.Name)
+			}
+			value = s.Default
+		}
+		if value != "" {
+			if err := s.Validate(value); err != nil {
+				return cfg, err
+			}
+		}
+		settings[s.Name] = value
+	}
+	cfg.Settings = settings
+	return cfg, nil
+}
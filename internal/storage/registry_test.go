@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// registerTestBackend registers a backend that records the config it was
+// opened with
+func registerTestBackend(t *testing.T, name string, aliases ...string) *BackendConfig {
+	t.Helper()
+	var got BackendConfig
+	RegisterBackend(Backend{
+		Name:    name,
+		Aliases: aliases,
+		Settings: []Setting{
+			{Name: "TEST_URL", Kind: SettingURL, Required: true},
+			{Name: "TEST_TABLE", Default: "tasks"},
+			{Name: "TEST_FLAG", Kind: SettingBool},
+			{Name: "TEST_TTL", Kind: SettingDuration},
+		},
+		New: func(cfg BackendConfig) (Storage, error) {
+			got = cfg
+			return NewFileStorage(t.TempDir())
+		},
+	})
+	t.Cleanup(func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		for _, n := range append([]string{name}, aliases...) {
+			delete(backends, n)
+		}
+	})
+	return &got
+}
+
+func TestBuiltinBackendsRegistered(t *testing.T) {
+	for _, name := range []string{"file", "s3", "mongodb", "mongo", "postgres", "pg", "sqlite", "sqlite3", "git", "webdav", "redis"} {
+		if _, ok := LookupBackend(name); !ok {
+			t.Errorf("backend %q not registered", name)
+		}
+	}
+
+	if got := BackendNames(func(b Backend) bool { return b.Records }); got != "mongodb, postgres, sqlite" {
+		t.Errorf("unexpected records backends: %s", got)
+	}
+	if b, _ := LookupBackend("sqlite3"); b.Name != "sqlite" || !b.Local {
+		t.Errorf("expected sqlite3 to resolve to the local sqlite backend, got %+v", b)
+	}
+}
+
+func TestBackend_Open(t *testing.T) {
+	got := registerTestBackend(t, "test-open", "test-alias")
+
+	backend, ok := LookupBackend("test-alias")
+	if !ok {
+		t.Fatal("alias not registered")
+	}
+	s, err := backend.Open(BackendConfig{
+		DataPath: "/data",
+		Settings: Settings{"TEST_URL": "mem://x", "TEST_FLAG": "true", "TEST_TTL": "1h", "OTHER": "ignored"},
+	})
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s.Close()
+
+	if got.DataPath != "/data" {
+		t.Errorf("expected DataPath to be passed through, got %q", got.DataPath)
+	}
+	if got.Settings.Get("TEST_TABLE") != "tasks" {
+		t.Errorf("expected the default table, got %q", got.Settings.Get("TEST_TABLE"))
+	}
+	if !got.Settings.Bool("TEST_FLAG") || got.Settings.Duration("TEST_TTL") != time.Hour {
+		t.Errorf("unexpected settings %v", got.Settings)
+	}
+	if _, ok := got.Settings["OTHER"]; ok {
+		t.Error("expected settings of other backends to be dropped")
+	}
+}
+
+func TestBackend_OpenValidation(t *testing.T) {
+	registerTestBackend(t, "test-validate")
+	backend, _ := LookupBackend("test-validate")
+
+	tests := []struct {
+		settings Settings
+		want     string
+	}{
+		{Settings{}, "TEST_URL environment variable is required for test-validate storage"},
+		{Settings{"TEST_URL": "mem://x", "TEST_FLAG": "maybe"}, "invalid TEST_FLAG=maybe"},
+		{Settings{"TEST_URL": "mem://x", "TEST_TTL": "-1h"}, "invalid TEST_TTL=-1h"},
+		{Settings{"TEST_URL": "://bad"}, "invalid TEST_URL=://bad"},
+	}
+	for _, tt := range tests {
+		_, err := backend.Open(BackendConfig{Settings: tt.settings})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Open(%v) error = %v, want %q", tt.settings, err, tt.want)
+		}
+	}
+}
+
+func TestRegisterBackend_Duplicate(t *testing.T) {
+	registerTestBackend(t, "test-dup")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic registering an alias that is already a name")
+		}
+		if _, ok := LookupBackend("test-other"); ok {
+			t.Error("a rejected backend must not be partially registered")
+		}
+	}()
+	RegisterBackend(Backend{
+		Name:    "test-other",
+		Aliases: []string{"test-dup"},
+		New:     func(BackendConfig) (Storage, error) { return nil, nil },
+	})
+}
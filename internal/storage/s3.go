@@ -3,38 +3,159 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"io"
+	"net/http"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+func init() {
+	RegisterBackend(Backend{
+		Name:        "s3",
+		Description: "Amazon S3 or an S3-compatible service (MinIO, R2, Ceph)",
+		Settings: []Setting{
+			{Name: "S3_BUCKET", Description: "bucket name", Required: true},
+			{Name: "S3_REGION", Description: "bucket region", Default: "us-east-1"},
+			{Name: "S3_ENDPOINT", Description: "custom endpoint for MinIO, R2, Ceph, ...", Kind: SettingURL},
+			{Name: "S3_FORCE_PATH_STYLE", Description: "bucket in the path, required by most self-hosted services", Kind: SettingBool, Default: "false"},
+			{Name: "S3_PREFIX", Description: "object key prefix, e.g. alice/"},
+			{Name: "S3_PROFILE", Description: "shared credentials profile"},
+			{Name: "S3_ACCESS_KEY_ID", Description: "static credentials; the AWS credential chain when unset", Secret: true},
+			{Name: "S3_SECRET_ACCESS_KEY", Description: "static credentials secret", Secret: true},
+			{Name: "S3_SSE", Description: "server-side encryption: AES256, aws:kms"},
+			{Name: "S3_SSE_KMS_KEY_ID", Description: "KMS key for aws:kms"},
+		},
+		New: func(cfg BackendConfig) (Storage, error) {
+			s := cfg.Settings
+			return NewS3Storage(S3Options{
+				Bucket:          s.Get("S3_BUCKET"),
+				Region:          s.Get("S3_REGION"),
+				Endpoint:        s.Get("S3_ENDPOINT"),
+				UsePathStyle:    s.Bool("S3_FORCE_PATH_STYLE"),
+				Prefix:          s.Get("S3_PREFIX"),
+				Profile:         s.Get("S3_PROFILE"),
+				AccessKeyID:     s.Get("S3_ACCESS_KEY_ID"),
+				SecretAccessKey: s.Get("S3_SECRET_ACCESS_KEY"),
+				SSE:             s.Get("S3_SSE"),
+				SSEKMSKeyID:     s.Get("S3_SSE_KMS_KEY_ID"),
+			})
+		},
+		Locate: func(cfg BackendConfig) string {
+			s := cfg.Settings
+			endpoint := "aws"
+			if s.Get("S3_ENDPOINT") != "" {
+				endpoint = urlLocation(s.Get("S3_ENDPOINT"))
+			}
+			return endpoint + "/" + s.Get("S3_BUCKET") + "/" + s.Get("S3_PREFIX")
+		},
+	})
+}
+
+// S3Options configures S3 and S3-compatible (MinIO, R2, Ceph) storage
+type S3Options struct {
+	Bucket string
+	Region string
+
+	Endpoint     string // custom endpoint URL for S3-compatible services
+	UsePathStyle bool   // bucket in the path instead of the host name (MinIO, Ceph)
+	Prefix       string // prepended to every object key, e.g. "alice/"
+
+	Profile         string // shared config/credentials profile
+	AccessKeyID     string // static credentials, override the default chain
+	SecretAccessKey string
+
+	SSE         string // server-side encryption: "AES256" or "aws:kms"
+	SSEKMSKeyID string // KMS key for "aws:kms"
+}
+
 // S3Storage implements S3-compatible storage
 type S3Storage struct {
-	client *s3.Client
-	bucket string
+	client      *s3.Client
+	bucket      string
+	prefix      string
+	sse         types.ServerSideEncryption
+	sseKMSKeyID string
 }
 
-func NewS3Storage(bucket, region string) (*S3Storage, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(region),
-	)
+func NewS3Storage(opts S3Options) (*S3Storage, error) {
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithRegion(opts.Region),
+	}
+	if opts.Profile != "" {
+		loadOpts = append(loadOpts, config.WithSharedConfigProfile(opts.Profile))
+	}
+	if opts.AccessKeyID != "" {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(), loadOpts...)
 	if err != nil {
 		return nil, err
 	}
 
-	client := s3.NewFromConfig(cfg)
+	return newS3StorageFromConfig(cfg, opts), nil
+}
+
+func newS3StorageFromConfig(cfg aws.Config, opts S3Options) *S3Storage {
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.UsePathStyle
+	})
+
 	return &S3Storage{
-		client: client,
-		bucket: bucket,
-	}, nil
+		client:      client,
+		bucket:      opts.Bucket,
+		prefix:      opts.Prefix,
+		sse:         types.ServerSideEncryption(opts.SSE),
+		sseKMSKeyID: opts.SSEKMSKeyID,
+	}
+}
+
+// Close is a no-op; the S3 client holds no resources that need releasing
+func (s *S3Storage) Close() error {
+	return nil
+}
+
+// objectKey maps a storage key to its object key under the configured prefix
+func (s *S3Storage) objectKey(key string) string {
+	return s.prefix + key
 }
 
 func (s *S3Storage) Load(key string) ([]byte, error) {
-	result, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
+	return s.LoadContext(context.Background(), key)
+}
+
+func (s *S3Storage) Save(key string, data []byte) error {
+	return s.SaveContext(context.Background(), key, data)
+}
+
+func (s *S3Storage) Delete(key string) error {
+	return s.DeleteContext(context.Background(), key)
+}
+
+func (s *S3Storage) Exists(key string) (bool, error) {
+	return s.ExistsContext(context.Background(), key)
+}
+
+func (s *S3Storage) List(prefix string) ([]string, error) {
+	return s.ListContext(context.Background(), prefix)
+}
+
+func (s *S3Storage) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+		Key:    aws.String(s.objectKey(key)),
 	})
 	if err != nil {
 		return nil, err
@@ -44,30 +165,107 @@ func (s *S3Storage) Load(key string) ([]byte, error) {
 	return io.ReadAll(result.Body)
 }
 
-func (s *S3Storage) Save(key string, data []byte) error {
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
+func (s *S3Storage) SaveContext(ctx context.Context, key string, data []byte) error {
+	_, err := s.client.PutObject(ctx, s.putInput(key, data))
+	return err
+}
+
+// Swap implements Swapper with a conditional PUT: If-Match the ETag of the
+// object read for the comparison, or If-None-Match when old is nil. Services
+// without conditional writes ignore the headers and overwrite.
+func (s *S3Storage) Swap(ctx context.Context, key string, old, data []byte) error {
+	input := s.putInput(key, data)
+	if old == nil {
+		input.IfNoneMatch = aws.String("*")
+	} else {
+		result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(s.objectKey(key)),
+		})
+		if s3Status(err) == http.StatusNotFound {
+			return ErrModified
+		}
+		if err != nil {
+			return err
+		}
+		current, err := io.ReadAll(result.Body)
+		result.Body.Close()
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, old) {
+			return ErrModified
+		}
+		input.IfMatch = result.ETag
+	}
+
+	_, err := s.client.PutObject(ctx, input)
+	switch s3Status(err) {
+	case http.StatusPreconditionFailed, http.StatusConflict:
+		// 409 is returned when a concurrent conditional write won the race
+		return ErrModified
+	}
+	return err
+}
+
+func (s *S3Storage) putInput(key string, data []byte) *s3.PutObjectInput {
+	input := &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+		Key:    aws.String(s.objectKey(key)),
 		Body:   bytes.NewReader(data),
-	})
-	return err
+	}
+	if s.sse != "" {
+		input.ServerSideEncryption = s.sse
+	}
+	if s.sseKMSKeyID != "" {
+		input.SSEKMSKeyId = aws.String(s.sseKMSKeyID)
+	}
+	return input
 }
 
-func (s *S3Storage) Delete(key string) error {
-	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
+// s3Status returns the HTTP status of a failed S3 request, or 0
+func s3Status(err error) int {
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return respErr.HTTPStatusCode()
+	}
+	return 0
+}
+
+func (s *S3Storage) DeleteContext(ctx context.Context, key string) error {
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+		Key:    aws.String(s.objectKey(key)),
 	})
 	return err
 }
 
-func (s *S3Storage) Exists(key string) (bool, error) {
-	_, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
+func (s *S3Storage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
 		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
+		Key:    aws.String(s.objectKey(key)),
 	})
-	if err != nil {
+	if s3Status(err) == http.StatusNotFound {
 		return false, nil
 	}
-	return true, nil
+	// Anything else, e.g. 403 or a timeout, says nothing about the key
+	return err == nil, err
+}
+
+func (s *S3Storage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.objectKey(prefix)),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, obj := range page.Contents {
+			keys = append(keys, strings.TrimPrefix(aws.ToString(obj.Key), s.prefix))
+		}
+	}
+	return keys, nil
 }
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"io"
 	"net/http"
@@ -35,6 +36,20 @@ func newTestS3Storage(t *testing.T, handler func(*http.Request) (*http.Response,
 	}
 }
 
+func newTestS3StorageWithOptions(t *testing.T, opts S3Options, handler func(*http.Request) (*http.Response, error)) *S3Storage {
+	t.Helper()
+
+	cfg := aws.Config{
+		Region: "us-east-1",
+		HTTPClient: &http.Client{
+			Transport: roundTripper(handler),
+		},
+		Credentials: aws.AnonymousCredentials{},
+	}
+
+	return newS3StorageFromConfig(cfg, opts)
+}
+
 func TestS3Storage_Save(t *testing.T) {
 	s := newTestS3Storage(t, func(r *http.Request) (*http.Response, error) {
 		if r.Method != http.MethodPut {
@@ -144,7 +159,10 @@ func TestS3Storage_Exists_True(t *testing.T) {
 
 func TestS3Storage_Exists_False(t *testing.T) {
 	s := newTestS3Storage(t, func(r *http.Request) (*http.Response, error) {
-		return nil, errors.New("not found")
+		return &http.Response{
+			StatusCode: http.StatusNotFound,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
 	})
 
 	ok, err := s.Exists("k")
@@ -155,3 +173,185 @@ func TestS3Storage_Exists_False(t *testing.T) {
 		t.Fatalf("expected not exists")
 	}
 }
+
+func TestS3Storage_Exists_Error(t *testing.T) {
+	for name, handler := range map[string]func(*http.Request) (*http.Response, error){
+		"forbidden": func(r *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: http.StatusForbidden,
+				Body:       io.NopCloser(strings.NewReader("")),
+			}, nil
+		},
+		"network": func(r *http.Request) (*http.Response, error) {
+			return nil, errors.New("connection reset")
+		},
+	} {
+		s := newTestS3Storage(t, handler)
+		if ok, err := s.Exists("k"); err == nil || ok {
+			t.Errorf("%s: expected an error, got %v, %v", name, ok, err)
+		}
+	}
+}
+
+func TestS3Storage_List(t *testing.T) {
+	s := newTestS3Storage(t, func(r *http.Request) (*http.Response, error) {
+		if r.URL.Query().Get("prefix") != "todos" {
+			t.Fatalf("unexpected prefix: %s", r.URL.Query().Get("prefix"))
+		}
+		body := `<ListBucketResult>
+			<IsTruncated>false</IsTruncated>
+			<Contents><Key>todos.json</Key></Contents>
+			<Contents><Key>todos.json.bak</Key></Contents>
+		</ListBucketResult>`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	keys, err := s.List("todos")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "todos.json" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestS3Storage_CustomEndpointPathStyle(t *testing.T) {
+	opts := S3Options{
+		Bucket:       "todo",
+		Endpoint:     "http://minio.local:9000",
+		UsePathStyle: true,
+		Prefix:       "alice/",
+	}
+	s := newTestS3StorageWithOptions(t, opts, func(r *http.Request) (*http.Response, error) {
+		if r.URL.Host != "minio.local:9000" {
+			t.Fatalf("unexpected host: %s", r.URL.Host)
+		}
+		if r.URL.Path != "/todo/alice/todos.json" {
+			t.Fatalf("unexpected path: %s", r.URL.Path)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader("data")),
+		}, nil
+	})
+
+	data, err := s.Load("todos.json")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(data) != "data" {
+		t.Fatalf("unexpected data")
+	}
+}
+
+func TestS3Storage_Save_ServerSideEncryption(t *testing.T) {
+	opts := S3Options{
+		Bucket:      "todo",
+		Endpoint:    "http://minio.local:9000",
+		SSE:         "aws:kms",
+		SSEKMSKeyID: "key-id",
+	}
+	s := newTestS3StorageWithOptions(t, opts, func(r *http.Request) (*http.Response, error) {
+		if got := r.Header.Get("X-Amz-Server-Side-Encryption"); got != "aws:kms" {
+			t.Fatalf("unexpected SSE header: %q", got)
+		}
+		if got := r.Header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"); got != "key-id" {
+			t.Fatalf("unexpected KMS key header: %q", got)
+		}
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+
+	if err := s.Save("k", []byte("v")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestS3Storage_List_StripsPrefix(t *testing.T) {
+	opts := S3Options{
+		Bucket:       "todo",
+		Endpoint:     "http://minio.local:9000",
+		UsePathStyle: true,
+		Prefix:       "alice/",
+	}
+	s := newTestS3StorageWithOptions(t, opts, func(r *http.Request) (*http.Response, error) {
+		if r.URL.Query().Get("prefix") != "alice/todos" {
+			t.Fatalf("unexpected prefix: %s", r.URL.Query().Get("prefix"))
+		}
+		body := `<ListBucketResult>
+			<IsTruncated>false</IsTruncated>
+			<Contents><Key>alice/todos.json</Key></Contents>
+		</ListBucketResult>`
+		return &http.Response{
+			StatusCode: 200,
+			Body:       io.NopCloser(strings.NewReader(body)),
+		}, nil
+	})
+
+	keys, err := s.List("todos")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(keys) != 1 || keys[0] != "todos.json" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestS3Backend_CredentialsAreSecret(t *testing.T) {
+	backend, ok := LookupBackend("s3")
+	if !ok {
+		t.Fatal("s3 backend is not registered")
+	}
+	for _, s := range backend.Settings {
+		if s.Name == "S3_ACCESS_KEY_ID" || s.Name == "S3_SECRET_ACCESS_KEY" {
+			if !s.Secret || s.Display("AKIAEXAMPLE") != redacted {
+				t.Errorf("%s must be secret so it is never logged", s.Name)
+			}
+		}
+	}
+}
+
+func TestS3Storage_Swap(t *testing.T) {
+	stored := "v1"
+	s := newTestS3Storage(t, func(r *http.Request) (*http.Response, error) {
+		switch r.Method {
+		case http.MethodGet:
+			return &http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Etag": {`"e1"`}},
+				Body:       io.NopCloser(strings.NewReader(stored)),
+			}, nil
+		case http.MethodPut:
+			if r.Header.Get("If-None-Match") == "*" || r.Header.Get("If-Match") != `"e1"` {
+				return &http.Response{
+					StatusCode: http.StatusPreconditionFailed,
+					Body:       io.NopCloser(strings.NewReader("<Error><Code>PreconditionFailed</Code></Error>")),
+				}, nil
+			}
+			data, _ := io.ReadAll(r.Body)
+			stored = string(data)
+			return &http.Response{StatusCode: 200, Body: io.NopCloser(strings.NewReader(""))}, nil
+		}
+		t.Fatalf("unexpected method: %s", r.Method)
+		return nil, nil
+	})
+	ctx := context.Background()
+
+	if err := s.Swap(ctx, "k", nil, []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for an existing key, got %v", err)
+	}
+	if err := s.Swap(ctx, "k", []byte("stale"), []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for a changed value, got %v", err)
+	}
+	if err := s.Swap(ctx, "k", []byte("v1"), []byte("v2")); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if stored != "v2" {
+		t.Errorf("expected v2, got %q", stored)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+
+	_ "modernc.org/sqlite" // Pure-Go SQLite driver (no cgo)
+)
+
+func init() {
+	RegisterBackend(Backend{
+		Name:        "sqlite",
+		Aliases:     []string{"sqlite3"},
+		Description: "SQLite database file",
+		Local:       true,
+		Records:     true,
+		Settings: []Setting{
+			{Name: "SQLITE_PATH", Description: "database file; DATA_PATH/todo.db when unset"},
+			{Name: "SQLITE_TABLE", Description: "table, created if missing", Default: "tasks"},
+		},
+		New: func(cfg BackendConfig) (Storage, error) {
+			return NewSQLiteStorage(sqlitePath(cfg), cfg.Settings.Get("SQLITE_TABLE"))
+		},
+		Locate: func(cfg BackendConfig) string {
+			return pathLocation(sqlitePath(cfg)) + "#" + cfg.Settings.Get("SQLITE_TABLE")
+		},
+		Files: func(cfg BackendConfig) []string {
+			path := sqlitePath(cfg)
+			return []string{path, path + "-journal", path + "-wal", path + "-shm"}
+		},
+	})
+}
+
+func sqlitePath(cfg BackendConfig) string {
+	if path := cfg.Settings.Get("SQLITE_PATH"); path != "" {
+		return path
+	}
+	return filepath.Join(cfg.DataPath, "todo.db")
+}
+
+// SQLiteStorage implements embedded SQLite database storage
+type SQLiteStorage struct {
+	db        *sql.DB
+	tableName string
+}
+
+func NewSQLiteStorage(path, tableName string) (*SQLiteStorage, error) {
+	tableName, err := qualifiedTable("", tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+
+	// Create the database file private to the user; SQLite gives its journal
+	// the same mode
+	if file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600); err == nil {
+		file.Close()
+	} else if !errors.Is(err, os.ErrExist) {
+		return nil, err
+	}
+
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer; serialize access through one connection
+	db.SetMaxOpenConns(1)
+
+	storage := &SQLiteStorage{
+		db:        db,
+		tableName: tableName,
+	}
+
+	// Create table if not exists
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS ` + tableName + ` (
+			key TEXT PRIMARY KEY,
+			data BLOB NOT NULL
+		)
+	`)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
+
+func (ss *SQLiteStorage) Load(key string) ([]byte, error) {
+	return ss.LoadContext(context.Background(), key)
+}
+
+func (ss *SQLiteStorage) Save(key string, data []byte) error {
+	return ss.SaveContext(context.Background(), key, data)
+}
+
+func (ss *SQLiteStorage) Delete(key string) error {
+	return ss.DeleteContext(context.Background(), key)
+}
+
+func (ss *SQLiteStorage) Exists(key string) (bool, error) {
+	return ss.ExistsContext(context.Background(), key)
+}
+
+func (ss *SQLiteStorage) List(prefix string) ([]string, error) {
+	return ss.ListContext(context.Background(), prefix)
+}
+
+func (ss *SQLiteStorage) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	var data []byte
+	err := ss.db.QueryRowContext(ctx,
+		"SELECT data FROM "+ss.tableName+" WHERE key = ?",
+		key,
+	).Scan(&data)
+
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("key not found")
+		}
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func (ss *SQLiteStorage) SaveContext(ctx context.Context, key string, data []byte) error {
+	_, err := ss.db.ExecContext(ctx, `
+		INSERT INTO `+ss.tableName+` (key, data)
+		VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET data = excluded.data
+	`, key, data)
+	return err
+}
+
+// Swap implements Swapper by comparing the stored data in the UPDATE
+func (ss *SQLiteStorage) Swap(ctx context.Context, key string, old, data []byte) error {
+	var result sql.Result
+	var err error
+	if old == nil {
+		result, err = ss.db.ExecContext(ctx, `
+			INSERT INTO `+ss.tableName+` (key, data)
+			VALUES (?, ?)
+			ON CONFLICT (key) DO NOTHING
+		`, key, data)
+	} else {
+		result, err = ss.db.ExecContext(ctx,
+			"UPDATE "+ss.tableName+" SET data = ? WHERE key = ? AND data = ?",
+			data, key, old,
+		)
+	}
+	return swapResult(result, err)
+}
+
+func (ss *SQLiteStorage) DeleteContext(ctx context.Context, key string) error {
+	_, err := ss.db.ExecContext(ctx, "DELETE FROM "+ss.tableName+" WHERE key = ?", key)
+	return err
+}
+
+func (ss *SQLiteStorage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := ss.db.QueryRowContext(ctx,
+		"SELECT EXISTS(SELECT 1 FROM "+ss.tableName+" WHERE key = ?)",
+		key,
+	).Scan(&exists)
+	return exists, err
+}
+
+func (ss *SQLiteStorage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	rows, err := ss.db.QueryContext(ctx,
+		"SELECT key FROM "+ss.tableName+" WHERE key LIKE ? ESCAPE '\\' ORDER BY key",
+		escapeLike(prefix)+"%",
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// Records returns a record-level store in the same database file
+func (ss *SQLiteStorage) Records(tableName string) (RecordStorage, error) {
+	tableName, err := qualifiedTable("", tableName)
+	if err != nil {
+		return nil, err
+	}
+	return newDBRecordStorage(ss.db, tableName, "TIMESTAMP")
+}
+
+func (ss *SQLiteStorage) Close() error {
+	return ss.db.Close()
+}
@@ -0,0 +1,250 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSQLiteStorage(t *testing.T) *SQLiteStorage {
+	t.Helper()
+
+	ss, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "todo.db"), "test_table")
+	if err != nil {
+		t.Fatalf("failed to create sqlite storage: %v", err)
+	}
+	t.Cleanup(func() {
+		ss.Close()
+	})
+
+	return ss
+}
+
+func TestNewSQLiteStorage_CreatesDirectory(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "dir", "todo.db")
+
+	ss, err := NewSQLiteStorage(path, "tasks")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ss.Close()
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected database file to exist: %v", err)
+	}
+}
+
+func TestNewSQLiteStorage_InvalidTable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "todo.db")
+	_, err := NewSQLiteStorage(path, "todo; DROP TABLE x")
+	if err == nil || !strings.Contains(err.Error(), "invalid table name") {
+		t.Fatalf("expected invalid table name error, got %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no database to be created, got %v", err)
+	}
+}
+
+func TestSQLiteStorage_SaveLoad(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+
+	data := []byte("hello world")
+	if err := ss.Save("k1", data); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	out, err := ss.Load("k1")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	if !bytes.Equal(out, data) {
+		t.Fatalf("expected %q, got %q", data, out)
+	}
+}
+
+func TestSQLiteStorage_Save_Overwrite(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+
+	if err := ss.Save("k", []byte("v1")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+	if err := ss.Save("k", []byte("v2")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	out, err := ss.Load("k")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if string(out) != "v2" {
+		t.Fatalf("expected overwritten value, got %q", out)
+	}
+}
+
+func TestSQLiteStorage_Load_NotFound(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+
+	_, err := ss.Load("missing")
+	if err == nil {
+		t.Fatalf("expected not found error")
+	}
+	if err.Error() != "key not found" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestSQLiteStorage_Delete(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+
+	if err := ss.Save("k", []byte("v")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	if err := ss.Delete("k"); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+
+	if _, err := ss.Load("k"); err == nil {
+		t.Fatalf("expected error after delete")
+	}
+}
+
+func TestSQLiteStorage_Exists(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+
+	exists, err := ss.Exists("k")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if exists {
+		t.Fatalf("expected not exists")
+	}
+
+	if err := ss.Save("k", []byte("v")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	exists, err = ss.Exists("k")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !exists {
+		t.Fatalf("expected exists")
+	}
+}
+
+func TestSQLiteStorage_ClosedError(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ss.Close()
+
+	if err := ss.Save("k", []byte("v")); err == nil {
+		t.Fatalf("expected error on closed database")
+	}
+	if _, err := ss.Exists("k"); err == nil {
+		t.Fatalf("expected error on closed database")
+	}
+}
+
+func TestSQLiteStorage_WithEncryption(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	enc, _ := NewAESEncryptor(make([]byte, 32))
+	sm := NewStorageManager(ss, enc)
+
+	if err := sm.Save("k", []byte("secret")); err != nil {
+		t.Fatalf("save failed: %v", err)
+	}
+
+	raw, err := ss.Load("k")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if bytes.Equal(raw, []byte("secret")) {
+		t.Fatalf("data should be encrypted at rest")
+	}
+
+	out, err := sm.Load("k")
+	if err != nil {
+		t.Fatalf("load failed: %v", err)
+	}
+	if string(out) != "secret" {
+		t.Fatalf("unexpected data: %q", out)
+	}
+}
+
+func TestSQLiteStorage_List(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+
+	for _, key := range []string{"a_1", "a_2", "ab", "b"} {
+		if err := ss.Save(key, []byte("v")); err != nil {
+			t.Fatalf("save failed: %v", err)
+		}
+	}
+
+	keys, err := ss.List("a_")
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(keys) != 2 || keys[0] != "a_1" || keys[1] != "a_2" {
+		t.Fatalf("unexpected keys: %v", keys)
+	}
+}
+
+func TestSQLiteStorage_Records(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	rs, err := ss.Records("task_records")
+	if err != nil {
+		t.Fatalf("records failed: %v", err)
+	}
+
+	ctx := context.Background()
+	due := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, task := range []TaskRecord{{ID: 1, Title: "first"}, {ID: 2, Title: "second", Done: true, DueAt: due}} {
+		if err := rs.PutTask(ctx, task); err != nil {
+			t.Fatalf("put failed: %v", err)
+		}
+	}
+	if err := rs.PutTask(ctx, TaskRecord{ID: 1, Title: "renamed"}); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	if err := rs.DeleteTask(ctx, 2); err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := rs.PutTask(ctx, TaskRecord{ID: 3, Title: "third", DueAt: due}); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+
+	tasks, err := rs.ListTasks(ctx)
+	if err != nil {
+		t.Fatalf("list failed: %v", err)
+	}
+	if len(tasks) != 2 || tasks[0].Title != "renamed" || tasks[1].ID != 3 || !tasks[1].DueAt.Equal(due) {
+		t.Fatalf("unexpected tasks: %+v", tasks)
+	}
+}
+
+func TestSQLiteStorage_Swap(t *testing.T) {
+	ss := newTestSQLiteStorage(t)
+	ctx := context.Background()
+
+	if err := ss.Swap(ctx, "k", nil, []byte("v1")); err != nil {
+		t.Fatalf("Swap of a new key failed: %v", err)
+	}
+	if err := ss.Swap(ctx, "k", nil, []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for an existing key, got %v", err)
+	}
+	if err := ss.Swap(ctx, "k", []byte("stale"), []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for a changed value, got %v", err)
+	}
+	if err := ss.Swap(ctx, "k", []byte("v1"), []byte("v2")); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if data, _ := ss.Load("k"); string(data) != "v2" {
+		t.Errorf("expected v2, got %q", data)
+	}
+}
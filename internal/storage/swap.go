@@ -0,0 +1,84 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrModified is returned when a key changed since it was last read by this
+// client: by WebDAVStorage.Save when the server's ETag no longer matches,
+// and by Swapper.Swap when the stored value is not the expected one
+var ErrModified = errors.New("modified by another client")
+
+// maxUpdateAttempts bounds how often Update retries after a concurrent change
+const maxUpdateAttempts = 5
+
+// Swapper is implemented by backends that can replace a value only while it
+// still holds what the caller read, so two clients appending to the same
+// value on a shared backend do not lose each other's changes
+type Swapper interface {
+	// Swap stores data under key if the stored value equals old, or if key
+	// does not exist when old is nil, and returns ErrModified otherwise
+	Swap(ctx context.Context, key string, old, data []byte) error
+}
+
+// Update replaces the value of key with the result of update, which gets
+// the current plaintext or nil when key does not exist. On a Swapper
+// backend the write fails if another client changed key in between, and
+// update is called again with the new value. Other backends, including
+// CachedStorage, whose sync merges conflicts, write unconditionally.
+func (sm *StorageManager) Update(key string, update func(current []byte) ([]byte, error)) error {
+	swapper, ok := sm.storage.(Swapper)
+	for attempt := 1; ; attempt++ {
+		stored, current, err := sm.loadCurrent(key)
+		if err != nil {
+			return err
+		}
+		data, err := update(current)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return sm.Save(key, data)
+		}
+
+		sealed, err := sm.encrypt(key, data)
+		if err != nil {
+			return err
+		}
+		ctx, cancel := sm.operationContext()
+		err = swapper.Swap(ctx, key, stored, sealed)
+		cancel()
+		switch {
+		case err == nil:
+			if err := sm.maybeSnapshot(key, data); err != nil {
+				return fmt.Errorf("%w: %v", ErrBackupFailed, err)
+			}
+			return nil
+		case !errors.Is(err, ErrModified) || attempt == maxUpdateAttempts:
+			return err
+		}
+	}
+}
+
+// loadCurrent returns the stored value of key and its plaintext, or nil
+// for both when key does not exist
+func (sm *StorageManager) loadCurrent(key string) (stored, plaintext []byte, err error) {
+	ctx, cancel := sm.operationContext()
+	defer cancel()
+
+	exists, err := existsContext(ctx, sm.storage, key)
+	if err != nil || !exists {
+		return nil, nil, err
+	}
+	stored, err = loadContext(ctx, sm.storage, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	plaintext, err = sm.decrypt(key, stored)
+	if err != nil {
+		return nil, nil, err
+	}
+	return stored, plaintext, nil
+}
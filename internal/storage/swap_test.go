@@ -0,0 +1,78 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// racingStorage writes a competing value before the first n swaps, as
+// another client appending at the same moment would
+type racingStorage struct {
+	*SQLiteStorage
+	races int
+}
+
+func (r *racingStorage) Swap(ctx context.Context, key string, old, data []byte) error {
+	if r.races > 0 {
+		r.races--
+		current, _ := r.LoadContext(ctx, key)
+		if err := r.SaveContext(ctx, key, append(current, 'x')); err != nil {
+			return err
+		}
+	}
+	return r.SQLiteStorage.Swap(ctx, key, old, data)
+}
+
+func TestStorageManager_Update_RetriesOnConflict(t *testing.T) {
+	backend := &racingStorage{SQLiteStorage: newTestSQLiteStorage(t), races: 1}
+	sm := NewStorageManager(backend, nil)
+
+	appendByte := func(current []byte) ([]byte, error) {
+		return append(current, 'a'), nil
+	}
+	if err := sm.Update("log", appendByte); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	// The first attempt lost to the competing write and was redone on top of it
+	if data, _ := sm.Load("log"); string(data) != "xa" {
+		t.Errorf("expected both writes to be kept, got %q", data)
+	}
+
+	backend.races = maxUpdateAttempts
+	if err := sm.Update("log", appendByte); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified after %d conflicts, got %v", maxUpdateAttempts, err)
+	}
+}
+
+func TestStorageManager_Update_WithEncryption(t *testing.T) {
+	encryptor, _ := NewAESEncryptor(make([]byte, 32))
+	sm := NewStorageManager(newTestSQLiteStorage(t), encryptor)
+
+	for _, want := range []string{"a", "ab"} {
+		err := sm.Update("log", func(current []byte) ([]byte, error) {
+			return append(current, want[len(want)-1]), nil
+		})
+		if err != nil {
+			t.Fatalf("Update failed: %v", err)
+		}
+		if data, err := sm.Load("log"); err != nil || string(data) != want {
+			t.Errorf("Load = %q, %v, want %q", data, err, want)
+		}
+	}
+}
+
+func TestStorageManager_Update_WithoutSwapper(t *testing.T) {
+	sm := NewStorageManager(newMockStorage(), nil)
+	sm.Save("log", []byte("a"))
+
+	err := sm.Update("log", func(current []byte) ([]byte, error) {
+		return append(current, 'b'), nil
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+	if data, _ := sm.Load("log"); string(data) != "ab" {
+		t.Errorf("expected %q, got %q", "ab", data)
+	}
+}
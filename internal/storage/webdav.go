@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+func init() {
+	RegisterBackend(Backend{
+		Name:        "webdav",
+		Description: "WebDAV share (Nextcloud, ownCloud, Apache mod_dav)",
+		Settings: []Setting{
+			{Name: "WEBDAV_URL", Description: "collection URL, created if missing", Required: true, Kind: SettingURL},
+			{Name: "WEBDAV_USERNAME", Description: "user name"},
+			{Name: "WEBDAV_PASSWORD", Description: "password; for Nextcloud use an app password", Secret: true},
+		},
+		New: func(cfg BackendConfig) (Storage, error) {
+			return NewWebDAVStorage(WebDAVOptions{
+				URL:      cfg.Settings.Get("WEBDAV_URL"),
+				Username: cfg.Settings.Get("WEBDAV_USERNAME"),
+				Password: cfg.Settings.Get("WEBDAV_PASSWORD"),
+			})
+		},
+		Locate: func(cfg BackendConfig) string {
+			return urlLocation(cfg.Settings.Get("WEBDAV_URL"))
+		},
+	})
+}
+
+const webdavConnectTimeout = 5 * time.Second
+
+// WebDAVOptions configures a WebDAVStorage
+type WebDAVOptions struct {
+	URL      string // collection URL, e.g. https://cloud.example.com/remote.php/dav/files/alice/todo/
+	Username string
+	Password string
+	Client   *http.Client // optional, e.g. for custom TLS settings
+}
+
+// WebDAVStorage implements storage on a WebDAV share (Nextcloud, ownCloud,
+// Apache mod_dav, ...). Each key is a file in the collection.
+//
+// ETags seen by Load and Save are sent back as If-Match on the next Save,
+// so a concurrent write from another client is reported as ErrModified
+// instead of being overwritten. Saves keep failing until the key is loaded
+// again, so the caller can merge the other client's changes.
+type WebDAVStorage struct {
+	base     *url.URL
+	username string
+	password string
+	client   *http.Client
+
+	mu    sync.Mutex
+	etags map[string]string
+}
+
+func NewWebDAVStorage(opts WebDAVOptions) (*WebDAVStorage, error) {
+	base, err := url.Parse(opts.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebDAV URL: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("invalid WebDAV URL %q: expected http or https", opts.URL)
+	}
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+
+	client := opts.Client
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	ws := &WebDAVStorage{
+		base:     base,
+		username: opts.Username,
+		password: opts.Password,
+		client:   client,
+		etags:    make(map[string]string),
+	}
+
+	// Create the collection if needed; 405 means it already exists
+	ctx, cancel := context.WithTimeout(context.Background(), webdavConnectTimeout)
+	defer cancel()
+	resp, err := ws.do(ctx, "MKCOL", ws.base.String(), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+		return nil, ws.statusError("MKCOL", "", resp)
+	}
+	return ws, nil
+}
+
+func (ws *WebDAVStorage) Load(key string) ([]byte, error) {
+	return ws.LoadContext(context.Background(), key)
+}
+
+func (ws *WebDAVStorage) Save(key string, data []byte) error {
+	return ws.SaveContext(context.Background(), key, data)
+}
+
+func (ws *WebDAVStorage) Delete(key string) error {
+	return ws.DeleteContext(context.Background(), key)
+}
+
+func (ws *WebDAVStorage) Exists(key string) (bool, error) {
+	return ws.ExistsContext(context.Background(), key)
+}
+
+func (ws *WebDAVStorage) List(prefix string) ([]string, error) {
+	return ws.ListContext(context.Background(), prefix)
+}
+
+// Close releases idle HTTP connections
+func (ws *WebDAVStorage) Close() error {
+	ws.client.CloseIdleConnections()
+	return nil
+}
+
+func (ws *WebDAVStorage) LoadContext(ctx context.Context, key string) ([]byte, error) {
+	resp, err := ws.do(ctx, http.MethodGet, ws.keyURL(key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, ws.statusError("GET", key, resp)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	ws.setETag(key, resp.Header.Get("ETag"))
+	return data, nil
+}
+
+func (ws *WebDAVStorage) SaveContext(ctx context.Context, key string, data []byte) error {
+	header := http.Header{}
+	if etag := ws.etag(key); etag != "" {
+		header.Set("If-Match", etag)
+	}
+	return ws.put(ctx, key, header, data)
+}
+
+// Swap implements Swapper: the value is read for the comparison and
+// written If-Match its ETag, or If-None-Match when old is nil. Without an
+// ETag from the server the write is unconditional.
+func (ws *WebDAVStorage) Swap(ctx context.Context, key string, old, data []byte) error {
+	header := http.Header{}
+	if old == nil {
+		header.Set("If-None-Match", "*")
+	} else {
+		resp, err := ws.do(ctx, http.MethodGet, ws.keyURL(key), nil, nil)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusOK:
+		case http.StatusNotFound:
+			return fmt.Errorf("webdav: %s: %w", key, ErrModified)
+		default:
+			return ws.statusError("GET", key, resp)
+		}
+		current, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(current, old) {
+			return fmt.Errorf("webdav: %s: %w", key, ErrModified)
+		}
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			header.Set("If-Match", etag)
+		}
+	}
+	return ws.put(ctx, key, header, data)
+}
+
+// put writes data with the conditional headers in header
+func (ws *WebDAVStorage) put(ctx context.Context, key string, header http.Header, data []byte) error {
+	header.Set("Content-Type", "application/octet-stream")
+	resp, err := ws.do(ctx, http.MethodPut, ws.keyURL(key), header, data)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated, http.StatusNoContent:
+	case http.StatusPreconditionFailed:
+		// Keep the stale ETag: an unconditional retry would overwrite the
+		// other client's changes
+		return fmt.Errorf("webdav: %s: %w", key, ErrModified)
+	default:
+		return ws.statusError("PUT", key, resp)
+	}
+
+	// Not every server returns the new ETag from PUT; without it the next
+	// save is unconditional
+	ws.setETag(key, resp.Header.Get("ETag"))
+	return nil
+}
+
+func (ws *WebDAVStorage) DeleteContext(ctx context.Context, key string) error {
+	resp, err := ws.do(ctx, http.MethodDelete, ws.keyURL(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		return ws.statusError("DELETE", key, resp)
+	}
+	ws.setETag(key, "")
+	return nil
+}
+
+func (ws *WebDAVStorage) ExistsContext(ctx context.Context, key string) (bool, error) {
+	resp, err := ws.do(ctx, http.MethodHead, ws.keyURL(key), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, ws.statusError("HEAD", key, resp)
+	}
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getetag/></d:prop></d:propfind>`
+
+// multistatus is the subset of a PROPFIND response used by ListContext
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"href"`
+		Propstats []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (ws *WebDAVStorage) ListContext(ctx context.Context, prefix string) ([]string, error) {
+	header := http.Header{
+		"Depth":        {"1"},
+		"Content-Type": {`application/xml; charset="utf-8"`},
+	}
+	resp, err := ws.do(ctx, "PROPFIND", ws.base.String(), header, []byte(propfindBody))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, ws.statusError("PROPFIND", "", resp)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("webdav: invalid PROPFIND response: %w", err)
+	}
+
+	var keys []string
+	for _, r := range ms.Responses {
+		isCollection := false
+		for _, ps := range r.Propstats {
+			if ps.Prop.ResourceType.Collection != nil {
+				isCollection = true
+			}
+		}
+		if isCollection {
+			continue
+		}
+
+		href, err := url.Parse(r.Href)
+		if err != nil {
+			continue
+		}
+		key := path.Base(href.Path)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+func (ws *WebDAVStorage) do(ctx context.Context, method, target string, header http.Header, body []byte) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if ws.username != "" || ws.password != "" {
+		req.SetBasicAuth(ws.username, ws.password)
+	}
+	return ws.client.Do(req)
+}
+
+func (ws *WebDAVStorage) keyURL(key string) string {
+	u := *ws.base
+	u.Path += key
+	u.RawPath = ""
+	return u.String()
+}
+
+func (ws *WebDAVStorage) etag(key string) string {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	return ws.etags[key]
+}
+
+func (ws *WebDAVStorage) setETag(key, etag string) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if etag == "" {
+		delete(ws.etags, key)
+	} else {
+		ws.etags[key] = etag
+	}
+}
+
+func (ws *WebDAVStorage) statusError(method, key string, resp *http.Response) error {
+	if key == "" {
+		return fmt.Errorf("webdav: %s %s: %s", method, ws.base.Redacted(), resp.Status)
+	}
+	return fmt.Errorf("webdav: %s %s: %s", method, key, resp.Status)
+}
@@ -0,0 +1,209 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/webdav"
+)
+
+// newTestWebDAVServer serves an in-memory WebDAV share. The handler does
+// not implement If-Match and If-None-Match itself, so it is checked here the way Nextcloud
+// and Apache do.
+func newTestWebDAVServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	dav := &webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: webdav.NewMemFS(),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		if !ok || user != "alice" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		match, noneMatch := r.Header.Get("If-Match"), r.Header.Get("If-None-Match")
+		if (match != "" || noneMatch != "") && r.Method == http.MethodPut {
+			head := httptest.NewRecorder()
+			dav.ServeHTTP(head, httptest.NewRequest(http.MethodHead, r.URL.EscapedPath(), nil))
+			if match != "" && head.Header().Get("ETag") != match || noneMatch == "*" && head.Code == http.StatusOK {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				return
+			}
+		}
+		dav.ServeHTTP(w, r)
+	})
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newTestWebDAVStorage(t *testing.T, server *httptest.Server) *WebDAVStorage {
+	t.Helper()
+	ws, err := NewWebDAVStorage(WebDAVOptions{
+		URL:      server.URL + "/dav/todo",
+		Username: "alice",
+		Password: "secret",
+	})
+	if err != nil {
+		t.Fatalf("failed to create webdav storage: %v", err)
+	}
+	t.Cleanup(func() {
+		ws.Close()
+	})
+	return ws
+}
+
+func TestNewWebDAVStorage_InvalidURL(t *testing.T) {
+	for _, u := range []string{"ftp://example.com/dav", "://bad"} {
+		if _, err := NewWebDAVStorage(WebDAVOptions{URL: u}); err == nil {
+			t.Errorf("expected error for %q", u)
+		}
+	}
+}
+
+func TestNewWebDAVStorage_BadCredentials(t *testing.T) {
+	server := newTestWebDAVServer(t)
+	_, err := NewWebDAVStorage(WebDAVOptions{URL: server.URL + "/dav/todo", Username: "alice", Password: "wrong"})
+	if err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected 401 error, got %v", err)
+	}
+}
+
+func TestWebDAVStorage_SaveLoad(t *testing.T) {
+	ws := newTestWebDAVStorage(t, newTestWebDAVServer(t))
+
+	if err := ws.Save("todos.json", []byte("hello")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	data, err := ws.Load("todos.json")
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("Load = %q, %v", data, err)
+	}
+
+	if err := ws.Save("todos.json", []byte("updated")); err != nil {
+		t.Fatalf("second Save failed: %v", err)
+	}
+	if data, _ := ws.Load("todos.json"); string(data) != "updated" {
+		t.Errorf("expected updated data, got %q", data)
+	}
+
+	if _, err := ws.Load("missing.json"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("expected 404 for a missing key, got %v", err)
+	}
+}
+
+func TestWebDAVStorage_ExistsDelete(t *testing.T) {
+	ws := newTestWebDAVStorage(t, newTestWebDAVServer(t))
+
+	if exists, err := ws.Exists("todos.json"); err != nil || exists {
+		t.Fatalf("Exists before save = %v, %v", exists, err)
+	}
+	ws.Save("todos.json", []byte("x"))
+	if exists, err := ws.Exists("todos.json"); err != nil || !exists {
+		t.Fatalf("Exists after save = %v, %v", exists, err)
+	}
+
+	if err := ws.Delete("todos.json"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if exists, _ := ws.Exists("todos.json"); exists {
+		t.Error("expected key to be deleted")
+	}
+	if err := ws.Delete("todos.json"); err == nil {
+		t.Error("expected error deleting a missing key")
+	}
+}
+
+func TestWebDAVStorage_List(t *testing.T) {
+	server := newTestWebDAVServer(t)
+	ws := newTestWebDAVStorage(t, server)
+
+	for _, key := range []string{"backup.b", "backup.a", "todos.json", "with space.json"} {
+		if err := ws.Save(key, []byte(key)); err != nil {
+			t.Fatalf("Save %s failed: %v", key, err)
+		}
+	}
+	// Subcollections are not keys
+	req, _ := http.NewRequest("MKCOL", server.URL+"/dav/todo/sub/", nil)
+	req.SetBasicAuth("alice", "secret")
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		resp.Body.Close()
+	}
+
+	keys, err := ws.List("")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	want := []string{"backup.a", "backup.b", "todos.json", "with space.json"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+
+	keys, _ = ws.List("backup.")
+	if want := []string{"backup.a", "backup.b"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("expected %v, got %v", want, keys)
+	}
+}
+
+func TestWebDAVStorage_ETagConflict(t *testing.T) {
+	server := newTestWebDAVServer(t)
+	first := newTestWebDAVStorage(t, server)
+	second := newTestWebDAVStorage(t, server)
+
+	first.Save("todos.json", []byte("v1"))
+	if _, err := second.Load("todos.json"); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if err := first.Save("todos.json", []byte("v2 from first")); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	err := second.Save("todos.json", []byte("v2 from second"))
+	if !errors.Is(err, ErrModified) {
+		t.Fatalf("expected ErrModified, got %v", err)
+	}
+	if err := second.Save("todos.json", []byte("v2 from second")); !errors.Is(err, ErrModified) {
+		t.Fatalf("expected the retry to fail until a reload, got %v", err)
+	}
+	if data, _ := first.Load("todos.json"); string(data) != "v2 from first" {
+		t.Errorf("conflicting save should not overwrite, got %q", data)
+	}
+
+	// After reloading, the save goes through
+	second.Load("todos.json")
+	if err := second.Save("todos.json", []byte("v3")); err != nil {
+		t.Errorf("Save after reload failed: %v", err)
+	}
+}
+
+func TestWebDAVStorage_Swap(t *testing.T) {
+	server := newTestWebDAVServer(t)
+	ws := newTestWebDAVStorage(t, server)
+	ctx := context.Background()
+
+	if err := ws.Swap(ctx, "audit.json", nil, []byte("v1")); err != nil {
+		t.Fatalf("Swap of a new key failed: %v", err)
+	}
+	if err := ws.Swap(ctx, "audit.json", nil, []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for an existing key, got %v", err)
+	}
+	if err := ws.Swap(ctx, "audit.json", []byte("stale"), []byte("v2")); !errors.Is(err, ErrModified) {
+		t.Errorf("expected ErrModified for a changed value, got %v", err)
+	}
+	if err := ws.Swap(ctx, "audit.json", []byte("v1"), []byte("v2")); err != nil {
+		t.Fatalf("Swap failed: %v", err)
+	}
+	if data, _ := ws.Load("audit.json"); string(data) != "v2" {
+		t.Errorf("expected v2, got %q", data)
+	}
+}